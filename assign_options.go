@@ -0,0 +1,115 @@
+package goseaweedfs
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// AssignOptions options for assigning file ids and growing volumes. According to https://github.com/chrislusf/seaweedfs/wiki/Master-Server-API
+type AssignOptions struct {
+	// Count number of file ids to reserve. For growing, it is number of volumes to grow.
+	Count int
+
+	// Collection which files belong to.
+	Collection string
+
+	// Replication replica placement. Nil means master's default replication.
+	Replication *ReplicaPlacement
+
+	// TTL time to live.
+	TTL TTL
+
+	// DataCenter prefers volumes located in this data center.
+	DataCenter string
+
+	// Rack prefers volumes located in this rack.
+	Rack string
+
+	// DataNode prefers volumes located in this data node.
+	DataNode string
+
+	// DiskType type of disk, e.g: "hdd", "ssd".
+	DiskType string
+
+	// Preallocate preallocates disk space (in bytes) for new volumes.
+	Preallocate int64
+
+	// WritableVolumeCount number of writable volumes master should keep for this kind of assignment.
+	WritableVolumeCount int
+}
+
+// Validate checks options.
+func (o *AssignOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+
+	if o.Count < 0 {
+		return fmt.Errorf("Invalid count %d", o.Count)
+	}
+
+	if o.TTL.Count > 0 && o.TTL.Unit.Duration() == 0 {
+		return fmt.Errorf("%w: unknown unit %q", ErrInvalidTTL, byte(o.TTL.Unit))
+	}
+
+	if rp := o.Replication; rp != nil {
+		if _, err := NewReplicaPlacement(rp.DiffDataCenterCount, rp.DiffRackCount, rp.SameRackCount); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newAssignOptions builds assign options from replication and ttl strings.
+func newAssignOptions(collection, replication, ttl string) (opts *AssignOptions, err error) {
+	opts = &AssignOptions{Collection: collection}
+	if opts.Replication, err = ParseReplicaPlacement(replication); err == nil {
+		opts.TTL, err = ParseTTL(ttl)
+	}
+	return
+}
+
+func (o *AssignOptions) clone() *AssignOptions {
+	var opts AssignOptions
+	if o != nil {
+		opts = *o
+	}
+	return &opts
+}
+
+// Values encodes options to SeaweedFS http params.
+func (o *AssignOptions) Values() url.Values {
+	if o == nil {
+		return make(url.Values)
+	}
+
+	args := normalize(nil, o.Collection, o.TTL.String())
+	if o.Count > 0 {
+		args.Set(ParamAssignCount, strconv.Itoa(o.Count))
+	}
+	if o.Replication != nil {
+		args.Set(ParamAssignReplication, o.Replication.String())
+	}
+	if o.DataCenter != "" {
+		args.Set(ParamAssignDataCenter, o.DataCenter)
+	}
+	if o.Rack != "" {
+		args.Set(ParamAssignRack, o.Rack)
+	}
+	if o.DataNode != "" {
+		args.Set(ParamAssignDataNode, o.DataNode)
+	}
+	if o.DiskType != "" {
+		args.Set(ParamAssignDiskType, o.DiskType)
+	}
+	if o.Preallocate > 0 {
+		args.Set(ParamAssignPreallocate, strconv.FormatInt(o.Preallocate, 10))
+	}
+	if o.WritableVolumeCount > 0 {
+		args.Set(ParamAssignWritableVolumeCount, strconv.Itoa(o.WritableVolumeCount))
+	}
+
+	return args
+}
@@ -0,0 +1,228 @@
+package goseaweedfs
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+const (
+	defaultBatchUploadConcurrency = 8
+	defaultBatchUploadRetries     = 2
+)
+
+// BatchUploaderOptions options of batch uploader.
+type BatchUploaderOptions struct {
+	// Concurrency number of files uploaded at the same time. Default: client concurrency or 8.
+	Concurrency int
+
+	// Retries number of retries for each file, each with file id assigned by a new assign request. Files whose reader is not
+	// an io.Seeker are not retried. Default: 2. Negative value disables retrying.
+	Retries int
+
+	// AssignCount number of file ids reserved per assign request. File ids are reserved on demand, so that
+	// a batch of n files needs n/AssignCount assign requests. Zero or one assigns file id per file.
+	AssignCount int
+
+	// AssignOptions default options for assigning file ids. Collection and TTL are also used for files which have none.
+	AssignOptions *AssignOptions
+}
+
+// BatchUploadResult result of uploading a file of batch.
+type BatchUploadResult struct {
+	// Index position of file in batch or input stream.
+	Index int
+
+	FileName string
+	FileID   string
+	FileURL  string
+	Size     int64
+
+	// Server volume server which file is uploaded to.
+	Server string
+
+	// Manifest of file if it is uploaded by chunks.
+	Manifest *ChunkManifest
+
+	// Checksums of file content, set if client computes checksums.
+	Checksums Checksums
+
+	// CipherKey key of file content, set if client uses cipher mode. See FilePart.CipherKey.
+	CipherKey []byte
+
+	// Attempts number of upload attempts.
+	Attempts int
+
+	Err error
+}
+
+// BatchUploader uploads many files with bounded concurrency, retrying failed files. File ids of files are assigned by uploader.
+type BatchUploader struct {
+	c    *Seaweed
+	opts BatchUploaderOptions
+	pool *FileIDPool
+}
+
+// NewBatchUploader creates batch uploader. Uploader must be closed after use.
+func (c *Seaweed) NewBatchUploader(opts BatchUploaderOptions) *BatchUploader {
+	if opts.Concurrency <= 0 {
+		if opts.Concurrency = c.concurrency; opts.Concurrency <= 0 {
+			opts.Concurrency = defaultBatchUploadConcurrency
+		}
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	} else if opts.Retries == 0 {
+		opts.Retries = defaultBatchUploadRetries
+	}
+
+	u := &BatchUploader{c: c, opts: opts}
+	if opts.AssignCount > 1 {
+		u.pool = NewFileIDPool(c, opts.AssignCount, 0)
+		u.pool.lowWatermark = -1 // reserve on demand only, batch should not leave unused reservations behind
+	}
+
+	return u
+}
+
+// Close stops file id pool of uploader. File ids reserved but not used are left unused, SeaweedFS has no way to
+// release them.
+func (u *BatchUploader) Close() {
+	if u.pool != nil {
+		u.pool.Close()
+	}
+}
+
+// Upload uploads files, returning result of each file at its index. Uploading stops when ctx is done,
+// not uploaded files have context error.
+func (u *BatchUploader) Upload(ctx context.Context, files []*FilePart) []*BatchUploadResult {
+	in := make(chan *FilePart)
+	go func() {
+		defer close(in)
+		for _, f := range files {
+			in <- f
+		}
+	}()
+
+	results := make([]*BatchUploadResult, len(files))
+	for r := range u.UploadStream(ctx, in) {
+		results[r.Index] = r
+	}
+	return results
+}
+
+// UploadStream uploads files received from input until it is closed. Results are sent in completion order,
+// result channel is closed after input is closed and all files are uploaded. When ctx is done, files still
+// received from input are not uploaded but reported with context error, caller should stop sending and close input.
+// Caller must drain results.
+func (u *BatchUploader) UploadStream(ctx context.Context, files <-chan *FilePart) <-chan *BatchUploadResult {
+	type indexedFile struct {
+		index int
+		f     *FilePart
+	}
+
+	indexed := make(chan indexedFile)
+	go func() {
+		defer close(indexed)
+		index := 0
+		for f := range files {
+			indexed <- indexedFile{index: index, f: f}
+			index++
+		}
+	}()
+
+	results := make(chan *BatchUploadResult, u.opts.Concurrency)
+
+	var wg sync.WaitGroup
+	wg.Add(u.opts.Concurrency)
+	for i := 0; i < u.opts.Concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for file := range indexed {
+				results <- u.upload(ctx, file.index, file.f)
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	return results
+}
+
+func (u *BatchUploader) upload(ctx context.Context, index int, f *FilePart) (result *BatchUploadResult) {
+	result = &BatchUploadResult{Index: index, FileName: f.FileName, Size: f.FileSize}
+
+	if result.Err = ctx.Err(); result.Err != nil {
+		return
+	}
+
+	// upload a copy, leaving file part of caller as is
+	part := *f
+	f = &part
+
+	if opts := u.opts.AssignOptions; opts != nil {
+		if f.AssignOptions == nil {
+			f.AssignOptions = opts
+		} else if f.AssignOptions.TTL.IsZero() {
+			f.AssignOptions = f.AssignOptions.clone()
+			f.AssignOptions.TTL = opts.TTL
+		}
+		if f.Collection == "" {
+			f.Collection = opts.Collection
+		}
+	}
+
+	c := u.c
+	for attempt := 0; ; attempt++ {
+		result.Attempts++
+
+		var assigned *AssignResult
+		if assigned, result.Err = u.assign(ctx, f, attempt > 0); result.Err == nil {
+			f.Server, f.FileID, f.Auth = assigned.URL, assigned.FileID, assigned.Auth
+			result.FileID, result.FileURL = assigned.FileID, assigned.PublicURL+"/"+assigned.FileID
+			result.Manifest, result.Err = c.UploadFilePartContext(ctx, f)
+		}
+
+		if result.Err == nil || attempt >= u.opts.Retries || ctx.Err() != nil || !rewind(f.Reader) {
+			break
+		}
+
+		observeRetry(c.metrics, OpUpload, f.Server)
+		f.Server, f.FileID, f.Auth = "", "", ""
+	}
+
+	if result.Err != nil {
+		result.FileID, result.FileURL = "", ""
+	} else {
+		result.Server, result.Checksums, result.CipherKey = f.Server, f.Checksums, f.CipherKey
+	}
+
+	return
+}
+
+// assign assigns file id for uploading file. Retries are assigned by a fresh assign request, since the rest of
+// reserved file ids is likely on the volume which failed.
+func (u *BatchUploader) assign(ctx context.Context, f *FilePart, retry bool) (*AssignResult, error) {
+	opts := f.assignOptions()
+
+	if retry {
+		return u.c.AssignWithOptionsContext(ctx, opts)
+	}
+	if u.pool != nil {
+		return u.pool.Get(opts)
+	}
+	return u.c.assignFileID(ctx, opts)
+}
+
+// rewind seeks reader to its start for retrying. False if reader is not seekable.
+func rewind(r io.Reader) bool {
+	s, ok := r.(io.Seeker)
+	if !ok {
+		return false
+	}
+	_, err := s.Seek(0, io.SeekStart)
+	return err == nil
+}
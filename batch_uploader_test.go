@@ -0,0 +1,130 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newBatchFiles(n int) []*FilePart {
+	files := make([]*FilePart, n)
+	for i := range files {
+		content := []byte(fmt.Sprintf("file content %d", i))
+		files[i] = NewFilePartFromReader(readSeekCloser{bytes.NewReader(content)}, fmt.Sprintf("%d.txt", i), int64(len(content)))
+	}
+	return files
+}
+
+func TestBatchUploader(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient))
+	require.Nil(t, err)
+	defer c.Close()
+
+	u := c.NewBatchUploader(BatchUploaderOptions{Concurrency: 4, AssignCount: 8})
+	defer u.Close()
+
+	atomic.StoreInt32(&cluster.uploadFailures, 2)
+
+	files := newBatchFiles(20)
+	results := u.Upload(context.Background(), files)
+	require.Len(t, results, 20)
+
+	fids := make(map[string]bool)
+	retried := 0
+	for i, r := range results {
+		require.Nil(t, r.Err)
+		require.Equal(t, i, r.Index)
+		require.Equal(t, fmt.Sprintf("%d.txt", i), r.FileName)
+
+		data, ok := cluster.file(r.FileID)
+		require.True(t, ok)
+		require.Equal(t, fmt.Sprintf("file content %d", i), string(data))
+
+		fids[r.FileID] = true
+		retried += r.Attempts - 1
+	}
+	require.Len(t, fids, 20)
+	require.Equal(t, 2, retried)
+
+	// 20 file ids are reserved 8 per assign, retries are assigned one by one
+	require.EqualValues(t, 3+2, atomic.LoadInt32(&cluster.assigns))
+
+	// file parts of caller are not modified
+	for _, f := range files {
+		require.Empty(t, f.FileID)
+		require.Empty(t, f.Server)
+	}
+}
+
+func TestBatchUploaderStream(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient))
+	require.Nil(t, err)
+	defer c.Close()
+
+	u := c.NewBatchUploader(BatchUploaderOptions{Concurrency: 3, Retries: -1})
+	defer u.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	in := make(chan *FilePart)
+	results := u.UploadStream(ctx, in)
+
+	go func() {
+		defer close(in)
+		for i, f := range newBatchFiles(10) {
+			if i == 5 {
+				cancel()
+			}
+			in <- f
+		}
+	}()
+
+	uploaded, cancelled := 0, 0
+	for r := range results {
+		if r.Err == nil {
+			uploaded++
+		} else {
+			require.True(t, errors.Is(r.Err, context.Canceled))
+			require.Empty(t, r.FileID)
+			cancelled++
+		}
+	}
+	require.Equal(t, 10, uploaded+cancelled)
+	require.GreaterOrEqual(t, cancelled, 5-3)
+	// uploads interrupted by cancellation may have been stored already
+	require.GreaterOrEqual(t, cluster.fileCount(), uploaded)
+}
+
+func TestBatchUploadFileParts(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient))
+	require.Nil(t, err)
+	defer c.Close()
+
+	files := newBatchFiles(5)
+	results, err := c.BatchUploadFileParts(files, "", "")
+	require.Nil(t, err)
+	require.EqualValues(t, 1, atomic.LoadInt32(&cluster.assigns))
+
+	for i, r := range results {
+		require.Empty(t, r.Error)
+		require.Contains(t, r.FileURL, r.FileID)
+		require.Equal(t, r.FileID, files[i].FileID)
+		require.NotEmpty(t, files[i].Server)
+	}
+}
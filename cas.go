@@ -0,0 +1,358 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrCASNotFound content is not indexed by content-addressed store.
+var ErrCASNotFound = errors.New("seaweedfs: content is not found in content-addressed store")
+
+// CASEntry indexed content of content-addressed store.
+type CASEntry struct {
+	// Hash hex encoded SHA-256 of content.
+	Hash string `json:"hash"`
+
+	// FileID file id of stored content.
+	FileID string `json:"fid"`
+
+	// Size of content.
+	Size int64 `json:"size"`
+
+	// Refs number of references to content.
+	Refs int64 `json:"refs"`
+
+	// Chunked file id is of a chunk manifest whose chunks are deleted with it.
+	Chunked bool `json:"chunked,omitempty"`
+
+	// Chunks hashes of deduplicated chunks. File id is then of a plain file listing the chunks, which is assembled by
+	// client, so that deleting it leaves shared chunks alone.
+	Chunks []string `json:"chunks,omitempty"`
+
+	// CipherKey key of stored file encrypted in cipher mode. FilerCASIndex stores it wrapped by key provider of filer.
+	CipherKey []byte `json:"cipher_key,omitempty"`
+}
+
+// CASIndex maps hashes of content to stored files with their reference counts. Implementations must be
+// safe for concurrent use, reference counting operations must be atomic.
+type CASIndex interface {
+	// Get returns entry of content with hash, nil if content is not indexed.
+	Get(hash string) (*CASEntry, error)
+
+	// Acquire adds a reference to content with hash, returning its entry. Nil if content is not indexed.
+	Acquire(hash string) (*CASEntry, error)
+
+	// Add indexes content with one reference. If content with the same hash is indexed meanwhile, a reference
+	// is added to it and the existing entry is returned instead.
+	Add(entry *CASEntry) (*CASEntry, error)
+
+	// Release removes a reference to content with hash, removing content from index if it is not referenced anymore.
+	// Returned entry has remaining number of references. Fails with ErrCASNotFound if content is not indexed.
+	Release(hash string) (*CASEntry, error)
+}
+
+// CASOptions options of content-addressed store.
+type CASOptions struct {
+	// AssignOptions options for assigning file ids of stored content, e.g: collection, replication.
+	AssignOptions *AssignOptions
+
+	// DedupChunks splits content larger than chunk size of client into chunks which are deduplicated on their own,
+	// content is then stored as chunk manifest referencing them. Ignored if client encrypts content with key provider.
+	DedupChunks bool
+
+	// TempDir directory for spooling content which is not seekable, default temp directory if empty.
+	TempDir string
+}
+
+// CAS content-addressed store on top of Seaweed: content is addressed by its SHA-256, identical content is stored once.
+// Each Put of content adds a reference to it, Release removes one and deletes stored content when it is not referenced anymore.
+type CAS struct {
+	c     *Seaweed
+	index CASIndex
+	opts  CASOptions
+}
+
+// NewCAS creates content-addressed store keeping its index in index.
+func NewCAS(c *Seaweed, index CASIndex, opts *CASOptions) *CAS {
+	s := &CAS{c: c, index: index}
+	if opts != nil {
+		s.opts = *opts
+	}
+	return s
+}
+
+// Put stores content unless identical content is stored already, adding a reference to it. Content which is not
+// seekable is spooled to a temporary file for hashing. Deduplicated tells whether content was stored already.
+func (s *CAS) Put(r io.Reader, fileName string) (entry *CASEntry, deduplicated bool, err error) {
+	src, cleanup, err := s.seekable(r)
+	if err != nil {
+		return
+	}
+	defer cleanup()
+
+	hash, size, err := hashOfSeeker(src)
+	if err != nil {
+		return
+	}
+
+	if entry, err = s.index.Acquire(hash); err != nil || entry != nil {
+		return entry, entry != nil, err
+	}
+
+	if s.opts.DedupChunks && s.c.keys == nil && s.c.chunkSize > 0 && size > s.c.chunkSize {
+		entry, err = s.putChunks(src, fileName, hash, size)
+	} else {
+		entry, err = s.putFile(src, fileName, "", hash, size)
+	}
+	if err != nil {
+		return
+	}
+
+	return s.add(entry)
+}
+
+// add indexes stored content. If identical content got indexed meanwhile, stored content is deleted.
+func (s *CAS) add(entry *CASEntry) (*CASEntry, bool, error) {
+	actual, err := s.index.Add(entry)
+	if err != nil || actual.FileID == entry.FileID {
+		if err != nil {
+			s.c.client.warn("seaweedfs: delete of content not indexed failed", s.delete(entry), "fid", entry.FileID)
+		}
+		return actual, false, err
+	}
+
+	s.c.client.warn("seaweedfs: delete of duplicated content failed", s.delete(entry), "fid", entry.FileID)
+	return actual, true, nil
+}
+
+// putFile stores content as a file, mime type is guessed from file name if empty.
+func (s *CAS) putFile(r io.Reader, fileName, mtype, hash string, size int64) (entry *CASEntry, err error) {
+	fp := NewFilePartFromReader(ioutil.NopCloser(r), fileName, size)
+	fp.AssignOptions = s.opts.AssignOptions
+	if mtype != "" {
+		fp.MimeType = mtype
+	}
+
+	cm, err := s.c.UploadFilePart(fp)
+	if err == nil {
+		entry = &CASEntry{Hash: hash, FileID: fp.FileID, Size: size, Refs: 1, Chunked: cm != nil, CipherKey: fp.CipherKey}
+	}
+	return
+}
+
+// putChunks stores content as deduplicated chunks, listed by a chunk manifest stored as plain file.
+func (s *CAS) putChunks(r io.Reader, fileName, hash string, size int64) (entry *CASEntry, err error) {
+	baseName := path.Base(fileName)
+
+	cm := &ChunkManifest{Name: baseName, Size: size, Mime: mime.TypeByExtension(strings.ToLower(path.Ext(fileName)))}
+	entry = &CASEntry{Hash: hash, Size: size, Refs: 1}
+
+	defer func() {
+		if err != nil { // release acquired chunks
+			for _, h := range entry.Chunks {
+				s.c.client.warn("seaweedfs: release of chunk failed", s.Release(h), "hash", h)
+			}
+			entry = nil
+		}
+	}()
+
+	buf := make([]byte, s.c.chunkSize)
+	for offset := int64(0); offset < size; {
+		var n int
+		if n, err = io.ReadFull(r, buf); err == io.ErrUnexpectedEOF || (err == io.EOF && n == 0) {
+			err = nil
+		}
+		if err != nil {
+			return
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("Content is shorter than %d bytes", size)
+		}
+
+		var chunk *CASEntry
+		if chunk, err = s.putChunk(buf[:n], baseName+"_"+strconv.Itoa(len(cm.Chunks)+1), cm.Mime); err != nil {
+			return
+		}
+		entry.Chunks = append(entry.Chunks, chunk.Hash)
+
+		cm.Chunks = append(cm.Chunks, &ChunkInfo{Fid: chunk.FileID, Offset: offset, Size: int64(n), CipherKey: chunk.CipherKey})
+		offset += int64(n)
+	}
+
+	// volume server would delete chunks along with manifest uploaded as such, while chunks are shared
+	var data []byte
+	if data, err = cm.Marshal(); err != nil {
+		return
+	}
+
+	var manifest *CASEntry
+	if manifest, err = s.putFile(bytes.NewReader(data), baseName, "application/json", "", int64(len(data))); err == nil {
+		entry.FileID, entry.Chunked, entry.CipherKey = manifest.FileID, manifest.Chunked, manifest.CipherKey
+	}
+	return
+}
+
+// putChunk stores chunk unless identical chunk is stored already, adding a reference to it.
+func (s *CAS) putChunk(data []byte, name, mtype string) (chunk *CASEntry, err error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	if chunk, err = s.index.Acquire(hash); err != nil || chunk != nil {
+		return
+	}
+
+	if chunk, err = s.putFile(bytes.NewReader(data), name, mtype, hash, int64(len(data))); err == nil {
+		chunk, _, err = s.add(chunk)
+	}
+	return
+}
+
+// Get returns entry of content with hash. Fails with ErrCASNotFound if content is not stored.
+func (s *CAS) Get(hash string) (*CASEntry, error) {
+	entry, err := s.index.Get(hash)
+	if err == nil && entry == nil {
+		err = ErrCASNotFound
+	}
+	return entry, err
+}
+
+// Download content with hash, verifying it against its hash. Fails with ErrCASNotFound if content is not stored.
+func (s *CAS) Download(hash string, callback func(io.Reader) error) (err error) {
+	entry, err := s.Get(hash)
+	if err != nil {
+		return
+	}
+
+	verify := func(r io.Reader) error {
+		return callback(newVerifyingReader(r, entry.FileID, Checksums{SHA256: hash}))
+	}
+	if len(entry.Chunks) > 0 {
+		return s.downloadChunks(entry, verify)
+	}
+
+	_, err = s.c.DownloadWithOptions(entry.FileID, nil, &DownloadOptions{CipherKey: entry.CipherKey}, func(_ *DownloadResponse, r io.Reader) error {
+		return verify(r)
+	})
+	return
+}
+
+// downloadChunks downloads content stored as deduplicated chunks, reading chunks listed by its manifest in order.
+func (s *CAS) downloadChunks(entry *CASEntry, callback func(io.Reader) error) (err error) {
+	var data []byte
+	_, err = s.c.DownloadWithOptions(entry.FileID, nil, &DownloadOptions{CipherKey: entry.CipherKey}, func(_ *DownloadResponse, r io.Reader) (err error) {
+		data, err = ioutil.ReadAll(r)
+		return
+	})
+	if err != nil {
+		return
+	}
+
+	cm, err := loadChunkManifest(data, false)
+	if err != nil {
+		return
+	}
+
+	pr, pw := io.Pipe()
+	var copyErr error
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+
+		for _, chunk := range cm.Chunks {
+			if _, copyErr = s.c.DownloadWithOptions(chunk.Fid, nil, &DownloadOptions{CipherKey: chunk.CipherKey}, func(_ *DownloadResponse, r io.Reader) error {
+				_, err := io.Copy(pw, r)
+				return err
+			}); copyErr != nil {
+				break
+			}
+		}
+		_ = pw.CloseWithError(copyErr)
+	}()
+
+	err = callback(pr)
+	_ = pr.Close()
+	<-copied
+
+	// callback may not read till failure of copying
+	if err == nil && copyErr != nil && !errors.Is(copyErr, io.ErrClosedPipe) {
+		err = copyErr
+	}
+
+	return
+}
+
+// Release removes a reference to content with hash. Stored content is deleted when it is not referenced anymore,
+// chunks of deduplicated chunks are released. Fails with ErrCASNotFound if content is not stored.
+func (s *CAS) Release(hash string) error {
+	entry, err := s.index.Release(hash)
+	if err != nil || entry.Refs > 0 {
+		return err
+	}
+	return s.delete(entry)
+}
+
+// delete deletes stored content of entry, releasing its chunks.
+func (s *CAS) delete(entry *CASEntry) (err error) {
+	if err = s.c.DeleteFileWithOptions(entry.FileID, nil, &DeleteOptions{Chunks: entry.Chunked}); err != nil {
+		return
+	}
+
+	for _, h := range entry.Chunks {
+		if e := s.Release(h); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// seekable returns content as seeker, spooling it to a temporary file if it is not seekable.
+func (s *CAS) seekable(r io.Reader) (io.ReadSeeker, func(), error) {
+	if seeker, ok := r.(io.ReadSeeker); ok {
+		return seeker, func() {}, nil
+	}
+
+	f, err := ioutil.TempFile(s.opts.TempDir, "goseaweedfs-cas-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}
+
+	if _, err = io.Copy(f, r); err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	return f, cleanup, nil
+}
+
+// hashOfSeeker computes SHA-256 and size of content from current position of r, seeking back after.
+func hashOfSeeker(r io.ReadSeeker) (hash string, size int64, err error) {
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+
+	h := sha256.New()
+	if size, err = io.Copy(h, r); err == nil {
+		if _, err = r.Seek(pos, io.SeekStart); err == nil {
+			hash = hex.EncodeToString(h.Sum(nil))
+		}
+	}
+	return
+}
@@ -0,0 +1,417 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// MemoryCASIndex in-memory index of content-addressed store. It is lost when process exits,
+// suitable for tests and short-lived stores.
+type MemoryCASIndex struct {
+	mu      sync.Mutex
+	entries map[string]*CASEntry
+}
+
+// NewMemoryCASIndex creates empty in-memory index.
+func NewMemoryCASIndex() *MemoryCASIndex {
+	return &MemoryCASIndex{entries: make(map[string]*CASEntry)}
+}
+
+// Get implements CASIndex.
+func (m *MemoryCASIndex) Get(hash string) (*CASEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.entries[hash].clone(), nil
+}
+
+// Acquire implements CASIndex.
+func (m *MemoryCASIndex) Acquire(hash string) (*CASEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := m.entries[hash]
+	if entry != nil {
+		entry.Refs++
+	}
+	return entry.clone(), nil
+}
+
+// Add implements CASIndex.
+func (m *MemoryCASIndex) Add(entry *CASEntry) (*CASEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if existing := m.entries[entry.Hash]; existing != nil {
+		existing.Refs++
+		return existing.clone(), nil
+	}
+
+	entry = entry.clone()
+	entry.Refs = 1
+	m.entries[entry.Hash] = entry
+	return entry.clone(), nil
+}
+
+// Release implements CASIndex.
+func (m *MemoryCASIndex) Release(hash string) (*CASEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := m.entries[hash]
+	if entry == nil {
+		return nil, ErrCASNotFound
+	}
+
+	if entry.Refs--; entry.Refs <= 0 {
+		delete(m.entries, hash)
+	}
+	return entry.clone(), nil
+}
+
+var casBucket = []byte("cas")
+
+// BoltCASIndex index of content-addressed store persisted in a bolt database file. Reference counting is atomic
+// within the process owning the file, bolt locks the file against other processes.
+type BoltCASIndex struct {
+	db *bolt.DB
+}
+
+// NewBoltCASIndex opens (creating if needed) bolt database at path as index.
+func NewBoltCASIndex(path string) (*BoltCASIndex, error) {
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(casBucket)
+		return err
+	}); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return &BoltCASIndex{db: db}, nil
+}
+
+// Close closes underlying database.
+func (b *BoltCASIndex) Close() error {
+	return b.db.Close()
+}
+
+// Get implements CASIndex.
+func (b *BoltCASIndex) Get(hash string) (entry *CASEntry, err error) {
+	err = b.db.View(func(tx *bolt.Tx) (err error) {
+		entry, err = boltCASEntry(tx.Bucket(casBucket), hash)
+		return
+	})
+	return
+}
+
+// Acquire implements CASIndex.
+func (b *BoltCASIndex) Acquire(hash string) (entry *CASEntry, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) (err error) {
+		bucket := tx.Bucket(casBucket)
+		if entry, err = boltCASEntry(bucket, hash); err != nil || entry == nil {
+			return
+		}
+
+		entry.Refs++
+		return putBoltCASEntry(bucket, entry)
+	})
+	if err != nil {
+		entry = nil
+	}
+	return
+}
+
+// Add implements CASIndex.
+func (b *BoltCASIndex) Add(entry *CASEntry) (actual *CASEntry, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) (err error) {
+		bucket := tx.Bucket(casBucket)
+		if actual, err = boltCASEntry(bucket, entry.Hash); err != nil {
+			return
+		}
+
+		if actual != nil {
+			actual.Refs++
+		} else {
+			actual = entry.clone()
+			actual.Refs = 1
+		}
+		return putBoltCASEntry(bucket, actual)
+	})
+	if err != nil {
+		actual = nil
+	}
+	return
+}
+
+// Release implements CASIndex.
+func (b *BoltCASIndex) Release(hash string) (entry *CASEntry, err error) {
+	err = b.db.Update(func(tx *bolt.Tx) (err error) {
+		bucket := tx.Bucket(casBucket)
+		if entry, err = boltCASEntry(bucket, hash); err != nil {
+			return
+		}
+		if entry == nil {
+			return ErrCASNotFound
+		}
+
+		if entry.Refs--; entry.Refs <= 0 {
+			return bucket.Delete([]byte(hash))
+		}
+		return putBoltCASEntry(bucket, entry)
+	})
+	if err != nil {
+		entry = nil
+	}
+	return
+}
+
+func boltCASEntry(bucket *bolt.Bucket, hash string) (*CASEntry, error) {
+	data := bucket.Get([]byte(hash))
+	if data == nil {
+		return nil, nil
+	}
+
+	entry := &CASEntry{}
+	if err := json.Unmarshal(data, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func putBoltCASEntry(bucket *bolt.Bucket, entry *CASEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(entry.Hash), data)
+}
+
+// FilerCASIndex index of content-addressed store kept as JSON files in filer directory, one file per content
+// at dir/<first two hex digits of hash>/<hash>. Files are updated by conditional writes, If-Match etag of read file
+// or If-None-Match of new one, retried when another process updated the file meanwhile; filer must honour these
+// preconditions for reference counting to be atomic across processes. Cipher keys of entries are stored wrapped by
+// key provider of filer, indexing content with cipher key fails with ErrNoKeyProvider if filer has none.
+type FilerCASIndex struct {
+	f   *Filer
+	dir string
+}
+
+// filerCASRetries number of attempts of conditional write before giving up.
+const filerCASRetries = 16
+
+var errFilerCASConflict = errors.New("seaweedfs: index file is modified concurrently")
+
+// filerCASRecord entry as stored in filer, with cipher key wrapped by key provider of filer.
+type filerCASRecord struct {
+	CASEntry
+	KeyID      string `json:"key_id,omitempty"`
+	WrappedKey []byte `json:"wrapped_key,omitempty"`
+}
+
+// NewFilerCASIndex creates index kept in directory dir of filer.
+func NewFilerCASIndex(f *Filer, dir string) *FilerCASIndex {
+	return &FilerCASIndex{f: f, dir: strings.TrimSuffix(dir, "/")}
+}
+
+// Get implements CASIndex.
+func (x *FilerCASIndex) Get(hash string) (entry *CASEntry, err error) {
+	entry, _, err = x.read(context.Background(), hash)
+	return
+}
+
+// Acquire implements CASIndex.
+func (x *FilerCASIndex) Acquire(hash string) (*CASEntry, error) {
+	return x.update(hash, func(entry *CASEntry) (*CASEntry, error) {
+		if entry != nil {
+			entry.Refs++
+		}
+		return entry, nil
+	})
+}
+
+// Add implements CASIndex.
+func (x *FilerCASIndex) Add(entry *CASEntry) (*CASEntry, error) {
+	return x.update(entry.Hash, func(actual *CASEntry) (*CASEntry, error) {
+		if actual != nil {
+			actual.Refs++
+		} else {
+			actual = entry.clone()
+			actual.Refs = 1
+		}
+		return actual, nil
+	})
+}
+
+// Release implements CASIndex.
+func (x *FilerCASIndex) Release(hash string) (*CASEntry, error) {
+	return x.update(hash, func(entry *CASEntry) (*CASEntry, error) {
+		if entry == nil {
+			return nil, ErrCASNotFound
+		}
+		entry.Refs--
+		return entry, nil
+	})
+}
+
+// update applies fn to entry of hash, nil if there is none, and writes back entry returned by fn unless it is nil.
+// Entry without references is removed. Update is retried if file of entry is modified meanwhile.
+func (x *FilerCASIndex) update(hash string, fn func(*CASEntry) (*CASEntry, error)) (*CASEntry, error) {
+	ctx := context.Background()
+	for attempt := 0; attempt < filerCASRetries; attempt++ {
+		entry, etag, err := x.read(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		if entry, err = fn(entry); err != nil || entry == nil {
+			return nil, err
+		}
+
+		if entry.Refs <= 0 {
+			err = x.remove(ctx, hash, etag)
+		} else {
+			err = x.write(ctx, entry, etag)
+		}
+		if err != errFilerCASConflict {
+			if err != nil {
+				return nil, err
+			}
+			return entry, nil
+		}
+
+		time.Sleep(time.Duration(rand.Int63n(int64(time.Duration(attempt+1) * time.Millisecond))))
+	}
+	return nil, fmt.Errorf("Update of %s: %w, gave up after %d attempts", x.path(hash), errFilerCASConflict, filerCASRetries)
+}
+
+func (x *FilerCASIndex) path(hash string) string {
+	prefix := hash
+	if len(prefix) > 2 {
+		prefix = prefix[:2]
+	}
+	return x.dir + "/" + prefix + "/" + hash
+}
+
+// read returns entry of hash with etag of its file, nil if there is none.
+func (x *FilerCASIndex) read(ctx context.Context, hash string) (entry *CASEntry, etag string, err error) {
+	var data []byte
+	resp, err := x.f.DownloadWithOptionsContext(ctx, x.path(hash), nil, nil, func(_ *DownloadResponse, r io.Reader) (err error) {
+		data, err = ioutil.ReadAll(r)
+		return
+	})
+
+	var se *statusError
+	if errors.As(err, &se) && se.code == http.StatusNotFound {
+		return nil, "", nil
+	}
+	if err != nil {
+		return
+	}
+
+	record := &filerCASRecord{}
+	if err = json.Unmarshal(data, record); err != nil {
+		return
+	}
+	if record.WrappedKey != nil {
+		if x.f.keys == nil {
+			return nil, "", ErrNoKeyProvider
+		}
+		if record.CipherKey, err = x.f.keys.UnwrapKey(ctx, record.KeyID, record.WrappedKey); err != nil {
+			return nil, "", err
+		}
+	}
+
+	return &record.CASEntry, resp.ETag, nil
+}
+
+// write writes entry if its file is still of etag, or does not exist yet if etag is empty.
+func (x *FilerCASIndex) write(ctx context.Context, entry *CASEntry, etag string) (err error) {
+	record := &filerCASRecord{CASEntry: *entry}
+	if entry.CipherKey != nil {
+		if x.f.keys == nil {
+			return ErrNoKeyProvider
+		}
+		if record.KeyID, record.WrappedKey, err = x.f.keys.WrapKey(ctx, entry.CipherKey); err != nil {
+			return
+		}
+		record.CipherKey = nil
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	path := x.path(entry.Hash)
+	ctx, end := x.f.startCall(ctx, OpFilerUpload, path)
+	defer end(&err)
+
+	url := encodeURI(*x.f.base, path, nil)
+	_, statusCode, err := x.f.client.upload(ctx, OpFilerUpload, url, entry.Hash, bytes.NewReader(data), "application/json", x.precondition(etag))
+	x.f.cache.InvalidatePath(path)
+	x.f.invalidateMemoryCache(path, false)
+
+	if statusCode == http.StatusPreconditionFailed {
+		return errFilerCASConflict
+	}
+	if err == nil && statusCode >= http.StatusBadRequest {
+		err = &statusError{method: "Post", url: url, status: http.StatusText(statusCode), code: statusCode}
+	}
+	return
+}
+
+// remove removes file of hash if it is still of etag.
+func (x *FilerCASIndex) remove(ctx context.Context, hash, etag string) (err error) {
+	path := x.path(hash)
+	ctx, end := x.f.startCall(ctx, OpFilerDelete, path)
+	defer end(&err)
+
+	statusCode, err := x.f.client.delete(ctx, OpFilerDelete, encodeURI(*x.f.base, path, nil), x.precondition(etag))
+	x.f.cache.InvalidatePath(path)
+	x.f.invalidateMemoryCache(path, true)
+
+	if statusCode == http.StatusPreconditionFailed {
+		return errFilerCASConflict
+	}
+	return
+}
+
+// precondition returns header of write conditional on etag of file, on absence of file if etag is empty.
+func (x *FilerCASIndex) precondition(etag string) map[string]string {
+	header := x.f.auth(true)
+	if header == nil {
+		header = make(map[string]string, 1)
+	}
+	if etag == "" {
+		header["If-None-Match"] = "*"
+	} else {
+		header["If-Match"] = etag
+	}
+	return header
+}
+
+func (e *CASEntry) clone() *CASEntry {
+	if e == nil {
+		return nil
+	}
+
+	c := *e
+	c.Chunks = append([]string(nil), e.Chunks...)
+	return &c
+}
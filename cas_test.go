@@ -0,0 +1,224 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testCASIndex(t *testing.T, index CASIndex) {
+	entry, err := index.Get("h")
+	require.Nil(t, err)
+	require.Nil(t, entry)
+
+	entry, err = index.Acquire("h")
+	require.Nil(t, err)
+	require.Nil(t, entry)
+
+	_, err = index.Release("h")
+	require.Equal(t, ErrCASNotFound, err)
+
+	entry, err = index.Add(&CASEntry{Hash: "h", FileID: "3,01", Size: 5, Chunks: []string{"c"}})
+	require.Nil(t, err)
+	require.Equal(t, "3,01", entry.FileID)
+	require.EqualValues(t, 1, entry.Refs)
+
+	// racing add gets existing entry
+	entry, err = index.Add(&CASEntry{Hash: "h", FileID: "3,02", Size: 5})
+	require.Nil(t, err)
+	require.Equal(t, "3,01", entry.FileID)
+	require.EqualValues(t, 2, entry.Refs)
+
+	entry, err = index.Acquire("h")
+	require.Nil(t, err)
+	require.EqualValues(t, 3, entry.Refs)
+
+	entry, err = index.Get("h")
+	require.Nil(t, err)
+	require.Equal(t, &CASEntry{Hash: "h", FileID: "3,01", Size: 5, Refs: 3, Chunks: []string{"c"}}, entry)
+
+	for refs := 2; refs >= 0; refs-- {
+		entry, err = index.Release("h")
+		require.Nil(t, err)
+		require.EqualValues(t, refs, entry.Refs)
+	}
+
+	entry, err = index.Get("h")
+	require.Nil(t, err)
+	require.Nil(t, entry)
+}
+
+func TestCASIndexes(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		testCASIndex(t, NewMemoryCASIndex())
+	})
+
+	t.Run("bolt", func(t *testing.T) {
+		index, err := NewBoltCASIndex(filepath.Join(t.TempDir(), "cas.db"))
+		require.Nil(t, err)
+		defer index.Close()
+
+		testCASIndex(t, index)
+	})
+
+	t.Run("filer", func(t *testing.T) {
+		cluster := newFakeCluster()
+		defer cluster.Close()
+
+		c, err := New(WithMasters(cluster.master.URL), WithFilers(cluster.filer.URL), WithHTTPClient(http.DefaultClient))
+		require.Nil(t, err)
+		defer c.Close()
+
+		index := NewFilerCASIndex(c.Filers()[0], "/cas/")
+		_, err = index.Add(&CASEntry{Hash: "abcd", FileID: "3,01"})
+		require.Nil(t, err)
+		_, ok := cluster.entry("/cas/ab/abcd")
+		require.True(t, ok)
+		_, err = index.Release("abcd")
+		require.Nil(t, err)
+		_, ok = cluster.entry("/cas/ab/abcd")
+		require.False(t, ok)
+
+		testCASIndex(t, index)
+
+		// indexes of separate clients sharing directory count references atomically
+		other, err := NewFiler(cluster.filer.URL, http.DefaultClient)
+		require.Nil(t, err)
+		indexes := []*FilerCASIndex{index, NewFilerCASIndex(other, "/cas")}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(x *FilerCASIndex) {
+				defer wg.Done()
+				_, err := x.Add(&CASEntry{Hash: "shared", FileID: "3,01"})
+				require.Nil(t, err)
+			}(indexes[i%2])
+		}
+		wg.Wait()
+
+		entry, err := index.Get("shared")
+		require.Nil(t, err)
+		require.EqualValues(t, 20, entry.Refs)
+
+		// cipher keys are stored wrapped by key provider of filer
+		key := bytes.Repeat([]byte{7}, cipherKeySize)
+		_, err = index.Add(&CASEntry{Hash: "secret", FileID: "3,02", CipherKey: key})
+		require.Equal(t, ErrNoKeyProvider, err)
+
+		p, err := NewStaticKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+		require.Nil(t, err)
+		c.Filers()[0].SetKeyProvider(p)
+
+		_, err = index.Add(&CASEntry{Hash: "secret", FileID: "3,02", CipherKey: key})
+		require.Nil(t, err)
+		stored, _ := cluster.entry("/cas/se/secret")
+		require.NotContains(t, string(stored), base64.StdEncoding.EncodeToString(key))
+		require.NotContains(t, string(stored), `"cipher_key"`)
+
+		entry, err = index.Get("secret")
+		require.Nil(t, err)
+		require.Equal(t, key, entry.CipherKey)
+	})
+}
+
+func TestCAS(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient))
+	require.Nil(t, err)
+	defer c.Close()
+
+	s := NewCAS(c, NewMemoryCASIndex(), nil)
+
+	sum := sha256.Sum256([]byte("content"))
+	hash := hex.EncodeToString(sum[:])
+
+	entry, deduplicated, err := s.Put(bytes.NewReader([]byte("content")), "a.txt")
+	require.Nil(t, err)
+	require.False(t, deduplicated)
+	require.Equal(t, hash, entry.Hash)
+	require.EqualValues(t, 7, entry.Size)
+	require.Equal(t, 1, cluster.fileCount())
+
+	// content which is not seekable is spooled
+	entry2, deduplicated, err := s.Put(ioutil.NopCloser(strings.NewReader("content")), "b.txt")
+	require.Nil(t, err)
+	require.True(t, deduplicated)
+	require.Equal(t, entry.FileID, entry2.FileID)
+	require.EqualValues(t, 2, entry2.Refs)
+	require.Equal(t, 1, cluster.fileCount())
+
+	var downloaded []byte
+	require.Nil(t, s.Download(hash, func(r io.Reader) (err error) {
+		downloaded, err = ioutil.ReadAll(r)
+		return
+	}))
+	require.Equal(t, "content", string(downloaded))
+
+	// content is deleted with its last reference
+	require.Nil(t, s.Release(hash))
+	_, ok := cluster.file(entry.FileID)
+	require.True(t, ok)
+	require.Nil(t, s.Release(hash))
+	_, ok = cluster.file(entry.FileID)
+	require.False(t, ok)
+
+	_, err = s.Get(hash)
+	require.Equal(t, ErrCASNotFound, err)
+	require.Equal(t, ErrCASNotFound, s.Release(hash))
+	require.Equal(t, ErrCASNotFound, s.Download(hash, func(io.Reader) error { return nil }))
+}
+
+func TestCASDedupChunks(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient), WithChunkSize(256))
+	require.Nil(t, err)
+	defer c.Close()
+
+	s := NewCAS(c, NewMemoryCASIndex(), &CASOptions{DedupChunks: true})
+
+	shared := strings.Repeat("0", 256) + strings.Repeat("a", 256)
+
+	a, _, err := s.Put(strings.NewReader(shared+"KLM"), "a.txt")
+	require.Nil(t, err)
+	require.Len(t, a.Chunks, 3)
+	require.False(t, cluster.isManifest(a.FileID))
+	require.Equal(t, 4, cluster.fileCount())
+
+	// first two chunks are shared
+	b, _, err := s.Put(strings.NewReader(shared+"NOP"), "b.txt")
+	require.Nil(t, err)
+	require.Equal(t, a.Chunks[:2], b.Chunks[:2])
+	require.Equal(t, 6, cluster.fileCount())
+
+	var downloaded []byte
+	require.Nil(t, s.Download(b.Hash, func(r io.Reader) (err error) {
+		downloaded, err = ioutil.ReadAll(r)
+		return
+	}))
+	require.Equal(t, shared+"NOP", string(downloaded))
+
+	// shared chunks stay until both files are released
+	require.Nil(t, s.Release(a.Hash))
+	require.Equal(t, 4, cluster.fileCount())
+	chunk, err := s.Get(a.Chunks[0])
+	require.Nil(t, err)
+	require.EqualValues(t, 1, chunk.Refs)
+
+	require.Nil(t, s.Release(b.Hash))
+	require.Equal(t, 0, cluster.fileCount())
+}
@@ -0,0 +1,216 @@
+package goseaweedfs
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Checksums hex encoded digests of content.
+type Checksums struct {
+	MD5    string `json:"md5,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	CRC32C string `json:"crc32c,omitempty"`
+}
+
+// IsZero checks whether no checksum is set.
+func (s Checksums) IsZero() bool {
+	return s.MD5 == "" && s.SHA256 == "" && s.CRC32C == ""
+}
+
+// ContentMD5 returns MD5 digest encoded for Content-MD5 header, empty if MD5 is not set.
+func (s Checksums) ContentMD5() string {
+	sum, err := hex.DecodeString(s.MD5)
+	if err != nil || len(sum) == 0 {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(sum)
+}
+
+// verify compares checksums set in both expected and actual, failing with *CorruptionError on mismatch.
+func (s Checksums) verify(fileID string, actual Checksums) error {
+	for _, c := range []struct{ algorithm, expected, actual string }{
+		{"sha256", s.SHA256, actual.SHA256},
+		{"md5", s.MD5, actual.MD5},
+		{"crc32c", s.CRC32C, actual.CRC32C},
+	} {
+		if c.expected != "" && c.actual != "" && !strings.EqualFold(c.expected, c.actual) {
+			return &CorruptionError{FileID: fileID, Algorithm: c.algorithm, Expected: c.expected, Actual: c.actual}
+		}
+	}
+	return nil
+}
+
+// CorruptionError content does not match its checksum.
+type CorruptionError struct {
+	FileID    string
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("seaweedfs: content of %s is corrupted, %s mismatch: expected %s, got %s", e.FileID, e.Algorithm, e.Expected, e.Actual)
+}
+
+// SetChecksums enables computing MD5, SHA-256 and CRC32C of uploaded content. Content-MD5 is sent if content is
+// known beforehand (chunks, which are buffered, and seekable readers), otherwise checksums are compared with the ones
+// reported by volume server. Checksums are stored in chunk manifests and FilePart. Chunks of chunked files are read
+// by client on download, verifying them against their checksums in manifest. DownloadTo verifies chunks regardless of
+// setting. Other downloads are verified only if response has Content-MD5 header, which volume servers do not send.
+func (c *Seaweed) SetChecksums(enabled bool) {
+	c.checksums = enabled
+}
+
+// checksummer computes checksums of content written to it.
+type checksummer struct {
+	md5    hash.Hash
+	sha256 hash.Hash
+	crc32c hash.Hash32
+}
+
+func newChecksummer() *checksummer {
+	return &checksummer{md5: md5.New(), sha256: sha256.New(), crc32c: crc32.New(crc32cTable)}
+}
+
+func (h *checksummer) Write(p []byte) (int, error) {
+	_, _ = h.md5.Write(p)
+	_, _ = h.sha256.Write(p)
+	_, _ = h.crc32c.Write(p)
+	return len(p), nil
+}
+
+func (h *checksummer) Sum() Checksums {
+	return Checksums{
+		MD5:    hex.EncodeToString(h.md5.Sum(nil)),
+		SHA256: hex.EncodeToString(h.sha256.Sum(nil)),
+		CRC32C: hex.EncodeToString(h.crc32c.Sum(nil)),
+	}
+}
+
+// checksumsOf computes checksums of data.
+func checksumsOf(data []byte) Checksums {
+	h := newChecksummer()
+	_, _ = h.Write(data)
+	return h.Sum()
+}
+
+// checksumsOfSeeker computes checksums of up to size bytes (all if size <= 0) from current position of r, seeking back after.
+func checksumsOfSeeker(r io.ReadSeeker, size int64) (sums Checksums, err error) {
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return
+	}
+
+	var src io.Reader = r
+	if size > 0 {
+		src = io.LimitReader(r, size)
+	}
+
+	h := newChecksummer()
+	if _, err = io.Copy(h, src); err == nil {
+		if _, err = r.Seek(pos, io.SeekStart); err == nil {
+			sums = h.Sum()
+		}
+	}
+	return
+}
+
+// withContentMD5 returns copy of header with Content-MD5 of checksums if MD5 is set.
+func withContentMD5(header map[string]string, sums Checksums) map[string]string {
+	contentMD5 := sums.ContentMD5()
+	if contentMD5 == "" {
+		return header
+	}
+
+	h := make(map[string]string, len(header)+1)
+	for k, v := range header {
+		h[k] = v
+	}
+	h["Content-MD5"] = contentMD5
+	return h
+}
+
+// reportedChecksums returns checksums of uploaded content reported by volume server. Content-MD5 is digest of
+// uncompressed content, ETag is compared only if it is a MD5 digest since ETag of volume server is CRC32C of stored
+// content, which may be compressed by server.
+func reportedChecksums(result *UploadResult) (sums Checksums) {
+	if sum, err := base64.StdEncoding.DecodeString(result.ContentMD5); err == nil && len(sum) == md5.Size {
+		sums.MD5 = hex.EncodeToString(sum)
+	} else if etag := strings.Trim(result.ETag, `"`); len(etag) == 2*md5.Size {
+		if _, err := hex.DecodeString(etag); err == nil {
+			sums.MD5 = etag
+		}
+	}
+	return
+}
+
+// verifyUpload parses response of uploading content of file id, failing with *CorruptionError if volume server
+// rejects content because of Content-MD5 mismatch or reports checksums other than sums. Zero sums verify nothing.
+func verifyUpload(fileID, fileURL string, body []byte, statusCode int, sums Checksums) (*UploadResult, error) {
+	result, err := parseUploadResult(fileURL, body, statusCode)
+	if sums.IsZero() {
+		return result, err
+	}
+
+	if err != nil {
+		var rejected UploadResult
+		if json.Unmarshal(body, &rejected) == nil && strings.Contains(rejected.Error, "Content-MD5 did not match") {
+			err = &CorruptionError{FileID: fileID, Algorithm: "md5", Expected: sums.MD5, Actual: "other content received by volume server"}
+		}
+		return nil, err
+	}
+
+	if err = sums.verify(fileID, reportedChecksums(result)); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// verifyingReader verifies content read till EOF against expected checksums, returning *CorruptionError instead of EOF on mismatch.
+type verifyingReader struct {
+	r        io.Reader
+	h        *checksummer
+	fileID   string
+	expected Checksums
+}
+
+func newVerifyingReader(r io.Reader, fileID string, expected Checksums) io.Reader {
+	if expected.IsZero() {
+		return r
+	}
+	return &verifyingReader{r: r, h: newChecksummer(), fileID: fileID, expected: expected}
+}
+
+func (r *verifyingReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	_, _ = r.h.Write(p[:n])
+	if err == io.EOF {
+		if e := r.expected.verify(r.fileID, r.h.Sum()); e != nil {
+			err = e
+		}
+	}
+	return
+}
+
+// verifyDownload wraps download callback, verifying whole content read by callback against Content-MD5 header of response if any.
+func verifyDownload(fileID string, callback func(*DownloadResponse, io.Reader) error) func(*DownloadResponse, io.Reader) error {
+	return func(resp *DownloadResponse, r io.Reader) error {
+		if resp.StatusCode == http.StatusOK && resp.Header.Get("Content-Encoding") == "" {
+			if sum, err := base64.StdEncoding.DecodeString(resp.Header.Get("Content-MD5")); err == nil && len(sum) == md5.Size {
+				r = newVerifyingReader(r, fileID, Checksums{MD5: hex.EncodeToString(sum)})
+			}
+		}
+		return callback(resp, r)
+	}
+}
@@ -0,0 +1,97 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChecksumsOf(t *testing.T) {
+	sums := checksumsOf([]byte("hello"))
+	require.Equal(t, "5d41402abc4b2a76b9719d911017c592", sums.MD5)
+	require.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", sums.SHA256)
+	require.Equal(t, "9a71bb4c", sums.CRC32C)
+	require.Equal(t, "XUFAKrxLKna5cZ2REBfFkg==", sums.ContentMD5())
+
+	require.Nil(t, sums.verify("3,01", Checksums{MD5: sums.MD5}))
+	require.Nil(t, sums.verify("3,01", Checksums{}))
+
+	var corruption *CorruptionError
+	require.True(t, errors.As(sums.verify("3,01", Checksums{CRC32C: "00000000"}), &corruption))
+	require.Equal(t, "crc32c", corruption.Algorithm)
+	require.Equal(t, "3,01", corruption.FileID)
+}
+
+func TestUploadDownloadChecksums(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient), WithChunkSize(10), WithChecksums(true))
+	require.Nil(t, err)
+	defer c.Close()
+
+	content := []byte("0123456789abcdefghijklmno")
+
+	// chunked file records checksums of chunks and whole content
+	fp := NewFilePartFromReader(ioutil.NopCloser(bytes.NewReader(content)), "big.bin", int64(len(content)))
+	cm, err := c.UploadFilePart(fp)
+	require.Nil(t, err)
+	require.Equal(t, checksumsOf(content), cm.Checksums)
+	require.Equal(t, cm.Checksums, fp.Checksums)
+	require.Len(t, cm.Chunks, 3)
+	for i, chunk := range cm.Chunks {
+		end := (i + 1) * 10
+		if end > len(content) {
+			end = len(content)
+		}
+		require.Equal(t, checksumsOf(content[i*10:end]), chunk.Checksums)
+	}
+
+	manifest, ok := cluster.file(fp.FileID)
+	require.True(t, ok)
+	require.Contains(t, string(manifest), `"sha256":"`+cm.Chunks[0].SHA256+`"`)
+
+	w := &memWriterAt{buf: make([]byte, len(content))}
+	_, err = c.DownloadTo(fp.FileID, w, nil)
+	require.Nil(t, err)
+	require.Equal(t, content, w.buf)
+
+	// corrupted chunk is detected
+	data, _ := cluster.file(cm.Chunks[1].Fid)
+	cluster.setFile(cm.Chunks[1].Fid, corrupt(data))
+
+	_, err = c.DownloadTo(fp.FileID, &memWriterAt{buf: make([]byte, len(content))}, nil)
+	var corruption *CorruptionError
+	require.True(t, errors.As(err, &corruption), err)
+	require.Equal(t, cm.Chunks[1].Fid, corruption.FileID)
+
+	// chunks of chunked file are read and verified by client on download too
+	_, err = c.Download(fp.FileID, nil, func(r io.Reader) error {
+		_, err := io.Copy(ioutil.Discard, r)
+		return err
+	})
+	corruption = nil
+	require.True(t, errors.As(err, &corruption), err)
+	require.Equal(t, cm.Chunks[1].Fid, corruption.FileID)
+
+	// content corrupted on upload is rejected by volume server with Content-MD5 or detected from reported checksum
+	atomic.StoreInt32(&cluster.corruptUploads, 1)
+
+	fp = NewFilePartFromReader(readSeekCloser{bytes.NewReader([]byte("small"))}, "small.txt", 5)
+	_, err = c.UploadFilePart(fp)
+	require.True(t, errors.As(err, &corruption), err)
+	require.Equal(t, "md5", corruption.Algorithm)
+
+	fp = NewFilePartFromReader(ioutil.NopCloser(bytes.NewReader([]byte("small"))), "small.txt", 5)
+	_, err = c.UploadFilePart(fp)
+	require.True(t, errors.As(err, &corruption), err)
+	require.Equal(t, checksumsOf([]byte("small")).MD5, corruption.Expected)
+
+	atomic.StoreInt32(&cluster.corruptUploads, 0)
+}
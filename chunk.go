@@ -1,7 +1,11 @@
 package goseaweedfs
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/json"
+	"io/ioutil"
+	"sort"
 )
 
 // ChunkInfo chunk information. According to https://github.com/chrislusf/seaweedfs/wiki/Large-File-Handling.
@@ -9,6 +13,19 @@ type ChunkInfo struct {
 	Fid    string `json:"fid"`
 	Offset int64  `json:"offset"`
 	Size   int64  `json:"size"`
+
+	// Checksums of stored chunk content (encrypted if file is encrypted), set if client computes checksums.
+	// Verified when chunk is downloaded.
+	Checksums
+
+	// CipherKey key of chunk encrypted in cipher mode. It is not stored in manifest of chunked file, see SealedKey.
+	CipherKey []byte `json:"cipher_key,omitempty"`
+
+	// SealedKey CipherKey as stored in manifest of chunked file, sealed by key of file.
+	SealedKey []byte `json:"sealed_key,omitempty"`
+
+	// encoding compression of uploaded chunk.
+	encoding string
 }
 
 // ChunkManifest chunk manifest. According to https://github.com/chrislusf/seaweedfs/wiki/Large-File-Handling.
@@ -17,9 +34,61 @@ type ChunkManifest struct {
 	Mime   string       `json:"mime,omitempty"`
 	Size   int64        `json:"size,omitempty"`
 	Chunks []*ChunkInfo `json:"chunks,omitempty"`
+
+	// Checksums of whole content, set if client computes checksums.
+	Checksums
+
+	// Encryption envelope of data key if chunks are encrypted by client. Each chunk is encrypted on its own, so that
+	// chunks can be read independently. Offset and size of chunks are of plain text.
+	Encryption *Envelope `json:"encryption,omitempty"`
 }
 
 // Marshal marshal whole chunk manifest
 func (c *ChunkManifest) Marshal() ([]byte, error) {
 	return json.Marshal(c)
 }
+
+// chunksEncoding returns compression of uploaded chunks unknown to volume server, empty if chunks are not compressed
+// alike by such compression.
+func (c *ChunkManifest) chunksEncoding() (encoding string) {
+	for i, chunk := range c.Chunks {
+		if i == 0 {
+			encoding = chunk.encoding
+		} else if chunk.encoding != encoding {
+			return ""
+		}
+	}
+	if encoding == CompressionGzip {
+		return ""
+	}
+	return
+}
+
+func unzipData(input []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(input))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func loadChunkManifest(buffer []byte, isGzipped bool) (*ChunkManifest, error) {
+	if isGzipped {
+		var err error
+		if buffer, err = unzipData(buffer); err != nil {
+			return nil, err
+		}
+	}
+
+	cm := ChunkManifest{}
+	if e := json.Unmarshal(buffer, &cm); e != nil {
+		return nil, e
+	}
+
+	sort.Slice(cm.Chunks, func(i, j int) bool {
+		return cm.Chunks[i].Offset < cm.Chunks[j].Offset
+	})
+
+	return &cm, nil
+}
@@ -0,0 +1,216 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+const (
+	cipherKeySize   = 32
+	cipherNonceSize = 12
+
+	// defaultCipherChunkSize chunk size of uploads in cipher mode if chunking is disabled. Content is sealed in cipher
+	// mode as a whole, so that it is buffered in memory, at most a chunk of it.
+	defaultCipherChunkSize = 8 << 20
+
+	// headerCipher pair marking content encrypted in cipher mode, so that it is not read without key.
+	headerCipher = "Seaweed-Cipher"
+)
+
+var (
+	// ErrCipherNotEnabled filer stored content without encrypting it, filer must be started with -encryptVolumeData.
+	ErrCipherNotEnabled = errors.New("seaweedfs: filer does not encrypt volume data, start filer with -encryptVolumeData")
+
+	// ErrNoCipherKey content is encrypted in cipher mode but its key is not given.
+	ErrNoCipherKey = errors.New("seaweedfs: content is encrypted in cipher mode but no cipher key is given")
+)
+
+// SetCipher enables cipher mode of SeaweedFS for uploads: content is encrypted by AES-256-GCM with a random key per
+// chunk, so that volume servers store only cipher text. Key of file is returned in FilePart.CipherKey, it is needed
+// to read the file, see DownloadOptions.CipherKey. Keys of chunks are stored in chunk manifest sealed by key of file,
+// chunked files are then read by client chunk by chunk. Files are marked by Seaweed-Cipher pair, reading them without
+// key fails with ErrNoCipherKey. Content encrypted in cipher mode is not compressed. Sets cipher mode of filers too.
+// Content is buffered to be encrypted, files are uploaded by chunks of 8MiB if chunking is disabled.
+func (c *Seaweed) SetCipher(enabled bool) {
+	c.cipher = enabled
+	for _, f := range c.filers {
+		f.SetCipher(enabled)
+	}
+}
+
+// uploadChunkSize returns size of chunks of uploaded files, zero if files are not chunked.
+func (c *Seaweed) uploadChunkSize() int64 {
+	if c.cipher && c.chunkSize <= 0 {
+		return defaultCipherChunkSize
+	}
+	return c.chunkSize
+}
+
+// SetCipher requires uploaded content to be encrypted at rest. Filer encrypts content in cipher mode when started
+// with -encryptVolumeData and keeps keys in its entries, see GetEntry. Uploads verify that stored chunks have cipher
+// keys, otherwise entry is deleted and upload fails with ErrCipherNotEnabled.
+func (f *Filer) SetCipher(enabled bool) {
+	f.cipher = enabled
+}
+
+// cipherEncrypt encrypts data in cipher mode of SeaweedFS with a new random key: nonce is prepended to sealed data.
+func cipherEncrypt(data []byte) (sealed, key []byte, err error) {
+	if key, err = newCipherKey(); err == nil {
+		sealed, err = cipherSeal(data, key)
+	}
+	return
+}
+
+func newCipherKey() (key []byte, err error) {
+	key = make([]byte, cipherKeySize)
+	_, err = rand.Read(key)
+	return
+}
+
+// cipherSeal encrypts data in cipher mode of SeaweedFS with key.
+func cipherSeal(data, key []byte) (sealed []byte, err error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err = rand.Read(nonce); err != nil {
+		return
+	}
+
+	sealed = aead.Seal(nonce, nonce, data, nil)
+	return
+}
+
+// cipherDecrypt decrypts data encrypted in cipher mode of SeaweedFS, failing with ErrDecryption if it is tampered.
+func cipherDecrypt(sealed, key []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, ErrDecryption
+	}
+
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return plain, nil
+}
+
+// cipherSize returns size of plain text of content encrypted in cipher mode.
+func cipherSize(size int64) int64 {
+	if size -= cipherNonceSize + encryptionTagSize; size < 0 {
+		size = 0
+	}
+	return size
+}
+
+// cipherReader decrypts content encrypted in cipher mode of SeaweedFS. Content is read and decrypted as a whole on first read.
+type cipherReader struct {
+	r     io.Reader
+	key   []byte
+	plain io.Reader
+}
+
+func newCipherReader(r io.Reader, key []byte) io.Reader {
+	if len(key) == 0 {
+		return r
+	}
+	return &cipherReader{r: r, key: key}
+}
+
+func (r *cipherReader) Read(p []byte) (int, error) {
+	if r.plain == nil {
+		sealed, err := ioutil.ReadAll(r.r)
+		if err != nil {
+			return 0, err
+		}
+
+		plain, err := cipherDecrypt(sealed, r.key)
+		if err != nil {
+			return 0, err
+		}
+		r.plain = bytes.NewReader(plain)
+	}
+	return r.plain.Read(p)
+}
+
+// cipherHeader returns copy of header with pair marking content encrypted in cipher mode.
+func cipherHeader(header map[string]string) map[string]string {
+	h := make(map[string]string, len(header)+1)
+	for k, v := range header {
+		h[k] = v
+	}
+	h[headerCipher] = "true"
+	return h
+}
+
+// isCiphered checks whether response header marks content encrypted in cipher mode.
+func isCiphered(h http.Header) bool {
+	return h.Get(headerCipher) != ""
+}
+
+// sealKeys returns copy of manifest to be stored, cipher keys of its chunks are replaced by keys sealed by key of file.
+func (c *ChunkManifest) sealKeys(key []byte) (*ChunkManifest, error) {
+	cm := *c
+	cm.Chunks = make([]*ChunkInfo, len(c.Chunks))
+	for i, chunk := range c.Chunks {
+		sealed := *chunk
+		if len(chunk.CipherKey) > 0 {
+			var err error
+			if sealed.SealedKey, err = cipherSeal(chunk.CipherKey, key); err != nil {
+				return nil, err
+			}
+			sealed.CipherKey = nil
+		}
+		cm.Chunks[i] = &sealed
+	}
+	return &cm, nil
+}
+
+// unsealKeys sets cipher keys of chunks from keys sealed by key of file, failing with ErrNoCipherKey if key is not given.
+func (c *ChunkManifest) unsealKeys(key []byte) (err error) {
+	for _, chunk := range c.Chunks {
+		if len(chunk.SealedKey) == 0 {
+			continue
+		}
+		if len(key) == 0 {
+			return ErrNoCipherKey
+		}
+		if chunk.CipherKey, err = cipherDecrypt(chunk.SealedKey, key); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// decipherDownload wraps download callback, decrypting content encrypted in cipher mode with key if not empty.
+// Content marked as encrypted in cipher mode fails with ErrNoCipherKey without key.
+func decipherDownload(key []byte, callback func(*DownloadResponse, io.Reader) error) func(*DownloadResponse, io.Reader) error {
+	if len(key) == 0 {
+		return func(resp *DownloadResponse, r io.Reader) error {
+			if isCiphered(resp.Header) {
+				return ErrNoCipherKey
+			}
+			return callback(resp, r)
+		}
+	}
+
+	return func(resp *DownloadResponse, r io.Reader) error {
+		if resp.StatusCode == http.StatusPartialContent {
+			return errors.New("seaweedfs: ranges of content encrypted in cipher mode are not supported")
+		}
+		if resp.ContentLength >= 0 {
+			resp.ContentLength = cipherSize(resp.ContentLength)
+		}
+		return callback(resp, newCipherReader(r, key))
+	}
+}
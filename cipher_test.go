@@ -0,0 +1,244 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCipherEncryptDecrypt(t *testing.T) {
+	sealed, key, err := cipherEncrypt([]byte("secret"))
+	require.Nil(t, err)
+	require.Len(t, key, cipherKeySize)
+	require.EqualValues(t, 6, cipherSize(int64(len(sealed))))
+
+	plain, err := cipherDecrypt(sealed, key)
+	require.Nil(t, err)
+	require.Equal(t, "secret", string(plain))
+
+	_, err = cipherDecrypt(corrupt(sealed), key)
+	require.Equal(t, ErrDecryption, err)
+	_, err = cipherDecrypt(sealed[:10], key)
+	require.Equal(t, ErrDecryption, err)
+
+	plain, err = ioutil.ReadAll(newCipherReader(bytes.NewReader(sealed), key))
+	require.Nil(t, err)
+	require.Equal(t, "secret", string(plain))
+}
+
+func TestCipherUploadDownload(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient), WithChunkSize(10), WithChecksums(true), WithCipher(true))
+	require.Nil(t, err)
+	defer c.Close()
+
+	// single file, key is returned to caller
+	fp := NewFilePartFromReader(ioutil.NopCloser(bytes.NewReader([]byte("small"))), "small.txt", 5)
+	cm, err := c.UploadFilePart(fp)
+	require.Nil(t, err)
+	require.Nil(t, cm)
+	require.Len(t, fp.CipherKey, cipherKeySize)
+
+	stored, _ := cluster.file(fp.FileID)
+	require.Len(t, stored, 5+cipherNonceSize+encryptionTagSize)
+	require.NotContains(t, string(stored), "small")
+
+	var downloaded []byte
+	resp, err := c.DownloadWithOptions(fp.FileID, nil, &DownloadOptions{CipherKey: fp.CipherKey}, func(_ *DownloadResponse, r io.Reader) (err error) {
+		downloaded, err = ioutil.ReadAll(r)
+		return
+	})
+	require.Nil(t, err)
+	require.EqualValues(t, 5, resp.ContentLength)
+	require.Equal(t, "small", string(downloaded))
+
+	w := &memWriterAt{buf: make([]byte, 5)}
+	size, err := c.DownloadTo(fp.FileID, w, &ParallelDownloadOptions{CipherKey: fp.CipherKey})
+	require.Nil(t, err)
+	require.EqualValues(t, 5, size)
+	require.Equal(t, "small", string(w.buf))
+
+	// content is not read without key
+	_, err = c.Download(fp.FileID, nil, func(r io.Reader) error { return nil })
+	require.Equal(t, ErrNoCipherKey, err)
+	_, err = c.DownloadTo(fp.FileID, &memWriterAt{buf: make([]byte, 5)}, nil)
+	require.Equal(t, ErrNoCipherKey, err)
+
+	// chunked file, keys are stored in manifest sealed by key of file
+	content := "0123456789abcdefghijklmno"
+	fp = NewFilePartFromReader(ioutil.NopCloser(bytes.NewReader([]byte(content))), "big.txt", int64(len(content)))
+	cm, err = c.UploadFilePart(fp)
+	require.Nil(t, err)
+	require.Len(t, cm.Chunks, 3)
+	for _, chunk := range cm.Chunks {
+		require.Len(t, chunk.CipherKey, cipherKeySize)
+		stored, _ := cluster.file(chunk.Fid)
+		require.EqualValues(t, chunk.Size, cipherSize(int64(len(stored))))
+	}
+	require.EqualValues(t, 10, cm.Chunks[0].Size)
+
+	require.Len(t, fp.CipherKey, cipherKeySize)
+
+	manifest, _ := cluster.file(fp.FileID)
+	require.Contains(t, string(manifest), `"sealed_key":"`)
+	for _, chunk := range cm.Chunks {
+		require.NotContains(t, string(manifest), base64.StdEncoding.EncodeToString(chunk.CipherKey))
+	}
+
+	_, err = c.DownloadWithOptions(fp.FileID, nil, &DownloadOptions{CipherKey: fp.CipherKey}, func(_ *DownloadResponse, r io.Reader) (err error) {
+		downloaded, err = ioutil.ReadAll(r)
+		return
+	})
+	require.Nil(t, err)
+	require.Equal(t, content, string(downloaded))
+
+	w = &memWriterAt{buf: make([]byte, len(content))}
+	_, err = c.DownloadTo(fp.FileID, w, &ParallelDownloadOptions{CipherKey: fp.CipherKey})
+	require.Nil(t, err)
+	require.Equal(t, content, string(w.buf))
+
+	// client not in cipher mode can not read content without key either
+	plain, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient))
+	require.Nil(t, err)
+	defer plain.Close()
+
+	_, err = plain.Download(fp.FileID, nil, func(r io.Reader) error { return nil })
+	require.Equal(t, ErrNoCipherKey, err)
+	_, err = plain.DownloadTo(fp.FileID, &memWriterAt{buf: make([]byte, len(content))}, nil)
+	require.Equal(t, ErrNoCipherKey, err)
+}
+
+func TestFilerCipher(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithFilers(cluster.filer.URL), WithHTTPClient(http.DefaultClient), WithCipher(true))
+	require.Nil(t, err)
+	defer c.Close()
+
+	filer := c.Filers()[0]
+
+	// filer not encrypting volume data
+	_, err = filer.Upload(bytes.NewReader([]byte("secret")), 6, "/dir/plain.txt", "", "")
+	require.Equal(t, ErrCipherNotEnabled, err)
+	_, err = filer.GetEntry("/dir/plain.txt")
+	require.Equal(t, ErrFileNotFound, err)
+
+	atomic.StoreInt32(&cluster.filerCipher, 1)
+
+	fp := NewFilePartFromReader(ioutil.NopCloser(bytes.NewReader([]byte("secret"))), "secret.txt", 6)
+	_, err = filer.UploadFilePart(fp, "/dir/", "", "")
+	require.Nil(t, err)
+
+	entry, err := filer.GetEntry("/dir/secret.txt")
+	require.Nil(t, err)
+	require.True(t, entry.IsCipher())
+	require.EqualValues(t, 6, entry.FileSize)
+
+	stored, _ := cluster.file(entry.Chunks[0].FileIDString())
+	require.NotContains(t, string(stored), "secret")
+
+	// read through filer
+	var downloaded []byte
+	err = filer.Download("/dir/secret.txt", nil, func(r io.Reader) (err error) {
+		downloaded, err = ioutil.ReadAll(r)
+		return
+	})
+	require.Nil(t, err)
+	require.Equal(t, "secret", string(downloaded))
+
+	// read chunks from volume servers
+	w := &memWriterAt{buf: make([]byte, 6)}
+	size, err := c.ReadEntry(entry, w, nil)
+	require.Nil(t, err)
+	require.EqualValues(t, 6, size)
+	require.Equal(t, "secret", string(w.buf))
+}
+
+func TestReadEntry(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient))
+	require.Nil(t, err)
+	defer c.Close()
+
+	// compressed chunk encrypted by filer
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, _ = gz.Write([]byte("bbbbbbbbbb"))
+	require.Nil(t, gz.Close())
+
+	sealed, key, err := cipherEncrypt(compressed.Bytes())
+	require.Nil(t, err)
+
+	cluster.setFile("3,01", []byte("aaaaaaaaaa"))
+
+	// newer chunk overwrites older one, content is truncated to file size
+	entry := &FilerEntry{
+		FullPath: "/dir/file",
+		FileSize: 12,
+		Chunks: []*FilerChunk{
+			{Fid: &FilerFileID{VolumeID: 3, FileKey: 2}, Offset: 5, Size: 10, ModifiedTsNs: 2, CipherKey: key, IsCompressed: true},
+			{FileID: "3,01", Offset: 0, Size: 10, ModifiedTsNs: 1},
+		},
+	}
+	require.Equal(t, "3,0200000000", entry.Chunks[0].FileIDString())
+	cluster.setFile("3,0200000000", sealed)
+
+	w := &memWriterAt{buf: make([]byte, 15)}
+	size, err := c.ReadEntry(entry, w, nil)
+	require.Nil(t, err)
+	require.EqualValues(t, 12, size)
+	require.Equal(t, "aaaaabbbbbbb", string(w.buf[:12]))
+	require.Equal(t, []byte{0, 0, 0}, w.buf[12:])
+
+	// content stored inside filer
+	w = &memWriterAt{buf: make([]byte, 5)}
+	size, err = c.ReadEntry(&FilerEntry{Content: []byte("small"), FileSize: 5}, w, nil)
+	require.Nil(t, err)
+	require.EqualValues(t, 5, size)
+	require.Equal(t, "small", string(w.buf))
+
+	_, err = c.ReadEntry(&FilerEntry{Chunks: []*FilerChunk{{FileID: "3,01", IsChunkManifest: true}}}, w, nil)
+	require.NotNil(t, err)
+}
+
+func TestCipherUploadChunking(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient), WithCipher(true))
+	require.Nil(t, err)
+	defer c.Close()
+
+	// files are chunked in cipher mode even if chunking is disabled
+	content := bytes.Repeat([]byte("0123456789"), defaultCipherChunkSize/10+1)
+	fp := NewFilePartFromReader(ioutil.NopCloser(bytes.NewReader(content)), "big.txt", int64(len(content)))
+	cm, err := c.UploadFilePart(fp)
+	require.Nil(t, err)
+	require.NotNil(t, cm)
+	require.Len(t, cm.Chunks, 2)
+
+	var downloaded []byte
+	_, err = c.DownloadWithOptions(fp.FileID, nil, &DownloadOptions{CipherKey: fp.CipherKey}, func(_ *DownloadResponse, r io.Reader) (err error) {
+		downloaded, err = ioutil.ReadAll(r)
+		return
+	})
+	require.Nil(t, err)
+	require.Equal(t, content, downloaded)
+
+	// content is not buffered beyond a chunk
+	fp = NewFilePartFromReader(ioutil.NopCloser(bytes.NewReader(content)), "wrong.txt", 5)
+	_, err = c.UploadFilePart(fp)
+	require.NotNil(t, err)
+}
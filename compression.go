@@ -0,0 +1,352 @@
+package goseaweedfs
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression algorithms of CompressionPolicy. SeaweedFS knows gzip only, which is sent as Content-Encoding of
+// uploaded content. Zstd compressed content is stored as is, its encoding is recorded in Seaweed-Content-Encoding
+// pair of file and content is decompressed by client. Ranges of zstd compressed content are not supported.
+const (
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+// headerContentEncoding pair recording encoding of content compressed unknown to volume server.
+const headerContentEncoding = "Seaweed-Content-Encoding"
+
+const defaultCompressionMinSize = 1 << 10
+
+// defaultCompressibleTypes mime types compressed by default. Entries ending with "/" match whole type,
+// entries starting with "+" match structured syntax suffix.
+var defaultCompressibleTypes = []string{
+	"text/",
+	"+json",
+	"+xml",
+	"application/json",
+	"application/x-ndjson",
+	"application/xml",
+	"application/javascript",
+	"application/x-javascript",
+	"application/ecmascript",
+	"application/yaml",
+	"application/x-yaml",
+	"application/toml",
+	"application/csv",
+	"application/sql",
+	"application/wasm",
+	"application/x-tar",
+	"image/bmp",
+}
+
+// CompressionPolicy decides which uploaded content is compressed by client. Gzip compressed content is uploaded with
+// Content-Encoding, so SeaweedFS stores compressed bytes and decompresses them for clients not accepting the encoding.
+type CompressionPolicy struct {
+	// Algorithm CompressionGzip or CompressionZstd. Empty disables compression.
+	Algorithm string
+
+	// Level of compression, zero uses default level of algorithm.
+	Level int
+
+	// MinSize content smaller than this is not compressed. Default: 1KiB.
+	MinSize int64
+
+	// MimeTypes compressible mime types. Entries ending with "/" match whole type, e.g: "text/",
+	// entries starting with "+" match suffix, e.g: "+json". Default: text, json, xml, javascript and alike.
+	MimeTypes []string
+}
+
+func (p *CompressionPolicy) validate() error {
+	switch p.Algorithm {
+	case "", CompressionGzip, CompressionZstd:
+		return nil
+	}
+	return fmt.Errorf("Unsupported compression algorithm %q", p.Algorithm)
+}
+
+// SetCompression enables compressing uploaded content according to policy, nil disables it. Content encrypted by
+// client is not compressed. Compressed content is decompressed transparently by downloads unless
+// DownloadOptions.RawContent is set. Sets compression policy of filers too.
+func (c *Seaweed) SetCompression(p *CompressionPolicy) (err error) {
+	if p != nil {
+		if err = p.validate(); err != nil {
+			return
+		}
+		cp := *p
+		p = &cp
+	}
+
+	c.compression = p
+	for _, f := range c.filers {
+		f.compression = p
+	}
+	return
+}
+
+// SetCompression enables compressing uploaded content according to policy, nil disables it. Content encrypted by
+// client is not compressed.
+func (f *Filer) SetCompression(p *CompressionPolicy) (err error) {
+	if p != nil {
+		if err = p.validate(); err != nil {
+			return
+		}
+		cp := *p
+		p = &cp
+	}
+
+	f.compression = p
+	return
+}
+
+// encoding returns content encoding of content with mime type (or guessed from file name) and size,
+// empty if content is not compressed.
+func (p *CompressionPolicy) encoding(mtype, filename string, size int64) string {
+	if p == nil || p.Algorithm == "" {
+		return ""
+	}
+
+	minSize := p.MinSize
+	if minSize <= 0 {
+		minSize = defaultCompressionMinSize
+	}
+	if size < minSize {
+		return ""
+	}
+
+	if mtype == "" {
+		mtype = mime.TypeByExtension(strings.ToLower(filepath.Ext(filename)))
+	}
+	if !isCompressible(mtype, p.MimeTypes) {
+		return ""
+	}
+
+	return p.Algorithm
+}
+
+// compress wraps reader in compressing reader if policy compresses content, returning copy of header with Content-Encoding,
+// or with Seaweed-Content-Encoding pair if volume server does not know the encoding. Content-MD5 is not sent then,
+// since volume server would compare it with compressed content.
+func (p *CompressionPolicy) compress(r io.Reader, mtype, filename string, size int64, header map[string]string) (io.Reader, map[string]string, error) {
+	encoding := p.encoding(mtype, filename, size)
+	if encoding == "" {
+		return r, header, nil
+	}
+
+	r, err := newCompressingReader(r, encoding, p.Level)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	h := make(map[string]string, len(header)+1)
+	for k, v := range header {
+		h[k] = v
+	}
+	if encoding == CompressionGzip {
+		h["Content-Encoding"] = encoding
+	} else {
+		h[headerContentEncoding] = encoding
+		delete(h, "Content-MD5")
+	}
+
+	return r, h, nil
+}
+
+// contentEncoding returns compression of content uploaded with header, empty if content is not compressed.
+func contentEncoding(header map[string]string) string {
+	if encoding := header["Content-Encoding"]; encoding != "" {
+		return encoding
+	}
+	return header[headerContentEncoding]
+}
+
+// serverChecksums returns sums if volume server can verify them against content uploaded with header, zero
+// checksums if it only knows checksums of compressed content.
+func serverChecksums(header map[string]string, sums Checksums) Checksums {
+	if header[headerContentEncoding] != "" {
+		return Checksums{}
+	}
+	return sums
+}
+
+func isCompressible(mtype string, types []string) bool {
+	if i := strings.IndexByte(mtype, ';'); i >= 0 {
+		mtype = mtype[:i]
+	}
+	if mtype = strings.ToLower(strings.TrimSpace(mtype)); mtype == "" {
+		return false
+	}
+
+	if types == nil {
+		types = defaultCompressibleTypes
+	}
+
+	for _, t := range types {
+		t = strings.ToLower(t)
+		switch {
+		case strings.HasSuffix(t, "/"):
+			if strings.HasPrefix(mtype, t) {
+				return true
+			}
+		case strings.HasPrefix(t, "+"):
+			if strings.HasSuffix(mtype, t) {
+				return true
+			}
+		case mtype == t:
+			return true
+		}
+	}
+
+	return false
+}
+
+func newCompressor(w io.Writer, encoding string, level int) (io.WriteCloser, error) {
+	switch encoding {
+	case CompressionGzip:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+		return gzip.NewWriterLevel(w, level)
+
+	case CompressionZstd:
+		opts := []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+		return zstd.NewWriter(w, opts...)
+	}
+
+	return nil, fmt.Errorf("Unsupported compression algorithm %q", encoding)
+}
+
+func newDecompressor(r io.Reader, encoding string) (io.ReadCloser, error) {
+	switch encoding {
+	case CompressionGzip:
+		return gzip.NewReader(r)
+
+	case CompressionZstd:
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}
+
+	return nil, fmt.Errorf("Unsupported content encoding %q", encoding)
+}
+
+// newSniffingDecompressor decompresses gzip or zstd content, telling compression by magic number of content.
+func newSniffingDecompressor(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		return newDecompressor(br, CompressionGzip)
+	case bytes.HasPrefix(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return newDecompressor(br, CompressionZstd)
+	}
+	return ioutil.NopCloser(br), nil
+}
+
+// compressingReader compresses content of underlying reader while being read. Compression runs in caller's
+// goroutine, so nothing leaks if reading is abandoned.
+type compressingReader struct {
+	src io.Reader
+	w   io.WriteCloser
+	buf bytes.Buffer
+	in  []byte
+	eof bool
+}
+
+func newCompressingReader(r io.Reader, encoding string, level int) (io.Reader, error) {
+	cr := &compressingReader{src: r, in: make([]byte, 32<<10)}
+
+	w, err := newCompressor(&cr.buf, encoding, level)
+	if err != nil {
+		return nil, err
+	}
+	cr.w = w
+
+	return cr, nil
+}
+
+func (r *compressingReader) Read(p []byte) (int, error) {
+	for r.buf.Len() == 0 && !r.eof {
+		n, err := r.src.Read(r.in)
+		if n > 0 {
+			if _, e := r.w.Write(r.in[:n]); e != nil {
+				return 0, e
+			}
+		}
+
+		if err == io.EOF {
+			r.eof = true
+			if err = r.w.Close(); err != nil {
+				return 0, err
+			}
+		} else if err != nil {
+			return 0, err
+		}
+	}
+
+	return r.buf.Read(p)
+}
+
+// decodeContent decompresses body of whole content response compressed with gzip or zstd, like transport does
+// when it requested compression itself. Encoding recorded in Seaweed-Content-Encoding pair is responded as
+// Content-Encoding, ranges of such content are of compressed content, so they are raw content only.
+func decodeContent(r *http.Response, raw bool) error {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+	if pair := r.Header.Get(headerContentEncoding); encoding == "" && pair != "" {
+		encoding = strings.ToLower(strings.TrimSpace(pair))
+		r.Header.Del(headerContentEncoding)
+		r.Header.Set("Content-Encoding", encoding)
+
+		if !raw && r.StatusCode == http.StatusPartialContent {
+			return fmt.Errorf("seaweedfs: ranges of %s compressed content are not supported", encoding)
+		}
+	}
+
+	if raw || r.StatusCode != http.StatusOK || (encoding != CompressionGzip && encoding != CompressionZstd) {
+		return nil
+	}
+
+	body, err := newDecompressor(r.Body, encoding)
+	if err != nil {
+		return err
+	}
+
+	r.Body = &decodedBody{ReadCloser: body, body: r.Body}
+	r.Header.Del("Content-Encoding")
+	r.Header.Del("Content-Length")
+	r.ContentLength = -1
+	r.Uncompressed = true
+
+	return nil
+}
+
+// decodedBody decompressed response body, closing both decompressor and body.
+type decodedBody struct {
+	io.ReadCloser
+	body io.ReadCloser
+}
+
+func (b *decodedBody) Close() error {
+	_ = b.ReadCloser.Close()
+	return b.body.Close()
+}
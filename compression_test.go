@@ -0,0 +1,168 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompressionPolicy(t *testing.T) {
+	var disabled *CompressionPolicy
+	require.Equal(t, "", disabled.encoding("text/plain", "", 1<<20))
+
+	p := &CompressionPolicy{Algorithm: CompressionZstd}
+	require.Equal(t, CompressionZstd, p.encoding("text/plain", "", 2048))
+	require.Equal(t, CompressionZstd, p.encoding("application/vnd.api+json; charset=utf-8", "", 2048))
+	require.Equal(t, CompressionZstd, p.encoding("", "data.JSON", 2048))
+	require.Equal(t, "", p.encoding("text/plain", "", 100))
+	require.Equal(t, "", p.encoding("image/jpeg", "", 2048))
+	require.Equal(t, "", p.encoding("", "archive.zip", 2048))
+	require.Equal(t, "", p.encoding("", "unknown", 2048))
+
+	p = &CompressionPolicy{Algorithm: CompressionGzip, MinSize: 10, MimeTypes: []string{"application/octet-stream"}}
+	require.Equal(t, CompressionGzip, p.encoding("application/octet-stream", "", 10))
+	require.Equal(t, "", p.encoding("text/plain", "", 10))
+
+	require.NotNil(t, (&CompressionPolicy{Algorithm: "brotli"}).validate())
+	_, err := New(WithMasters("http://localhost:9333"), WithCompression(CompressionPolicy{Algorithm: "brotli"}))
+	require.NotNil(t, err)
+}
+
+func TestCompressingReader(t *testing.T) {
+	content := []byte(strings.Repeat("compressible content ", 10000))
+
+	for _, encoding := range []string{CompressionGzip, CompressionZstd} {
+		for _, level := range []int{0, 1} {
+			r, err := newCompressingReader(bytes.NewReader(content), encoding, level)
+			require.Nil(t, err)
+
+			compressed, err := ioutil.ReadAll(r)
+			require.Nil(t, err)
+			require.Less(t, len(compressed), len(content)/10)
+
+			plain, err := decompress(compressed, encoding)
+			require.Nil(t, err)
+			require.Equal(t, content, plain)
+		}
+	}
+
+	_, err := newCompressingReader(bytes.NewReader(content), "brotli", 0)
+	require.NotNil(t, err)
+}
+
+func TestCompressedUploadDownload(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	content := strings.Repeat("0123456789", 500)
+
+	// volume server knows gzip only, other encodings are recorded in pair of stored content
+	storedEncoding := func(key string) string {
+		if encoding := cluster.encoding(key); encoding != "" {
+			return encoding
+		}
+		return cluster.pair(key, headerContentEncoding)
+	}
+
+	for _, algorithm := range []string{CompressionGzip, CompressionZstd} {
+		c, err := New(WithMasters(cluster.master.URL), WithFilers(cluster.filer.URL), WithHTTPClient(http.DefaultClient),
+			WithChunkSize(2048), WithChecksums(true), WithCompression(CompressionPolicy{Algorithm: algorithm}))
+		require.Nil(t, err)
+
+		// single file
+		fp := NewFilePartFromReader(ioutil.NopCloser(strings.NewReader(content[:2000])), "file.txt", 2000)
+		cm, err := c.UploadFilePart(fp)
+		require.Nil(t, err)
+		require.Nil(t, cm)
+
+		stored, _ := cluster.file(fp.FileID)
+		require.Equal(t, algorithm, storedEncoding(fp.FileID))
+		require.Less(t, len(stored), 2000)
+
+		var downloaded []byte
+		_, err = c.Download(fp.FileID, nil, func(r io.Reader) (err error) {
+			downloaded, err = ioutil.ReadAll(r)
+			return
+		})
+		require.Nil(t, err)
+		require.Equal(t, content[:2000], string(downloaded))
+
+		resp, err := c.DownloadWithOptions(fp.FileID, nil, &DownloadOptions{RawContent: true}, func(_ *DownloadResponse, r io.Reader) (err error) {
+			downloaded, err = ioutil.ReadAll(r)
+			return
+		})
+		require.Nil(t, err)
+		require.Equal(t, algorithm, resp.Header.Get("Content-Encoding"))
+		require.Equal(t, stored, downloaded)
+
+		// volume server decompresses ranges of content it knows compressed only
+		_, err = c.DownloadWithOptions(fp.FileID, nil, &DownloadOptions{Ranges: []ByteRange{{Offset: 10, Length: 5}}}, func(_ *DownloadResponse, r io.Reader) (err error) {
+			downloaded, err = ioutil.ReadAll(r)
+			return
+		})
+		if algorithm == CompressionGzip {
+			require.Nil(t, err)
+			require.Equal(t, content[10:15], string(downloaded))
+		} else {
+			require.NotNil(t, err)
+		}
+
+		w := &memWriterAt{buf: make([]byte, 2000)}
+		_, err = c.DownloadTo(fp.FileID, w, nil)
+		require.Nil(t, err)
+		require.Equal(t, content[:2000], string(w.buf))
+
+		// incompressible content
+		fp = NewFilePartFromReader(ioutil.NopCloser(strings.NewReader(content[:2000])), "image.png", 2000)
+		_, err = c.UploadFilePart(fp)
+		require.Nil(t, err)
+		require.Equal(t, "", storedEncoding(fp.FileID))
+
+		// chunks are compressed, sizes in manifest are of plain content
+		fp = NewFilePartFromReader(ioutil.NopCloser(strings.NewReader(content)), "big.txt", int64(len(content)))
+		cm, err = c.UploadFilePart(fp)
+		require.Nil(t, err)
+		require.Len(t, cm.Chunks, 3)
+		for _, chunk := range cm.Chunks {
+			require.Equal(t, algorithm, storedEncoding(chunk.Fid))
+		}
+		require.EqualValues(t, 2048, cm.Chunks[0].Size)
+
+		w = &memWriterAt{buf: make([]byte, len(content))}
+		size, err := c.DownloadTo(fp.FileID, w, nil)
+		require.Nil(t, err)
+		require.EqualValues(t, len(content), size)
+		require.Equal(t, content, string(w.buf))
+
+		// chunks are read by client or resolved by volume server
+		for _, checksums := range []bool{true, false} {
+			c.SetChecksums(checksums)
+			_, err = c.Download(fp.FileID, nil, func(r io.Reader) (err error) {
+				downloaded, err = ioutil.ReadAll(r)
+				return
+			})
+			require.Nil(t, err)
+			require.Equal(t, content, string(downloaded))
+		}
+		c.SetChecksums(true)
+
+		// filer
+		_, err = c.Filers()[0].Upload(strings.NewReader(content), int64(len(content)), "/dir/"+algorithm+".txt", "", "")
+		require.Nil(t, err)
+		require.Equal(t, algorithm, storedEncoding("/dir/"+algorithm+".txt"))
+
+		err = c.Filers()[0].Download("/dir/"+algorithm+".txt", nil, func(r io.Reader) (err error) {
+			downloaded, err = ioutil.ReadAll(r)
+			return
+		})
+		require.Nil(t, err)
+		require.Equal(t, content, string(downloaded))
+
+		require.Nil(t, c.Close())
+	}
+}
@@ -0,0 +1,339 @@
+package goseaweedfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Environment variables read by LoadConfigFromEnv.
+const (
+	EnvMasters     = "GOSWFS_MASTERS" // comma separated, GOSWFS_MASTER_URL is accepted too
+	EnvFilers      = "GOSWFS_FILERS"  // comma separated, GOSWFS_FILER_URL is accepted too
+	EnvChunkSize   = "GOSWFS_CHUNK_SIZE"
+	EnvTimeout     = "GOSWFS_TIMEOUT" // duration, e.g: 30s
+	EnvRetries     = "GOSWFS_RETRIES"
+	EnvConcurrency = "GOSWFS_CONCURRENCY"
+	EnvHedgeDelay  = "GOSWFS_HEDGE_DELAY"
+	EnvDataCenter  = "GOSWFS_DATA_CENTER"
+	EnvRack        = "GOSWFS_RACK"
+	EnvChecksums   = "GOSWFS_CHECKSUMS"   // bool
+	EnvCompression = "GOSWFS_COMPRESSION" // gzip or zstd
+	EnvCipher      = "GOSWFS_CIPHER"      // bool
+
+	EnvDiskCacheDir  = "GOSWFS_DISK_CACHE_DIR"
+	EnvDiskCacheSize = "GOSWFS_DISK_CACHE_SIZE" // bytes
+
+	EnvMemoryCacheSize = "GOSWFS_MEMORY_CACHE_SIZE" // bytes
+	EnvMemoryCacheTTL  = "GOSWFS_MEMORY_CACHE_TTL"  // duration
+
+	EnvVolumeScheme = "GOSWFS_VOLUME_SCHEME"
+
+	EnvTLSCAFile             = "GOSWFS_TLS_CA_FILE"
+	EnvTLSCertFile           = "GOSWFS_TLS_CERT_FILE"
+	EnvTLSKeyFile            = "GOSWFS_TLS_KEY_FILE"
+	EnvTLSServerName         = "GOSWFS_TLS_SERVER_NAME"
+	EnvTLSInsecureSkipVerify = "GOSWFS_TLS_INSECURE_SKIP_VERIFY"
+
+	EnvJWTWriteKey     = "GOSWFS_JWT_WRITE_KEY"
+	EnvJWTReadKey      = "GOSWFS_JWT_READ_KEY"
+	EnvJWTFilerKey     = "GOSWFS_JWT_FILER_KEY"
+	EnvJWTFilerReadKey = "GOSWFS_JWT_FILER_READ_KEY"
+)
+
+// Config settings of seaweed client, loadable from YAML/TOML file and environment variables. Apply with WithConfig.
+//
+// Nil and empty fields are not set, they keep values of options applied before config. Set fields override them,
+// zero values included, e.g: `checksums: false` turns off checksums enabled by WithChecksums.
+type Config struct {
+	Masters     []string       `yaml:"masters" toml:"masters"`
+	Filers      []string       `yaml:"filers" toml:"filers"`
+	ChunkSize   *int64         `yaml:"chunk_size" toml:"chunk_size"`
+	Timeout     *time.Duration `yaml:"timeout" toml:"timeout"`
+	Retries     *int           `yaml:"retries" toml:"retries"`
+	Concurrency *int           `yaml:"concurrency" toml:"concurrency"`
+	HedgeDelay  *time.Duration `yaml:"hedge_delay" toml:"hedge_delay"`
+
+	DataCenter string `yaml:"data_center" toml:"data_center"`
+	Rack       string `yaml:"rack" toml:"rack"`
+
+	VolumeScheme  string            `yaml:"volume_scheme" toml:"volume_scheme"`
+	VolumeSchemes map[string]string `yaml:"volume_schemes" toml:"volume_schemes"`
+
+	Checksums *bool `yaml:"checksums" toml:"checksums"`
+
+	// Compression algorithm of uploaded content, gzip or zstd. Other settings of compression policy are defaults.
+	Compression string `yaml:"compression" toml:"compression"`
+
+	Cipher *bool `yaml:"cipher" toml:"cipher"`
+
+	// DiskCacheDir directory of disk cache of downloads. DiskCacheSize is its max size in bytes.
+	DiskCacheDir  string `yaml:"disk_cache_dir" toml:"disk_cache_dir"`
+	DiskCacheSize *int64 `yaml:"disk_cache_size" toml:"disk_cache_size"`
+
+	// MemoryCacheSize max size of in-memory cache of small objects in bytes, zero disables it. MemoryCacheTTL is time to live of its objects.
+	MemoryCacheSize *int64         `yaml:"memory_cache_size" toml:"memory_cache_size"`
+	MemoryCacheTTL  *time.Duration `yaml:"memory_cache_ttl" toml:"memory_cache_ttl"`
+
+	TLS *TLSConfig `yaml:"tls" toml:"tls"`
+	JWT *JWTConfig `yaml:"jwt" toml:"jwt"`
+}
+
+// LoadConfigFile loads config from YAML (.yaml, .yml) or TOML (.toml) file.
+func LoadConfigFile(path string) (cfg *Config, err error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	cfg = &Config{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		err = fmt.Errorf("Unsupported config file extension %q", ext)
+	}
+
+	if err != nil {
+		cfg = nil
+	}
+	return
+}
+
+// LoadConfigFromEnv loads config from GOSWFS_* environment variables.
+func LoadConfigFromEnv() (cfg *Config, err error) {
+	cfg = &Config{}
+	if err = cfg.LoadEnv(); err != nil {
+		cfg = nil
+	}
+	return
+}
+
+// LoadEnv overrides config with GOSWFS_* environment variables which are set.
+func (c *Config) LoadEnv() (err error) {
+	if v := firstEnv(EnvMasters, "GOSWFS_MASTER_URL"); v != "" {
+		c.Masters = splitList(v)
+	}
+	if v := firstEnv(EnvFilers, "GOSWFS_FILER_URL"); v != "" {
+		c.Filers = splitList(v)
+	}
+
+	if err = envInt64(EnvChunkSize, &c.ChunkSize); err != nil {
+		return
+	}
+	if err = envDuration(EnvTimeout, &c.Timeout); err != nil {
+		return
+	}
+	if err = envInt(EnvRetries, &c.Retries); err != nil {
+		return
+	}
+	if err = envInt(EnvConcurrency, &c.Concurrency); err != nil {
+		return
+	}
+	if err = envDuration(EnvHedgeDelay, &c.HedgeDelay); err != nil {
+		return
+	}
+
+	envString(EnvDataCenter, &c.DataCenter)
+	envString(EnvRack, &c.Rack)
+	envString(EnvVolumeScheme, &c.VolumeScheme)
+	envString(EnvCompression, &c.Compression)
+	envString(EnvDiskCacheDir, &c.DiskCacheDir)
+	if err = envInt64(EnvDiskCacheSize, &c.DiskCacheSize); err != nil {
+		return
+	}
+	if err = envInt64(EnvMemoryCacheSize, &c.MemoryCacheSize); err != nil {
+		return
+	}
+	if err = envDuration(EnvMemoryCacheTTL, &c.MemoryCacheTTL); err != nil {
+		return
+	}
+
+	if err = envBool(EnvChecksums, &c.Checksums); err != nil {
+		return
+	}
+	if err = envBool(EnvCipher, &c.Cipher); err != nil {
+		return
+	}
+
+	var tlsCfg TLSConfig
+	if c.TLS != nil {
+		tlsCfg = *c.TLS
+	}
+	setTLS := envString(EnvTLSCAFile, &tlsCfg.CAFile)
+	setTLS = envString(EnvTLSCertFile, &tlsCfg.CertFile) || setTLS
+	setTLS = envString(EnvTLSKeyFile, &tlsCfg.KeyFile) || setTLS
+	setTLS = envString(EnvTLSServerName, &tlsCfg.ServerName) || setTLS
+	if v := os.Getenv(EnvTLSInsecureSkipVerify); v != "" {
+		if tlsCfg.InsecureSkipVerify, err = strconv.ParseBool(v); err != nil {
+			return fmt.Errorf("Invalid %s: %v", EnvTLSInsecureSkipVerify, err)
+		}
+		setTLS = true
+	}
+	if setTLS {
+		c.TLS = &tlsCfg
+	}
+
+	var jwtCfg JWTConfig
+	if c.JWT != nil {
+		jwtCfg = *c.JWT
+	}
+	setJWT := envString(EnvJWTWriteKey, &jwtCfg.WriteKey)
+	setJWT = envString(EnvJWTReadKey, &jwtCfg.ReadKey) || setJWT
+	setJWT = envString(EnvJWTFilerKey, &jwtCfg.FilerKey) || setJWT
+	setJWT = envString(EnvJWTFilerReadKey, &jwtCfg.FilerReadKey) || setJWT
+	if setJWT {
+		c.JWT = &jwtCfg
+	}
+
+	return
+}
+
+func (c *Config) apply(s *settings) {
+	if len(c.Masters) > 0 {
+		s.masters = c.Masters
+	}
+	if len(c.Filers) > 0 {
+		s.filers = c.Filers
+	}
+
+	if c.ChunkSize != nil {
+		s.chunkSize = *c.ChunkSize
+	}
+	if c.Timeout != nil {
+		s.timeout = *c.Timeout
+	}
+	if c.Retries != nil {
+		s.retries = *c.Retries
+	}
+	if c.Concurrency != nil {
+		s.concurrency = *c.Concurrency
+	}
+	if c.HedgeDelay != nil {
+		s.readPolicy.HedgeDelay = *c.HedgeDelay
+	}
+	if c.DataCenter != "" || c.Rack != "" {
+		s.locality = Locality{DataCenter: c.DataCenter, Rack: c.Rack}
+	}
+	if c.VolumeScheme != "" || len(c.VolumeSchemes) > 0 {
+		s.volumeScheme, s.volumeSchemes = c.VolumeScheme, c.VolumeSchemes
+	}
+	if c.Checksums != nil {
+		s.checksums = *c.Checksums
+	}
+	if c.Cipher != nil {
+		s.cipher = *c.Cipher
+	}
+	if c.Compression != "" {
+		s.compression = &CompressionPolicy{Algorithm: c.Compression}
+	}
+	if c.DiskCacheDir != "" {
+		s.diskCacheDir = c.DiskCacheDir
+	}
+	if c.DiskCacheSize != nil {
+		s.diskCacheSize = *c.DiskCacheSize
+	}
+	if c.MemoryCacheSize != nil || c.MemoryCacheTTL != nil {
+		var opts MemoryCacheOptions
+		if s.memoryCache != nil {
+			opts = *s.memoryCache
+		}
+		if c.MemoryCacheSize != nil {
+			opts.MaxSize = *c.MemoryCacheSize
+		}
+		if c.MemoryCacheTTL != nil {
+			opts.TTL = *c.MemoryCacheTTL
+		}
+
+		if s.memoryCache = &opts; opts.MaxSize <= 0 {
+			s.memoryCache = nil
+		}
+	}
+	if c.TLS != nil {
+		tlsCfg := *c.TLS
+		s.tls = &tlsCfg
+	}
+	if c.JWT != nil {
+		jwtCfg := *c.JWT
+		s.jwt = &jwtCfg
+	}
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func splitList(s string) (list []string) {
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return
+}
+
+func envString(key string, dst *string) bool {
+	if v := os.Getenv(key); v != "" {
+		*dst = v
+		return true
+	}
+	return false
+}
+
+func envInt(key string, dst **int) error {
+	if v := os.Getenv(key); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return fmt.Errorf("Invalid %s: %v", key, err)
+		}
+		*dst = &n
+	}
+	return nil
+}
+
+func envInt64(key string, dst **int64) error {
+	if v := os.Getenv(key); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid %s: %v", key, err)
+		}
+		*dst = &n
+	}
+	return nil
+}
+
+func envDuration(key string, dst **time.Duration) error {
+	if v := os.Getenv(key); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return fmt.Errorf("Invalid %s: %v", key, err)
+		}
+		*dst = &d
+	}
+	return nil
+}
+
+func envBool(key string, dst **bool) error {
+	if v := os.Getenv(key); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("Invalid %s: %v", key, err)
+		}
+		*dst = &b
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+package goseaweedfs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "goswfs-config")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	yamlPath := filepath.Join(dir, "config.yaml")
+	require.Nil(t, ioutil.WriteFile(yamlPath, []byte(`
+masters: ["http://m1:9333", "http://m2:9333"]
+filers: ["http://f1:8888"]
+chunk_size: 1048576
+timeout: 30s
+retries: 2
+data_center: dc1
+tls:
+  ca_file: /etc/ca.pem
+jwt:
+  write_key: secret
+  expires_after: 1m
+`), 0600))
+
+	tomlPath := filepath.Join(dir, "config.toml")
+	require.Nil(t, ioutil.WriteFile(tomlPath, []byte(`
+masters = ["http://m1:9333", "http://m2:9333"]
+filers = ["http://f1:8888"]
+chunk_size = 1048576
+timeout = "30s"
+retries = 2
+data_center = "dc1"
+
+[tls]
+ca_file = "/etc/ca.pem"
+
+[jwt]
+write_key = "secret"
+expires_after = "1m"
+`), 0600))
+
+	for _, path := range []string{yamlPath, tomlPath} {
+		cfg, err := LoadConfigFile(path)
+		require.Nil(t, err, path)
+		require.Equal(t, []string{"http://m1:9333", "http://m2:9333"}, cfg.Masters)
+		require.Equal(t, []string{"http://f1:8888"}, cfg.Filers)
+		require.EqualValues(t, 1048576, *cfg.ChunkSize)
+		require.Equal(t, 30*time.Second, *cfg.Timeout)
+		require.Equal(t, 2, *cfg.Retries)
+		require.Equal(t, "dc1", cfg.DataCenter)
+		require.Equal(t, "/etc/ca.pem", cfg.TLS.CAFile)
+		require.Equal(t, "secret", cfg.JWT.WriteKey)
+		require.Equal(t, time.Minute, cfg.JWT.ExpiresAfter)
+	}
+
+	_, err = LoadConfigFile(filepath.Join(dir, "config.json"))
+	require.NotNil(t, err)
+}
+
+func TestConfigLoadEnv(t *testing.T) {
+	os.Setenv(EnvMasters, "http://m1:9333, http://m2:9333")
+	os.Setenv(EnvChunkSize, "1024")
+	os.Setenv(EnvJWTReadKey, "read")
+	defer func() {
+		os.Unsetenv(EnvMasters)
+		os.Unsetenv(EnvChunkSize)
+		os.Unsetenv(EnvJWTReadKey)
+	}()
+
+	retries := 3
+	cfg := &Config{Masters: []string{"http://m0:9333"}, Retries: &retries, JWT: &JWTConfig{WriteKey: "write"}}
+	require.Nil(t, cfg.LoadEnv())
+	require.Equal(t, []string{"http://m1:9333", "http://m2:9333"}, cfg.Masters)
+	require.EqualValues(t, 1024, *cfg.ChunkSize)
+	require.Equal(t, 3, *cfg.Retries)
+	require.Nil(t, cfg.Checksums)
+	require.Equal(t, &JWTConfig{WriteKey: "write", ReadKey: "read"}, cfg.JWT)
+
+	os.Setenv(EnvRetries, "many")
+	defer os.Unsetenv(EnvRetries)
+	_, err := LoadConfigFromEnv()
+	require.NotNil(t, err)
+}
+
+func TestNewWithMasterFailover(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"volumeId":"3","locations":[{"url":"v1:8080","publicUrl":"v1:8080"}]}`))
+	}))
+	defer healthy.Close()
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	retries := 1
+	c, err := New(
+		WithConfig(&Config{Masters: []string{down.URL}, Retries: &retries}),
+		WithMasters(healthy.URL),
+		WithConcurrency(8),
+	)
+	require.Nil(t, err)
+	defer c.Close()
+
+	require.Equal(t, 8, c.normalizeParallelDownloadOptions(nil).Concurrency)
+	require.Equal(t, 2, c.readPolicy.MaxAttempts)
+
+	server, err := c.LookupServerByFileID("3,01637037d6", nil, true)
+	require.Nil(t, err)
+	require.Equal(t, "v1:8080", server)
+	require.Equal(t, healthy.URL, c.currentMaster().String())
+
+	_, err = New(WithFilers("http://f1:8888"))
+	require.NotNil(t, err)
+}
+
+func TestMasterGetFailure(t *testing.T) {
+	var requests int32
+	broken := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer broken.Close()
+
+	c, err := New(WithMasters(broken.URL), WithRetries(2))
+	require.Nil(t, err)
+	defer c.Close()
+
+	// 5xx of last attempt is returned as error, retries back off
+	start := time.Now()
+	_, err = c.LookupContext(context.Background(), "3", nil)
+	var se *statusError
+	require.True(t, errors.As(err, &se))
+	require.Equal(t, http.StatusServiceUnavailable, se.code)
+	require.EqualValues(t, 3, atomic.LoadInt32(&requests))
+	require.GreaterOrEqual(t, time.Since(start), masterRetryDelay*3)
+
+	// retries stop once context is done
+	atomic.StoreInt32(&requests, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), masterRetryDelay/2)
+	defer cancel()
+	_, err = c.LookupContext(ctx, "3", nil)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.EqualValues(t, 1, atomic.LoadInt32(&requests))
+}
+
+func TestConfigOverridesZeroValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.Nil(t, ioutil.WriteFile(path, []byte(`
+masters: ["http://m1:9333"]
+retries: 0
+checksums: false
+memory_cache_size: 0
+`), 0600))
+
+	cfg, err := LoadConfigFile(path)
+	require.Nil(t, err)
+	require.Nil(t, cfg.Cipher)
+
+	s := &settings{}
+	for _, opt := range []Option{WithMasters("http://m0:9333"), WithRetries(3), WithChecksums(true), WithCipher(true), WithMemoryCache(MemoryCacheOptions{}), WithConfig(cfg)} {
+		opt(s)
+	}
+	require.Equal(t, []string{"http://m1:9333"}, s.masters)
+	require.Equal(t, 0, s.retries)
+	require.False(t, s.checksums)
+	require.True(t, s.cipher)
+	require.Nil(t, s.memoryCache)
+}
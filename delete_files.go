@@ -0,0 +1,359 @@
+package goseaweedfs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// DeleteStatus outcome of deleting a file.
+type DeleteStatus int
+
+const (
+	// DeleteStatusDeleted file is deleted.
+	DeleteStatusDeleted DeleteStatus = iota
+	// DeleteStatusNotFound file does not exist.
+	DeleteStatusNotFound
+	// DeleteStatusFailed file could not be deleted, see Err of result.
+	DeleteStatusFailed
+)
+
+// String returns name of status.
+func (s DeleteStatus) String() string {
+	switch s {
+	case DeleteStatusDeleted:
+		return "deleted"
+	case DeleteStatusNotFound:
+		return "not found"
+	default:
+		return "failed"
+	}
+}
+
+// ErrManifestKept volume server keeps chunk manifest whose chunks are deleted. Volume server deletes chunks along with
+// manifest, refusing to delete manifest if any of its chunks is not found.
+var ErrManifestKept = errors.New("seaweedfs: volume server keeps chunk manifest whose chunks are deleted")
+
+// DeleteResult result of deleting a file.
+type DeleteResult struct {
+	FileID string
+	Status DeleteStatus
+
+	// Size of deleted file as reported by volume server.
+	Size int64
+
+	Err error
+}
+
+// DeleteResults results of DeleteFiles by file id.
+type DeleteResults map[string]*DeleteResult
+
+// Err returns error of failed file with the smallest file id if any. Files not found are not failures.
+func (r DeleteResults) Err() error {
+	var first *DeleteResult
+	for _, result := range r {
+		if result.Status == DeleteStatusFailed && (first == nil || result.FileID < first.FileID) {
+			first = result
+		}
+	}
+
+	if first == nil {
+		return nil
+	}
+	return fmt.Errorf("Delete %s: %v (%d of %d files failed)", first.FileID, first.Err, r.failed(), len(r))
+}
+
+func (r DeleteResults) failed() (n int) {
+	for _, result := range r {
+		if result.Status == DeleteStatusFailed {
+			n++
+		}
+	}
+	return
+}
+
+// DeleteOptions options for deleting a file.
+type DeleteOptions struct {
+	// Chunks deletes chunks of chunked file by client, reading its manifest, if volume server fails to delete them
+	// along with manifest. Manifest is kept then, *ChunkDeleteError reports chunks left, so that deleting can be
+	// retried. Once all chunks are deleted by client, volume server refuses to delete manifest, since its chunks are
+	// not found, this is reported by error wrapping ErrManifestKept.
+	Chunks bool
+}
+
+// ChunkDeleteError failure of deleting chunks of chunked file. Manifest of file is kept.
+type ChunkDeleteError struct {
+	FileID string
+
+	// Chunks number of chunks of file.
+	Chunks int
+
+	// Failed results of chunks which are not deleted, in order of chunks.
+	Failed []*DeleteResult
+}
+
+func (e *ChunkDeleteError) Error() string {
+	return fmt.Sprintf("Delete chunks of %s: %d of %d chunks not deleted, first %s: %v", e.FileID, len(e.Failed), e.Chunks, e.Failed[0].FileID, e.Failed[0].Err)
+}
+
+// FileIDs returns ids of chunks not deleted.
+func (e *ChunkDeleteError) FileIDs() []string {
+	fids := make([]string, len(e.Failed))
+	for i := range e.Failed {
+		fids[i] = e.Failed[i].FileID
+	}
+	return fids
+}
+
+// DeleteFileWithOptions deletes file by id with options.
+func (c *Seaweed) DeleteFileWithOptions(fileID string, args url.Values, opts *DeleteOptions) (err error) {
+	return c.DeleteFileWithOptionsContext(context.Background(), fileID, args, opts)
+}
+
+// DeleteFileWithOptionsContext is like DeleteFileWithOptions, with context ctx.
+func (c *Seaweed) DeleteFileWithOptionsContext(ctx context.Context, fileID string, args url.Values, opts *DeleteOptions) (err error) {
+	ctx, end := c.startCall(ctx, OpDelete, fileIDAttributes(fileID)...)
+	defer end(&err)
+
+	c.cache.Invalidate(fileID)
+	c.memCache.Invalidate(fileID)
+
+	if opts != nil && opts.Chunks {
+		var cm *ChunkManifest
+		if cm, err = c.chunkManifestOf(ctx, fileID, args); err != nil {
+			return
+		}
+		if cm != nil {
+			var serverErr error
+			if _, serverErr = c.deleteFile(ctx, fileID, args); serverErr == nil {
+				for _, ci := range cm.Chunks {
+					c.cache.Invalidate(ci.Fid)
+					c.memCache.Invalidate(ci.Fid)
+				}
+				return
+			}
+			if err = c.deleteManifestChunks(ctx, fileID, cm, args); err == nil {
+				err = fmt.Errorf("Delete %s: %w: %v", fileID, ErrManifestKept, serverErr)
+			}
+			return
+		}
+	}
+
+	_, err = c.deleteFile(ctx, fileID, args)
+	return
+}
+
+// deleteFile deletes file on volume server, authorized by token issued by master on lookup, or signed by write key.
+// Status of not found file is returned without error.
+func (c *Seaweed) deleteFile(ctx context.Context, fileID string, args url.Values) (statusCode int, err error) {
+	locations, auth, err := c.lookupFileForWrite(ctx, fileID, args)
+	if err == nil {
+		fileURL := c.fileURL(c.selectForWrite(fileID, locations).Head().URL, fileID, nil)
+		statusCode, err = c.client.delete(ctx, OpDelete, fileURL, c.writeAuth(fileID, auth))
+	}
+	return
+}
+
+// chunkManifestOf reads manifest of file if it is chunked. Nil manifest is returned for files which are not chunked or not found.
+func (c *Seaweed) chunkManifestOf(ctx context.Context, fileID string, args url.Values) (cm *ChunkManifest, err error) {
+	locations := newLocationCache(c, args)
+
+	urls, err := locations.urls(ctx, fileID, nil)
+	if err != nil {
+		return
+	}
+
+	auth := (*DownloadOptions)(nil).withHeader(authHeader(c.jwt.readToken(fileID)))
+
+	var head *DownloadResponse
+	for i := range urls {
+		if head, err = c.client.head(ctx, OpHead, urls[i], auth); err == nil {
+			break
+		}
+	}
+
+	var statusErr *statusError
+	switch {
+	case errors.As(err, &statusErr) && statusErr.code == http.StatusNotFound:
+		return nil, nil
+	case err != nil:
+		return
+	case isChunkedFile(head):
+		return c.readChunkManifest(ctx, fileID, locations)
+	default:
+		return nil, nil
+	}
+}
+
+// deleteManifestChunks deletes chunks of manifest, failing with *ChunkDeleteError if any chunk is not deleted.
+func (c *Seaweed) deleteManifestChunks(ctx context.Context, fileID string, cm *ChunkManifest, args url.Values) error {
+	fids := make([]string, len(cm.Chunks))
+	for i, ci := range cm.Chunks {
+		fids[i] = ci.Fid
+	}
+
+	results := c.DeleteFilesContext(ctx, fids, args)
+
+	var failed []*DeleteResult
+	for _, fid := range fids {
+		if result, ok := results[fid]; ok && result.Status == DeleteStatusFailed {
+			failed = append(failed, result)
+			delete(results, fid) // reported once for duplicated chunks
+		}
+	}
+	if len(failed) > 0 {
+		return &ChunkDeleteError{FileID: fileID, Chunks: len(cm.Chunks), Failed: failed}
+	}
+	return nil
+}
+
+// volumeDeleteResult raw result of volume server batch delete.
+// Raw response: [{"fid":"3,01637037d6","size":1024,"status":202,"error":""}]
+type volumeDeleteResult struct {
+	FileID string `json:"fid"`
+	Size   int64  `json:"size"`
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+// DeleteFiles deletes files by ids. Files are grouped by volume, each volume is looked up once and its files are deleted by
+// a single request to batch delete endpoint of volume server. Note that the endpoint is guarded by white list of volume server
+// instead of jwt, and it does not delete chunk manifests, which are reported as failed. If volume server rejects the batch,
+// files of volume are deleted one by one, authorized by jwt.
+// Volumes are processed concurrently, at most client concurrency at the same time.
+func (c *Seaweed) DeleteFiles(fileIDs []string, args url.Values) (results DeleteResults) {
+	return c.DeleteFilesContext(context.Background(), fileIDs, args)
+}
+
+// DeleteFilesContext is like DeleteFiles, with context ctx.
+func (c *Seaweed) DeleteFilesContext(ctx context.Context, fileIDs []string, args url.Values) (results DeleteResults) {
+	var err error
+	ctx, end := c.startCall(ctx, OpDeleteFiles)
+	defer func() {
+		err = results.Err()
+		end(&err)
+	}()
+
+	results = make(DeleteResults, len(fileIDs))
+	volumes := make(map[string][]string)
+	for _, fid := range fileIDs {
+		if _, ok := results[fid]; ok {
+			continue
+		}
+		c.cache.Invalidate(fid)
+		c.memCache.Invalidate(fid)
+
+		result := &DeleteResult{FileID: fid, Status: DeleteStatusFailed}
+		results[fid] = result
+
+		volID, e := parseVolumeID(fid)
+		if e != nil {
+			result.Err = e
+			continue
+		}
+		volumes[volID] = append(volumes[volID], fid)
+	}
+
+	concurrency := c.concurrency
+	if concurrency <= 0 || concurrency > len(volumes) {
+		concurrency = len(volumes)
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for _, fids := range volumes {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(fids []string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			c.deleteVolumeFiles(ctx, fids, args, results)
+		}(fids)
+	}
+	wg.Wait()
+
+	return
+}
+
+// deleteVolumeFiles deletes files of a volume, filling their results. Results of other volumes are not touched.
+func (c *Seaweed) deleteVolumeFiles(ctx context.Context, fids []string, args url.Values, results DeleteResults) {
+	fail := func(err error) {
+		for _, fid := range fids {
+			results[fid].Err = err
+		}
+	}
+
+	locations, err := c.lookupLocations(ctx, fids[0], args)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	form := url.Values{"fid": fids}
+	deleteURL := c.fileURL(c.selectForWrite(fids[0], locations).Head().URL, "/delete", nil)
+
+	body, status, err := c.client.post(ctx, OpDeleteFiles, deleteURL, "application/x-www-form-urlencoded", []byte(form.Encode()), nil)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if status == http.StatusUnauthorized || status == http.StatusForbidden { // client is not in white list
+		c.deleteVolumeFilesOneByOne(ctx, fids, args, results)
+		return
+	}
+	if status >= http.StatusBadRequest {
+		fail(&statusError{method: "Delete", url: deleteURL, status: http.StatusText(status), code: status})
+		return
+	}
+
+	var deleted []volumeDeleteResult
+	if err = json.Unmarshal(body, &deleted); err != nil {
+		fail(fmt.Errorf("Delete %s. Got response but can not parse. Body:%s Code:%d", deleteURL, string(body), status))
+		return
+	}
+
+	for _, d := range deleted {
+		result, ok := results[d.FileID]
+		if !ok {
+			continue
+		}
+
+		switch d.Status {
+		case http.StatusAccepted, http.StatusOK, http.StatusNoContent:
+			result.Status, result.Size = DeleteStatusDeleted, d.Size
+		case http.StatusNotFound:
+			result.Status = DeleteStatusNotFound
+		default:
+			result.Err = fmt.Errorf("Delete %s: %s. Code:%d", d.FileID, d.Error, d.Status)
+		}
+	}
+
+	// volume server stops processing on some failures, remaining files are left untouched
+	for _, fid := range fids {
+		if result := results[fid]; result.Status == DeleteStatusFailed && result.Err == nil {
+			result.Err = fmt.Errorf("Delete %s: not processed by volume server", fid)
+		}
+	}
+}
+
+// deleteVolumeFilesOneByOne deletes files of a volume by a request per file, filling their results.
+func (c *Seaweed) deleteVolumeFilesOneByOne(ctx context.Context, fids []string, args url.Values, results DeleteResults) {
+	for _, fid := range fids {
+		result := results[fid]
+		status, err := c.deleteFile(ctx, fid, args)
+		switch {
+		case err != nil:
+			result.Err = err
+		case status == http.StatusNotFound:
+			result.Status = DeleteStatusNotFound
+		default:
+			result.Status = DeleteStatusDeleted
+		}
+	}
+}
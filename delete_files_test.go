@@ -0,0 +1,135 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeleteFiles(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient))
+	require.Nil(t, err)
+	defer c.Close()
+
+	cluster.setFile("3,01", []byte("first"))
+	cluster.setFile("3,02", []byte("second"))
+	cluster.setFile("4,01", []byte("third"))
+
+	results := c.DeleteFiles([]string{"3,01", "3,02", "3,03", "4,01", "3,01", "invalid"}, nil)
+	require.Len(t, results, 5)
+
+	require.Equal(t, DeleteStatusDeleted, results["3,01"].Status)
+	require.EqualValues(t, 5, results["3,01"].Size)
+	require.Equal(t, DeleteStatusDeleted, results["3,02"].Status)
+	require.Equal(t, DeleteStatusDeleted, results["4,01"].Status)
+	require.Equal(t, DeleteStatusNotFound, results["3,03"].Status)
+	require.Nil(t, results["3,03"].Err)
+	require.Equal(t, DeleteStatusFailed, results["invalid"].Status)
+	require.NotNil(t, results["invalid"].Err)
+	require.NotNil(t, results.Err())
+
+	require.Zero(t, cluster.fileCount())
+	require.EqualValues(t, 2, atomic.LoadInt32(&cluster.lookups))
+
+	// missing chunks are not failures
+	cluster.setFile("3,04", []byte("chunk"))
+	require.Nil(t, c.DeleteChunks(&ChunkManifest{Chunks: []*ChunkInfo{{Fid: "3,04"}, {Fid: "3,05"}}}, nil))
+	require.Zero(t, cluster.fileCount())
+}
+
+func TestDeleteResultsErr(t *testing.T) {
+	results := DeleteResults{"3,01": {FileID: "3,01", Status: DeleteStatusDeleted}}
+	require.Nil(t, results.Err())
+
+	for _, fid := range []string{"5,01", "4,02", "4,01", "6,01"} {
+		results[fid] = &DeleteResult{FileID: fid, Status: DeleteStatusFailed, Err: errors.New("failed " + fid)}
+	}
+	for i := 0; i < 10; i++ {
+		require.EqualError(t, results.Err(), "Delete 4,01: failed 4,01 (4 of 5 files failed)")
+	}
+}
+
+func TestDeleteFilesNotWhiteListed(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient))
+	require.Nil(t, err)
+	defer c.Close()
+
+	cluster.batchDeleteDenied = true
+	cluster.setFile("3,01", []byte("first"))
+	cluster.setFile("4,01", []byte("second"))
+
+	results := c.DeleteFiles([]string{"3,01", "3,02", "4,01"}, nil)
+	require.Nil(t, results.Err())
+	require.Equal(t, DeleteStatusDeleted, results["3,01"].Status)
+	require.Equal(t, DeleteStatusNotFound, results["3,02"].Status)
+	require.Equal(t, DeleteStatusDeleted, results["4,01"].Status)
+	require.Zero(t, cluster.fileCount())
+}
+
+func TestDeleteChunkedFile(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient), WithChunkSize(10))
+	require.Nil(t, err)
+	defer c.Close()
+
+	content := bytes.Repeat([]byte("x"), 25)
+	fp := NewFilePartFromReader(ioutil.NopCloser(bytes.NewReader(content)), "big.bin", int64(len(content)))
+
+	cm, err := c.UploadFilePart(fp)
+	require.Nil(t, err)
+	require.Len(t, cm.Chunks, 3)
+	require.Equal(t, 4, cluster.fileCount())
+
+	// volume server deletes chunks along with manifest
+	require.Nil(t, c.DeleteFileWithOptions(fp.FileID, nil, &DeleteOptions{Chunks: true}))
+	require.Zero(t, cluster.fileCount())
+
+	fp = NewFilePartFromReader(ioutil.NopCloser(bytes.NewReader(content)), "big.bin", int64(len(content)))
+	cm, err = c.UploadFilePart(fp)
+	require.Nil(t, err)
+
+	// failed chunk keeps manifest for retrying
+	cluster.failDelete(cm.Chunks[1].Fid, true)
+
+	err = c.DeleteFileWithOptions(fp.FileID, nil, &DeleteOptions{Chunks: true})
+	var chunkErr *ChunkDeleteError
+	require.True(t, errors.As(err, &chunkErr))
+	require.Equal(t, fp.FileID, chunkErr.FileID)
+	require.Equal(t, 3, chunkErr.Chunks)
+	require.Equal(t, []string{cm.Chunks[1].Fid}, chunkErr.FileIDs())
+
+	_, ok := cluster.file(fp.FileID)
+	require.True(t, ok)
+	require.Equal(t, 2, cluster.fileCount())
+
+	// manifest whose chunks are deleted by client is kept by volume server
+	cluster.failDelete(cm.Chunks[1].Fid, false)
+	err = c.DeleteFileWithOptions(fp.FileID, nil, &DeleteOptions{Chunks: true})
+	require.True(t, errors.Is(err, ErrManifestKept))
+	data, ok := cluster.file(fp.FileID)
+	require.True(t, ok)
+	kept, err := loadChunkManifest(data, false)
+	require.Nil(t, err)
+	require.Len(t, kept.Chunks, 3)
+	require.Equal(t, 1, cluster.fileCount())
+
+	// not found and not chunked files
+	require.Nil(t, c.DeleteFileWithOptions("3,fe", nil, &DeleteOptions{Chunks: true}))
+
+	cluster.setFile("3,ff", []byte("small"))
+	require.Nil(t, c.DeleteFileWithOptions("3,ff", nil, &DeleteOptions{Chunks: true}))
+	require.Equal(t, 1, cluster.fileCount())
+}
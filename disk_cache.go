@@ -0,0 +1,509 @@
+package goseaweedfs
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	diskCacheExt    = ".cache"
+	diskCacheTmpExt = ".tmp"
+
+	// diskCacheMaxMeta limit of metadata of cached file, larger metadata means the file is corrupted.
+	diskCacheMaxMeta = 1 << 20
+)
+
+// DiskCache size-bounded LRU cache of downloaded content on local disk. Content is cached by file id, or by
+// filer path and ETag: cached content of filer path is revalidated with If-None-Match on every download.
+// Content is cached as received from servers, before decryption and checksum verification, which still
+// happen on cache hits. Least recently used content is evicted once total size exceeds max size.
+//
+// Cached files persist across restarts. Directory must be dedicated to a single cache. DiskCache is safe for concurrent use.
+type DiskCache struct {
+	dir     string
+	maxSize int64
+
+	mu    sync.Mutex
+	size  int64
+	lru   *list.List               // of *diskCacheItem, most recently used first
+	items map[string]*list.Element // by key
+	etags map[string]string        // etag of cached content by filer path
+
+	// gen generation of invalidations, content read before an invalidation is not cached.
+	gen uint64
+}
+
+type diskCacheItem struct {
+	file string
+	size int64
+	meta diskCacheMeta
+}
+
+// diskCacheMeta metadata written at head of cached file: 4 bytes of big endian length, followed by JSON.
+type diskCacheMeta struct {
+	Key    string      `json:"key"`
+	Path   string      `json:"path,omitempty"`
+	ETag   string      `json:"etag,omitempty"`
+	Header http.Header `json:"header"`
+}
+
+// NewDiskCache opens cache in dir, creating dir if needed. Content cached by previous runs is kept,
+// as long as it fits max size.
+func NewDiskCache(dir string, maxSize int64) (*DiskCache, error) {
+	if maxSize <= 0 {
+		return nil, errors.New("Disk cache size must be positive")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	d := &DiskCache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		items:   make(map[string]*list.Element),
+		etags:   make(map[string]string),
+	}
+	if err := d.load(); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// load indexes cached files, most recently used first according to their modification time.
+func (d *DiskCache) load() error {
+	files, err := ioutil.ReadDir(d.dir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime().After(files[j].ModTime()) })
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, fi := range files {
+		file := filepath.Join(d.dir, fi.Name())
+		switch {
+		case fi.IsDir():
+		case strings.HasSuffix(fi.Name(), diskCacheTmpExt): // left by interrupted write
+			_ = os.Remove(file)
+		case strings.HasSuffix(fi.Name(), diskCacheExt):
+			meta, err := readDiskCacheMeta(file)
+			if err != nil || d.fileOf(meta.Key) != file {
+				_ = os.Remove(file)
+				continue
+			}
+			d.push(&diskCacheItem{file: file, size: fi.Size(), meta: *meta}, false)
+		}
+	}
+
+	d.evict()
+	return nil
+}
+
+func readDiskCacheMeta(file string) (*diskCacheMeta, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	meta, _, err := readDiskCacheHead(f)
+	return meta, err
+}
+
+func readDiskCacheHead(r io.Reader) (meta *diskCacheMeta, headSize int64, err error) {
+	var n uint32
+	if err = binary.Read(r, binary.BigEndian, &n); err != nil {
+		return
+	}
+	if n > diskCacheMaxMeta {
+		return nil, 0, errors.New("Corrupted disk cache file")
+	}
+
+	data := make([]byte, n)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return
+	}
+
+	meta = &diskCacheMeta{}
+	if err = json.Unmarshal(data, meta); err != nil {
+		return nil, 0, err
+	}
+	return meta, 4 + int64(n), nil
+}
+
+// Len returns number of cached files.
+func (d *DiskCache) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lru.Len()
+}
+
+// Size returns total size of cached files.
+func (d *DiskCache) Size() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.size
+}
+
+// Invalidate removes cached content of file id. Files replaced or deleted through client are invalidated automatically.
+func (d *DiskCache) Invalidate(fileID string) {
+	d.remove(fileIDCacheKey(fileID))
+}
+
+// InvalidatePath removes cached content of filer path and of paths under it.
+func (d *DiskCache) InvalidatePath(path string) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.gen++
+	dir := strings.TrimSuffix(path, "/") + "/"
+	for p, etag := range d.etags {
+		if p == path || strings.HasPrefix(p, dir) {
+			d.removeLocked(filerCacheKey(p, etag))
+		}
+	}
+}
+
+// Purge removes all cached content.
+func (d *DiskCache) Purge() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.gen++
+	for e := d.lru.Front(); e != nil; e = d.lru.Front() {
+		d.drop(e)
+	}
+}
+
+func fileIDCacheKey(fileID string) string {
+	return "fid:" + fileID
+}
+
+func filerCacheKey(path, etag string) string {
+	return "filer:" + path + "\x00" + etag
+}
+
+// pathKey returns key of cached content of filer path, empty if path is not cached.
+func (d *DiskCache) pathKey(path string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	etag, ok := d.etags[path]
+	if !ok {
+		return ""
+	}
+	return filerCacheKey(path, etag)
+}
+
+// fileOf returns path of cached file of key.
+func (d *DiskCache) fileOf(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:])+diskCacheExt)
+}
+
+// diskCacheEntry opened cached content.
+type diskCacheEntry struct {
+	*io.SectionReader
+	f    *os.File
+	meta *diskCacheMeta
+}
+
+func (e *diskCacheEntry) Close() error {
+	return e.f.Close()
+}
+
+// response returns download response of cached content.
+func (e *diskCacheEntry) response() *DownloadResponse {
+	header := e.meta.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return newDownloadResponse(&http.Response{StatusCode: http.StatusOK, Header: header, ContentLength: e.Size()})
+}
+
+// open opens cached content of key, marking it as recently used. Nil if content is not cached.
+func (d *DiskCache) open(key string) *diskCacheEntry {
+	if d == nil || key == "" {
+		return nil
+	}
+
+	d.mu.Lock()
+	e, ok := d.items[key]
+	if ok {
+		d.lru.MoveToFront(e)
+	}
+	d.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	file := e.Value.(*diskCacheItem).file
+	f, err := os.Open(file)
+	if err != nil {
+		d.remove(key)
+		return nil
+	}
+
+	meta, headSize, err := readDiskCacheHead(f)
+	fi, statErr := f.Stat()
+	if err != nil || statErr != nil || meta.Key != key {
+		_ = f.Close()
+		d.remove(key)
+		return nil
+	}
+
+	now := time.Now()
+	_ = os.Chtimes(file, now, now) // keeps recency across restarts
+
+	return &diskCacheEntry{SectionReader: io.NewSectionReader(f, headSize, fi.Size()-headSize), f: f, meta: meta}
+}
+
+// read calls callback with cached content of key, hit tells whether content is cached. Cached content
+// is removed if callback fails, it may be corrupted.
+func (d *DiskCache) read(key string, callback func(*DownloadResponse, io.Reader) error) (resp *DownloadResponse, hit bool, err error) {
+	entry := d.open(key)
+	if entry == nil {
+		return
+	}
+	defer entry.Close()
+
+	resp = entry.response()
+	if err = callback(resp, entry); err != nil {
+		d.remove(key)
+	}
+	return resp, true, err
+}
+
+// fill wraps download callback, so that content it reads completely is cached with metadata returned by metaOf
+// for response. Content is not cached if metadata is nil.
+func (d *DiskCache) fill(metaOf func(*DownloadResponse) *diskCacheMeta, callback func(*DownloadResponse, io.Reader) error) func(*DownloadResponse, io.Reader) error {
+	if d == nil || metaOf == nil {
+		return callback
+	}
+
+	return func(resp *DownloadResponse, r io.Reader) (err error) {
+		if resp.StatusCode != http.StatusOK {
+			return callback(resp, r)
+		}
+
+		meta := metaOf(resp)
+		if meta == nil {
+			return callback(resp, r)
+		}
+		meta.Header = resp.Header
+
+		body := d.tee(meta, r)
+		err = callback(resp, body)
+		body.done(err)
+		return
+	}
+}
+
+func fileIDCacheMeta(fileID string) func(*DownloadResponse) *diskCacheMeta {
+	return func(*DownloadResponse) *diskCacheMeta {
+		return &diskCacheMeta{Key: fileIDCacheKey(fileID)}
+	}
+}
+
+func filerCacheMeta(path string) func(*DownloadResponse) *diskCacheMeta {
+	return func(resp *DownloadResponse) *diskCacheMeta {
+		if resp.ETag == "" {
+			return nil
+		}
+		return &diskCacheMeta{Key: filerCacheKey(path, resp.ETag), Path: path, ETag: resp.ETag}
+	}
+}
+
+// tee returns reader copying content read through it into cache. Content is cached by done,
+// if it was read completely without error. Failures of cache never fail reading.
+func (d *DiskCache) tee(meta *diskCacheMeta, r io.Reader) *cacheFillReader {
+	fr := &cacheFillReader{r: r}
+	if d == nil || meta == nil {
+		return fr
+	}
+
+	head, err := json.Marshal(meta)
+	if err != nil {
+		return fr
+	}
+
+	f, err := ioutil.TempFile(d.dir, "*"+diskCacheTmpExt)
+	if err != nil {
+		return fr
+	}
+
+	d.mu.Lock()
+	fr.gen = d.gen
+	d.mu.Unlock()
+
+	fr.d, fr.f, fr.meta = d, f, meta
+	if err = binary.Write(f, binary.BigEndian, uint32(len(head))); err == nil {
+		_, err = f.Write(head)
+	}
+	if fr.size = 4 + int64(len(head)); err != nil {
+		fr.abort()
+	}
+	return fr
+}
+
+// cacheFillReader copies content read through it into temporary file, which is put into cache by done.
+type cacheFillReader struct {
+	r    io.Reader
+	d    *DiskCache
+	f    *os.File
+	meta *diskCacheMeta
+	size int64
+	gen  uint64
+	eof  bool
+}
+
+func (r *cacheFillReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	if n > 0 && r.f != nil {
+		if r.size += int64(n); r.size > r.d.maxSize {
+			r.abort()
+		} else if _, e := r.f.Write(p[:n]); e != nil {
+			r.abort()
+		}
+	}
+	if err == io.EOF {
+		r.eof = true
+	}
+	return
+}
+
+// done puts content into cache if it was read completely and err is nil, discarding it otherwise.
+func (r *cacheFillReader) done(err error) {
+	if r.f == nil {
+		return
+	}
+	if err != nil || !r.eof {
+		r.abort()
+		return
+	}
+
+	tmp := r.f.Name()
+	if err = r.f.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return
+	}
+
+	r.d.mu.Lock()
+	defer r.d.mu.Unlock()
+
+	if r.gen != r.d.gen { // content may be stale
+		_ = os.Remove(tmp)
+		return
+	}
+
+	file := r.d.fileOf(r.meta.Key)
+	if err = os.Rename(tmp, file); err != nil {
+		_ = os.Remove(tmp)
+		return
+	}
+
+	if e, ok := r.d.items[r.meta.Key]; ok { // replaced by rename
+		r.d.lru.Remove(e)
+		r.d.size -= e.Value.(*diskCacheItem).size
+		delete(r.d.items, r.meta.Key)
+	}
+	if r.meta.Path != "" { // older content of path is stale
+		if etag, ok := r.d.etags[r.meta.Path]; ok && etag != r.meta.ETag {
+			r.d.removeLocked(filerCacheKey(r.meta.Path, etag))
+		}
+	}
+
+	r.d.push(&diskCacheItem{file: file, size: r.size, meta: *r.meta}, true)
+	r.d.evict()
+}
+
+func (r *cacheFillReader) abort() {
+	_ = r.f.Close()
+	_ = os.Remove(r.f.Name())
+	r.f = nil
+}
+
+// push indexes item as most or least recently used.
+func (d *DiskCache) push(item *diskCacheItem, front bool) {
+	if front {
+		d.items[item.meta.Key] = d.lru.PushFront(item)
+	} else {
+		d.items[item.meta.Key] = d.lru.PushBack(item)
+	}
+	d.size += item.size
+
+	if item.meta.Path != "" {
+		d.etags[item.meta.Path] = item.meta.ETag
+	}
+}
+
+// evict removes least recently used items until cache fits its max size.
+func (d *DiskCache) evict() {
+	for d.size > d.maxSize {
+		d.drop(d.lru.Back())
+	}
+}
+
+func (d *DiskCache) remove(key string) {
+	if d == nil {
+		return
+	}
+
+	d.mu.Lock()
+	d.gen++
+	d.removeLocked(key)
+	d.mu.Unlock()
+}
+
+func (d *DiskCache) removeLocked(key string) {
+	if e, ok := d.items[key]; ok {
+		d.drop(e)
+	}
+}
+
+// drop removes item of element from index and disk.
+func (d *DiskCache) drop(e *list.Element) {
+	item := e.Value.(*diskCacheItem)
+
+	d.lru.Remove(e)
+	delete(d.items, item.meta.Key)
+	d.size -= item.size
+	if item.meta.Path != "" && d.etags[item.meta.Path] == item.meta.ETag {
+		delete(d.etags, item.meta.Path)
+	}
+
+	_ = os.Remove(item.file)
+}
+
+// SetDiskCache makes downloads read through disk cache, nil disables caching. Sets disk cache of filers too.
+// Cache may be shared by clients.
+func (c *Seaweed) SetDiskCache(d *DiskCache) {
+	c.cache = d
+	for _, f := range c.filers {
+		f.cache = d
+	}
+}
+
+// SetDiskCache makes downloads read through disk cache, nil disables caching.
+func (f *Filer) SetDiskCache(d *DiskCache) {
+	f.cache = d
+}
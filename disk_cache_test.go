@@ -0,0 +1,251 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func fillDiskCache(d *DiskCache, key, content string) {
+	body := d.tee(&diskCacheMeta{Key: key}, strings.NewReader(content))
+	_, err := ioutil.ReadAll(body)
+	body.done(err)
+}
+
+func readDiskCache(d *DiskCache, key string) (string, bool) {
+	entry := d.open(key)
+	if entry == nil {
+		return "", false
+	}
+	defer entry.Close()
+
+	data, _ := ioutil.ReadAll(entry)
+	return string(data), true
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := NewDiskCache(dir, 0)
+	require.NotNil(t, err)
+
+	d, err := NewDiskCache(dir, 2500)
+	require.Nil(t, err)
+
+	a, b, c := strings.Repeat("a", 1000), strings.Repeat("b", 1000), strings.Repeat("c", 1000)
+	fillDiskCache(d, "a", a)
+	fillDiskCache(d, "b", b)
+	require.Equal(t, 2, d.Len())
+
+	data, ok := readDiskCache(d, "a")
+	require.True(t, ok)
+	require.Equal(t, a, data)
+
+	// least recently used is evicted
+	fillDiskCache(d, "c", c)
+	require.Equal(t, 2, d.Len())
+	require.LessOrEqual(t, d.Size(), int64(2500))
+	_, ok = readDiskCache(d, "b")
+	require.False(t, ok)
+
+	// content larger than cache is not cached
+	fillDiskCache(d, "big", strings.Repeat("x", 3000))
+	_, ok = readDiskCache(d, "big")
+	require.False(t, ok)
+
+	// content not read completely is not cached
+	body := d.tee(&diskCacheMeta{Key: "partial"}, strings.NewReader(b))
+	_, _ = body.Read(make([]byte, 10))
+	body.done(nil)
+	_, ok = readDiskCache(d, "partial")
+	require.False(t, ok)
+
+	// content read before invalidation is not cached
+	body = d.tee(&diskCacheMeta{Key: "stale"}, strings.NewReader(b))
+	d.Invalidate("whatever")
+	_, err = ioutil.ReadAll(body)
+	body.done(err)
+	_, ok = readDiskCache(d, "stale")
+	require.False(t, ok)
+
+	// cached content persists, leftovers of interrupted writes are removed
+	require.Nil(t, ioutil.WriteFile(filepath.Join(dir, "x"+diskCacheTmpExt), []byte("x"), 0600))
+	d, err = NewDiskCache(dir, 2500)
+	require.Nil(t, err)
+	require.Equal(t, 2, d.Len())
+	data, ok = readDiskCache(d, "c")
+	require.True(t, ok)
+	require.Equal(t, c, data)
+
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, files, 2)
+
+	d.Purge()
+	require.Equal(t, 0, d.Len())
+	require.EqualValues(t, 0, d.Size())
+	files, _ = ioutil.ReadDir(dir)
+	require.Len(t, files, 0)
+}
+
+func TestDiskCacheDownload(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient), WithChecksums(true), WithDiskCache(t.TempDir(), 1<<20))
+	require.Nil(t, err)
+	defer c.Close()
+
+	fp, err := c.Upload(bytes.NewReader([]byte("hello")), "hello.txt", 5, "", "")
+	require.Nil(t, err)
+
+	download := func() (content string, err error) {
+		_, err = c.Download(fp.FileID, nil, func(r io.Reader) error {
+			data, err := ioutil.ReadAll(r)
+			content = string(data)
+			return err
+		})
+		return
+	}
+
+	for i := 0; i < 2; i++ {
+		content, err := download()
+		require.Nil(t, err)
+		require.Equal(t, "hello", content)
+		require.EqualValues(t, 1, atomic.LoadInt32(&cluster.volumeReads))
+	}
+
+	// replace invalidates
+	require.Nil(t, c.Replace(fp.FileID, bytes.NewReader([]byte("world")), "hello.txt", 5, "", "", false))
+	content, err := download()
+	require.Nil(t, err)
+	require.Equal(t, "world", content)
+	require.EqualValues(t, 2, atomic.LoadInt32(&cluster.volumeReads))
+
+	// ranges are not cached
+	_, err = c.DownloadWithOptions(fp.FileID, nil, &DownloadOptions{Ranges: []ByteRange{{Offset: 1, Length: 2}}}, func(_ *DownloadResponse, r io.Reader) error {
+		_, err := ioutil.ReadAll(r)
+		return err
+	})
+	require.Nil(t, err)
+	require.EqualValues(t, 3, atomic.LoadInt32(&cluster.volumeReads))
+
+	// delete invalidates
+	require.Equal(t, 1, c.cache.Len())
+	require.Nil(t, c.DeleteFile(fp.FileID, nil))
+	require.Equal(t, 0, c.cache.Len())
+	_, err = download()
+	require.NotNil(t, err)
+}
+
+func TestDiskCacheChunks(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient), WithChunkSize(10), WithCipher(true), WithDiskCache(t.TempDir(), 1<<20))
+	require.Nil(t, err)
+	defer c.Close()
+
+	content := "0123456789abcdefghijklmno"
+	fp := NewFilePartFromReader(ioutil.NopCloser(bytes.NewReader([]byte(content))), "big.txt", int64(len(content)))
+	cm, err := c.UploadFilePart(fp)
+	require.Nil(t, err)
+
+	read := func() {
+		var downloaded []byte
+		_, err := c.DownloadWithOptions(fp.FileID, nil, &DownloadOptions{CipherKey: fp.CipherKey}, func(_ *DownloadResponse, r io.Reader) (err error) {
+			downloaded, err = ioutil.ReadAll(r)
+			return
+		})
+		require.Nil(t, err)
+		require.Equal(t, content, string(downloaded))
+	}
+
+	// chunks are cached by chunk reader, manifest is read each time
+	read()
+	reads := atomic.LoadInt32(&cluster.volumeReads)
+	require.Equal(t, 3, c.cache.Len())
+	read()
+	require.Equal(t, reads+2, atomic.LoadInt32(&cluster.volumeReads))
+
+	// corrupted cached chunk fails decryption and is removed
+	cached := c.cache.fileOf(fileIDCacheKey(cm.Chunks[0].Fid))
+	data, _ := ioutil.ReadFile(cached)
+	data[len(data)-1] ^= 0xff
+	require.Nil(t, ioutil.WriteFile(cached, data, 0600))
+	_, err = c.DownloadWithOptions(fp.FileID, nil, &DownloadOptions{CipherKey: fp.CipherKey}, func(_ *DownloadResponse, r io.Reader) error {
+		_, err := ioutil.ReadAll(r)
+		return err
+	})
+	require.NotNil(t, err)
+	require.Equal(t, 2, c.cache.Len())
+	read()
+
+	// parallel download reads cached chunks too
+	reads = atomic.LoadInt32(&cluster.volumeReads)
+	w := &memWriterAt{buf: make([]byte, len(content))}
+	_, err = c.DownloadTo(fp.FileID, w, &ParallelDownloadOptions{CipherKey: fp.CipherKey})
+	require.Nil(t, err)
+	require.Equal(t, content, string(w.buf))
+	require.True(t, atomic.LoadInt32(&cluster.volumeReads)-reads <= 2)
+
+	// chunks are invalidated when deleted with their manifest
+	require.Nil(t, c.DeleteFileWithOptions(fp.FileID, nil, &DeleteOptions{Chunks: true}))
+	require.Equal(t, 0, c.cache.Len())
+	_, ok := cluster.file(cm.Chunks[0].Fid)
+	require.False(t, ok)
+}
+
+func TestDiskCacheFiler(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	dir := t.TempDir()
+	c, err := New(WithMasters(cluster.master.URL), WithFilers(cluster.filer.URL), WithHTTPClient(http.DefaultClient), WithDiskCache(dir, 1<<20))
+	require.Nil(t, err)
+	defer c.Close()
+
+	filer := c.Filers()[0]
+	other, err := NewFiler(cluster.filer.URL, http.DefaultClient)
+	require.Nil(t, err)
+
+	download := func() string {
+		var downloaded []byte
+		require.Nil(t, filer.Download("/dir/file.txt", nil, func(r io.Reader) (err error) {
+			downloaded, err = ioutil.ReadAll(r)
+			return
+		}))
+		return string(downloaded)
+	}
+
+	_, err = filer.Upload(bytes.NewReader([]byte("first")), 5, "/dir/file.txt", "", "")
+	require.Nil(t, err)
+
+	require.Equal(t, "first", download())
+	require.Equal(t, 1, c.cache.Len())
+
+	// revalidated, served from cache
+	cached := c.cache.fileOf(c.cache.pathKey("/dir/file.txt"))
+	require.Equal(t, "first", download())
+	require.EqualValues(t, 2, atomic.LoadInt32(&cluster.filerReads))
+
+	// modified by another client, new content replaces cached one
+	_, err = other.Upload(bytes.NewReader([]byte("second")), 6, "/dir/file.txt", "", "")
+	require.Nil(t, err)
+	require.Equal(t, "second", download())
+	require.Equal(t, 1, c.cache.Len())
+	_, err = os.Stat(cached)
+	require.True(t, os.IsNotExist(err))
+
+	// delete of directory invalidates paths under it
+	require.Nil(t, filer.Delete("/dir", nil))
+	require.Equal(t, 0, c.cache.Len())
+}
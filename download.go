@@ -0,0 +1,263 @@
+package goseaweedfs
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ByteRange range of bytes to read. Length <= 0 means reading till end of file.
+type ByteRange struct {
+	Offset int64
+	Length int64
+}
+
+func (r ByteRange) String() string {
+	if r.Length <= 0 {
+		return strconv.FormatInt(r.Offset, 10) + "-"
+	}
+	return strconv.FormatInt(r.Offset, 10) + "-" + strconv.FormatInt(r.Offset+r.Length-1, 10)
+}
+
+// DownloadOptions options for reading files from volume/filer servers.
+type DownloadOptions struct {
+	// Ranges byte ranges to read. Multiple ranges are responded as multipart/byteranges, use DownloadResponse.EachRange to read them.
+	// Chunked files whose chunks are read by client (encryption, checksums) support a single range only.
+	Ranges []ByteRange
+
+	// IfNoneMatch etag of cached content. Content is not transferred if it is not modified.
+	IfNoneMatch string
+
+	// IfModifiedSince time of cached content. Content is not transferred if it is not modified since then.
+	IfModifiedSince time.Time
+
+	// Header extra request headers.
+	Header map[string]string
+
+	// Progress receives progress of reading content.
+	Progress ProgressFunc
+
+	// RawContent reads content as stored, compressed content is not decompressed. Content-Encoding of response
+	// header tells its compression. Ranges of raw content are ranges of compressed content.
+	RawContent bool
+
+	// CipherKey key of file encrypted in cipher mode, see FilePart.CipherKey. Ranges of such file are supported only
+	// if it is chunked.
+	CipherKey []byte
+}
+
+// acceptEncoding returns Accept-Encoding requested for reading content, empty if content is requested decompressed
+// by server: ranges are of decompressed content unless raw content is requested.
+func (o *DownloadOptions) acceptEncoding() string {
+	if o == nil || o.RawContent || len(o.Ranges) == 0 {
+		return CompressionGzip + ", " + CompressionZstd
+	}
+	return ""
+}
+
+// wholeContent reports whether options read whole content as is, so that it can be cached.
+func (o *DownloadOptions) wholeContent() bool {
+	return o == nil || (len(o.Ranges) == 0 && o.IfNoneMatch == "" && o.IfModifiedSince.IsZero() && !o.RawContent)
+}
+
+func (o *DownloadOptions) cipherKey() []byte {
+	if o == nil {
+		return nil
+	}
+	return o.CipherKey
+}
+
+func (o *DownloadOptions) rawContent() bool {
+	return o != nil && o.RawContent
+}
+
+func (o *DownloadOptions) progress() ProgressFunc {
+	if o == nil {
+		return nil
+	}
+	return o.Progress
+}
+
+// withHeader returns copy of options with extra headers. Headers set by caller are kept.
+func (o *DownloadOptions) withHeader(header map[string]string) *DownloadOptions {
+	if len(header) == 0 {
+		return o
+	}
+
+	var opts DownloadOptions
+	if o != nil {
+		opts = *o
+	}
+
+	opts.Header = make(map[string]string, len(header)+len(opts.Header))
+	for k, v := range header {
+		opts.Header[k] = v
+	}
+	if o != nil {
+		for k, v := range o.Header {
+			opts.Header[k] = v
+		}
+	}
+
+	return &opts
+}
+
+func (o *DownloadOptions) header() http.Header {
+	h := make(http.Header)
+	if o == nil {
+		return h
+	}
+
+	for k, v := range o.Header {
+		h.Set(k, v)
+	}
+
+	if len(o.Ranges) > 0 {
+		ranges := make([]string, len(o.Ranges))
+		for i := range o.Ranges {
+			ranges[i] = o.Ranges[i].String()
+		}
+		h.Set("Range", "bytes="+strings.Join(ranges, ","))
+	}
+
+	if o.IfNoneMatch != "" {
+		h.Set("If-None-Match", o.IfNoneMatch)
+	}
+
+	if !o.IfModifiedSince.IsZero() {
+		h.Set("If-Modified-Since", o.IfModifiedSince.UTC().Format(http.TimeFormat))
+	}
+
+	return h
+}
+
+// DownloadResponse metadata of download response.
+type DownloadResponse struct {
+	StatusCode    int
+	FileName      string
+	ETag          string
+	ContentLength int64
+	ContentType   string
+	LastModified  time.Time
+
+	// NotModified content is not modified according to conditional options. Body is not transferred.
+	NotModified bool
+
+	// Header raw response header.
+	Header http.Header
+}
+
+func newDownloadResponse(r *http.Response) *DownloadResponse {
+	resp := &DownloadResponse{
+		StatusCode:    r.StatusCode,
+		FileName:      parseFileName(r.Header.Get("Content-Disposition")),
+		ETag:          r.Header.Get("ETag"),
+		ContentLength: r.ContentLength,
+		ContentType:   r.Header.Get("Content-Type"),
+		NotModified:   r.StatusCode == http.StatusNotModified,
+		Header:        r.Header,
+	}
+
+	if lm := r.Header.Get("Last-Modified"); lm != "" {
+		resp.LastModified, _ = http.ParseTime(lm)
+	}
+
+	return resp
+}
+
+// EachRange reads body of ranged response, calling fn for each returned range. Total is size of whole file, -1 if unknown.
+// If server ignored requested ranges and responded whole content, fn is called once with the whole body.
+func (r *DownloadResponse) EachRange(body io.Reader, fn func(rng ByteRange, total int64, part io.Reader) error) error {
+	if r.StatusCode != http.StatusPartialContent {
+		return fn(ByteRange{Length: r.ContentLength}, r.ContentLength, body)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(r.ContentType)
+	if err != nil || mediaType != "multipart/byteranges" {
+		rng, total, err := parseContentRange(r.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		return fn(rng, total, body)
+	}
+
+	mr := multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rng, total, err := parseContentRange(part.Header.Get("Content-Range"))
+		if err == nil {
+			err = fn(rng, total, part)
+		}
+		_ = part.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseContentRange parses header like: "bytes 0-99/1234" or "bytes 0-99/*".
+func parseContentRange(s string) (rng ByteRange, total int64, err error) {
+	total = -1
+
+	if !strings.HasPrefix(s, "bytes ") {
+		err = fmt.Errorf("Invalid Content-Range %q", s)
+		return
+	}
+
+	s = s[len("bytes "):]
+	slash := strings.IndexByte(s, '/')
+	dash := strings.IndexByte(s, '-')
+	if slash < 0 || dash < 0 || dash > slash {
+		err = fmt.Errorf("Invalid Content-Range %q", s)
+		return
+	}
+
+	start, err := strconv.ParseInt(s[:dash], 10, 64)
+	if err != nil {
+		return
+	}
+
+	end, err := strconv.ParseInt(s[dash+1:slash], 10, 64)
+	if err != nil {
+		return
+	}
+
+	if t := s[slash+1:]; t != "*" {
+		if total, err = strconv.ParseInt(t, 10, 64); err != nil {
+			return
+		}
+	}
+
+	rng = ByteRange{Offset: start, Length: end - start + 1}
+	return
+}
+
+func parseFileName(contentDisposition string) (filename string) {
+	if contentDisposition == "" {
+		return
+	}
+
+	if _, params, err := mime.ParseMediaType(contentDisposition); err == nil {
+		return params["filename"]
+	}
+
+	if strings.HasPrefix(contentDisposition, "filename=") {
+		filename = contentDisposition[len("filename="):]
+		filename = strings.Trim(filename, "\"")
+	}
+
+	return
+}
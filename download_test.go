@@ -0,0 +1,86 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadWithOptions(t *testing.T) {
+	content := []byte("0123456789abcdefghijklmnopqrstuvwxyz")
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"abc"`)
+		w.Header().Set("Content-Disposition", `inline; filename="test.txt"`)
+		http.ServeContent(w, r, "test.txt", modTime, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	filer, err := NewFiler(srv.URL, http.DefaultClient)
+	require.Nil(t, err)
+
+	// full read with metadata
+	resp, err := filer.DownloadWithOptions("/test.txt", nil, nil, func(resp *DownloadResponse, r io.Reader) error {
+		data, err := ioutil.ReadAll(r)
+		require.Equal(t, content, data)
+		return err
+	})
+	require.Nil(t, err)
+	require.Equal(t, "test.txt", resp.FileName)
+	require.Equal(t, `"abc"`, resp.ETag)
+	require.EqualValues(t, len(content), resp.ContentLength)
+	require.True(t, modTime.Equal(resp.LastModified))
+
+	// single range
+	_, err = filer.DownloadWithOptions("/test.txt", nil, &DownloadOptions{
+		Ranges: []ByteRange{{Offset: 10, Length: 5}},
+	}, func(resp *DownloadResponse, r io.Reader) error {
+		return resp.EachRange(r, func(rng ByteRange, total int64, part io.Reader) error {
+			data, err := ioutil.ReadAll(part)
+			require.Equal(t, ByteRange{Offset: 10, Length: 5}, rng)
+			require.EqualValues(t, len(content), total)
+			require.Equal(t, "abcde", string(data))
+			return err
+		})
+	})
+	require.Nil(t, err)
+
+	// multi range
+	var parts []string
+	_, err = filer.DownloadWithOptions("/test.txt", nil, &DownloadOptions{
+		Ranges: []ByteRange{{Offset: 0, Length: 2}, {Offset: 34}},
+	}, func(resp *DownloadResponse, r io.Reader) error {
+		return resp.EachRange(r, func(rng ByteRange, total int64, part io.Reader) error {
+			data, err := ioutil.ReadAll(part)
+			parts = append(parts, string(data))
+			return err
+		})
+	})
+	require.Nil(t, err)
+	require.Equal(t, []string{"01", "yz"}, parts)
+
+	// conditional
+	called := false
+	resp, err = filer.DownloadWithOptions("/test.txt", nil, &DownloadOptions{IfNoneMatch: `"abc"`}, func(*DownloadResponse, io.Reader) error {
+		called = true
+		return nil
+	})
+	require.Nil(t, err)
+	require.False(t, called)
+	require.True(t, resp.NotModified)
+
+	resp, err = filer.DownloadWithOptions("/test.txt", nil, &DownloadOptions{IfModifiedSince: modTime}, func(*DownloadResponse, io.Reader) error {
+		called = true
+		return nil
+	})
+	require.Nil(t, err)
+	require.False(t, called)
+	require.True(t, resp.NotModified)
+}
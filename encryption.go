@@ -0,0 +1,495 @@
+package goseaweedfs
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Content encrypted by client is stored as a header (version byte and random nonce prefix) followed by segments of
+// up to encryptionSegmentSize bytes of plain text, each sealed with AES-256-GCM. Nonce of segment is nonce prefix,
+// segment index and a flag marking the last segment, so that segments can not be reordered or truncated. Segments are
+// sealed with additional data of key id of envelope, file id and offset of chunk in chunked file, so that they can not
+// be moved to other files or chunks. Content is streamed without buffering more than a segment.
+const (
+	encryptionVersion     = 1
+	encryptionSegmentSize = 64 << 10
+	encryptionPrefixSize  = 7
+	encryptionHeaderSize  = 1 + encryptionPrefixSize
+	encryptionTagSize     = 16
+
+	// EncryptionAlgorithm algorithm of content encrypted by client.
+	EncryptionAlgorithm = "AES-256-GCM"
+
+	headerEncryptionKeyID = "Seaweed-Encryption-Key-Id"
+	headerEncryptionKey   = "Seaweed-Encryption-Key"
+)
+
+var (
+	// ErrDecryption encrypted content is corrupted or data key is wrong.
+	ErrDecryption = errors.New("seaweedfs: decryption failed, content is corrupted or key is wrong")
+
+	// ErrNoKeyProvider content is encrypted but client has no key provider.
+	ErrNoKeyProvider = errors.New("seaweedfs: content is encrypted but no key provider is set")
+)
+
+// KeyProvider provides key encryption keys for envelope encryption. Each file is encrypted with a random data key,
+// which is stored wrapped by key encryption key along with id of that key, so keys can be rotated.
+// Provider may be backed by a KMS. Implementation must be safe for concurrent use.
+type KeyProvider interface {
+	// WrapKey encrypts data key with current key encryption key, returning id of that key.
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+
+	// UnwrapKey decrypts data key wrapped by key encryption key of id.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) (dataKey []byte, err error)
+}
+
+// StaticKeyProvider key provider holding 32 bytes key encryption keys in memory. Data keys are wrapped with AES-256-GCM
+// by current key. Old keys are kept for unwrapping data keys of files encrypted before rotation.
+type StaticKeyProvider struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewStaticKeyProvider creates key provider wrapping data keys by key of currentKeyID.
+func NewStaticKeyProvider(currentKeyID string, keys map[string][]byte) (p *StaticKeyProvider, err error) {
+	if _, ok := keys[currentKeyID]; !ok {
+		return nil, fmt.Errorf("Key %q is not found", currentKeyID)
+	}
+
+	p = &StaticKeyProvider{current: currentKeyID, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if p.keys[id], err = newAEAD(key); err != nil {
+			return nil, fmt.Errorf("Invalid key %q: %v", id, err)
+		}
+	}
+
+	return
+}
+
+// WrapKey implements KeyProvider.
+func (p *StaticKeyProvider) WrapKey(_ context.Context, dataKey []byte) (keyID string, wrapped []byte, err error) {
+	aead := p.keys[p.current]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err == nil {
+		keyID, wrapped = p.current, aead.Seal(nonce, nonce, dataKey, []byte(p.current))
+	}
+	return
+}
+
+// UnwrapKey implements KeyProvider.
+func (p *StaticKeyProvider) UnwrapKey(_ context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	aead, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("Key %q is not found", keyID)
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, ErrDecryption
+	}
+
+	dataKey, err := aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], []byte(keyID))
+	if err != nil {
+		return nil, ErrDecryption
+	}
+	return dataKey, nil
+}
+
+// Envelope wrapped data key of encrypted content. Stored in ChunkManifest of chunked files and as
+// Seaweed-Encryption-* metadata of other files.
+type Envelope struct {
+	Algorithm  string `json:"alg"`
+	KeyID      string `json:"kid"`
+	WrappedKey []byte `json:"key"`
+}
+
+// contentKey data key of encrypted content of file, along with data binding segments to the file.
+type contentKey struct {
+	aead   cipher.AEAD
+	keyID  string
+	fileID string
+}
+
+// aad returns additional data of segments at offset of file. Offset is of chunk in chunked file, zero otherwise.
+func (k *contentKey) aad(offset int64) []byte {
+	aad := make([]byte, 0, 2*binary.MaxVarintLen64+len(k.keyID)+len(k.fileID)+8)
+	aad = binary.AppendUvarint(aad, uint64(len(k.keyID)))
+	aad = append(aad, k.keyID...)
+	aad = binary.AppendUvarint(aad, uint64(len(k.fileID)))
+	aad = append(aad, k.fileID...)
+	return binary.BigEndian.AppendUint64(aad, uint64(offset))
+}
+
+// newEnvelope generates data key of content of file, wrapped by provider. File id is empty for filer entries.
+func newEnvelope(ctx context.Context, p KeyProvider, fileID string) (env *Envelope, key *contentKey, err error) {
+	dataKey := make([]byte, 32)
+	if _, err = rand.Read(dataKey); err != nil {
+		return
+	}
+
+	env = &Envelope{Algorithm: EncryptionAlgorithm}
+	if env.KeyID, env.WrappedKey, err = p.WrapKey(ctx, dataKey); err != nil {
+		return
+	}
+
+	key = &contentKey{keyID: env.KeyID, fileID: fileID}
+	key.aead, err = newAEAD(dataKey)
+	return
+}
+
+// open unwraps data key of content of file by provider.
+func (e *Envelope) open(ctx context.Context, p KeyProvider, fileID string) (*contentKey, error) {
+	if p == nil {
+		return nil, ErrNoKeyProvider
+	}
+	if e.Algorithm != EncryptionAlgorithm {
+		return nil, fmt.Errorf("Unsupported encryption algorithm %q", e.Algorithm)
+	}
+
+	dataKey, err := p.UnwrapKey(ctx, e.KeyID, e.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &contentKey{aead: aead, keyID: e.KeyID, fileID: fileID}, nil
+}
+
+// header returns metadata headers of envelope, added to header.
+func (e *Envelope) header(header map[string]string) map[string]string {
+	h := make(map[string]string, len(header)+2)
+	for k, v := range header {
+		h[k] = v
+	}
+	h[headerEncryptionKeyID] = e.KeyID
+	h[headerEncryptionKey] = base64.StdEncoding.EncodeToString(e.WrappedKey)
+	return h
+}
+
+// envelopeFromHeader returns envelope stored in metadata headers, nil if content is not encrypted.
+func envelopeFromHeader(h http.Header) *Envelope {
+	keyID, key := h.Get(headerEncryptionKeyID), h.Get(headerEncryptionKey)
+	if keyID == "" || key == "" {
+		return nil
+	}
+
+	wrapped, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil
+	}
+	return &Envelope{Algorithm: EncryptionAlgorithm, KeyID: keyID, WrappedKey: wrapped}
+}
+
+// SetKeyProvider enables client-side envelope encryption of uploaded content with keys of provider, nil disables it.
+// Encrypted content is decrypted transparently by Download, DownloadWithOptions and DownloadTo, chunked files are read chunk by chunk.
+// Ranges of encrypted files, which are not chunked, are not supported. Sets key provider of filers too.
+// Encrypted content is bound to its file id, it can not be read from other file ids.
+func (c *Seaweed) SetKeyProvider(p KeyProvider) {
+	c.keys = p
+	for _, f := range c.filers {
+		f.SetKeyProvider(p)
+	}
+}
+
+// SetKeyProvider enables client-side envelope encryption of uploaded content with keys of provider, nil disables it.
+// Encryption metadata is stored in Seaweed-Encryption-* extended attributes of entry, content is decrypted by Download
+// and DownloadWithOptions, ranges included. Get returns raw content. Content is not bound to path of entry, so that
+// entries can be moved.
+func (f *Filer) SetKeyProvider(p KeyProvider) {
+	f.keys = p
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("Key must be 32 bytes, got %d", len(key))
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptedSize returns size of content of plain text size once encrypted.
+func encryptedSize(size int64) int64 {
+	segments := size / encryptionSegmentSize
+	if size%encryptionSegmentSize != 0 || size == 0 {
+		segments++
+	}
+	return encryptionHeaderSize + size + segments*encryptionTagSize
+}
+
+// plainSize returns size of plain text of encrypted content of size, -1 if size is invalid.
+func plainSize(size int64) int64 {
+	size -= encryptionHeaderSize
+	if size < encryptionTagSize {
+		return -1
+	}
+
+	segments := size / (encryptionSegmentSize + encryptionTagSize)
+	if size%(encryptionSegmentSize+encryptionTagSize) != 0 {
+		segments++
+	}
+	return size - segments*encryptionTagSize
+}
+
+func segmentNonce(nonce []byte, prefix []byte, segment uint32, last bool) []byte {
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[encryptionPrefixSize:], segment)
+	nonce[len(nonce)-1] = 0
+	if last {
+		nonce[len(nonce)-1] = 1
+	}
+	return nonce
+}
+
+// encryptingReader encrypts plain text read from source.
+type encryptingReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	aad     []byte
+	prefix  []byte
+	nonce   []byte
+	segment uint32
+
+	plain []byte
+	out   []byte
+	buf   []byte
+	err   error
+}
+
+// newEncryptingReader encrypts content of r at offset of file by key, see contentKey.aad.
+func newEncryptingReader(r io.Reader, key *contentKey, offset int64) (io.Reader, error) {
+	header := make([]byte, encryptionHeaderSize)
+	header[0] = encryptionVersion
+	if _, err := rand.Read(header[1:]); err != nil {
+		return nil, err
+	}
+
+	return &encryptingReader{
+		src:    bufio.NewReaderSize(r, encryptionSegmentSize),
+		aead:   key.aead,
+		aad:    key.aad(offset),
+		prefix: header[1:],
+		nonce:  make([]byte, key.aead.NonceSize()),
+		plain:  make([]byte, encryptionSegmentSize),
+		buf:    make([]byte, 0, encryptionSegmentSize+encryptionTagSize),
+		out:    header,
+	}, nil
+}
+
+func (e *encryptingReader) Read(p []byte) (int, error) {
+	for len(e.out) == 0 {
+		if e.err != nil {
+			return 0, e.err
+		}
+
+		n, err := io.ReadFull(e.src, e.plain)
+		last := false
+		switch err {
+		case nil:
+			if _, err = e.src.Peek(1); err == io.EOF {
+				last = true
+			} else if err != nil {
+				return 0, err
+			}
+		case io.EOF, io.ErrUnexpectedEOF:
+			last = true
+		default:
+			return 0, err
+		}
+
+		e.out = e.aead.Seal(e.buf[:0], segmentNonce(e.nonce, e.prefix, e.segment, last), e.plain[:n], e.aad)
+		e.segment++
+		if last {
+			e.err = io.EOF
+		}
+	}
+
+	n := copy(p, e.out)
+	e.out = e.out[n:]
+	return n, nil
+}
+
+// decryptingReader decrypts content read from source, failing with ErrDecryption if content is corrupted or truncated.
+type decryptingReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	aad     []byte
+	prefix  []byte
+	nonce   []byte
+	segment uint32
+
+	sealed []byte
+	out    []byte
+	buf    []byte
+	err    error
+
+	// ranged segments are read up to end of a range, last segment of content is known beforehand.
+	ranged      bool
+	lastSegment uint32
+}
+
+// newDecryptingReader decrypts content of r at offset of file by key, see contentKey.aad.
+func newDecryptingReader(r io.Reader, key *contentKey, offset int64) io.Reader {
+	return &decryptingReader{
+		src:    bufio.NewReaderSize(r, encryptionSegmentSize+encryptionTagSize),
+		aead:   key.aead,
+		aad:    key.aad(offset),
+		nonce:  make([]byte, key.aead.NonceSize()),
+		sealed: make([]byte, encryptionSegmentSize+encryptionTagSize),
+		buf:    make([]byte, 0, encryptionSegmentSize),
+	}
+}
+
+// newSegmentDecryptingReader decrypts sealed segments read from r, starting with segment first of content at offset
+// of file with header and segments up to last. Reading ends at end of r, which needs not to be the end of content.
+func newSegmentDecryptingReader(r io.Reader, key *contentKey, offset int64, header []byte, first, last uint32) (io.Reader, error) {
+	if header[0] != encryptionVersion {
+		return nil, fmt.Errorf("Unsupported encryption version %d", header[0])
+	}
+
+	d := newDecryptingReader(r, key, offset).(*decryptingReader)
+	d.prefix, d.segment = header[1:], first
+	d.ranged, d.lastSegment = true, last
+	return d, nil
+}
+
+// segmentRange returns range of sealed segments of encrypted content holding plain text range [lo, hi) of content
+// with plain text size, along with index of first and last segment of content and offset of lo in first segment.
+func segmentRange(lo, hi, size int64) (sealed ByteRange, first, last uint32, skip int64) {
+	const sealedSize = encryptionSegmentSize + encryptionTagSize
+
+	first = uint32(lo / encryptionSegmentSize)
+	end := (hi + encryptionSegmentSize - 1) / encryptionSegmentSize
+	if last = uint32((size - 1) / encryptionSegmentSize); size == 0 {
+		last = 0
+	}
+
+	sealed.Offset = encryptionHeaderSize + int64(first)*sealedSize
+	sealed.Length = encryptedSize(size) - sealed.Offset
+	if n := (end - int64(first)) * sealedSize; n < sealed.Length {
+		sealed.Length = n
+	}
+	return sealed, first, last, lo - int64(first)*encryptionSegmentSize
+}
+
+func (d *decryptingReader) Read(p []byte) (int, error) {
+	for len(d.out) == 0 {
+		if d.err != nil {
+			return 0, d.err
+		}
+		d.err = d.next()
+	}
+
+	n := copy(p, d.out)
+	d.out = d.out[n:]
+	return n, nil
+}
+
+// next decrypts next segment. Returns io.EOF after the last one.
+func (d *decryptingReader) next() error {
+	if d.prefix == nil {
+		header := make([]byte, encryptionHeaderSize)
+		if _, err := io.ReadFull(d.src, header); err != nil {
+			return truncated(err)
+		}
+		if header[0] != encryptionVersion {
+			return fmt.Errorf("Unsupported encryption version %d", header[0])
+		}
+		d.prefix = header[1:]
+	}
+
+	n, err := io.ReadFull(d.src, d.sealed)
+	if d.ranged {
+		switch err {
+		case nil, io.ErrUnexpectedEOF:
+			return d.open(n, d.segment == d.lastSegment)
+		default:
+			return err
+		}
+	}
+
+	last := false
+	switch err {
+	case nil:
+		if _, err = d.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	case io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return truncated(err)
+	}
+
+	return d.open(n, last)
+}
+
+// open decrypts sealed segment of n bytes. Returns io.EOF after the last one.
+func (d *decryptingReader) open(n int, last bool) (err error) {
+	if d.out, err = d.aead.Open(d.buf[:0], segmentNonce(d.nonce, d.prefix, d.segment, last), d.sealed[:n], d.aad); err != nil {
+		return ErrDecryption
+	}
+	d.segment++
+
+	if last {
+		return io.EOF
+	}
+	return nil
+}
+
+// truncated maps EOF before the last segment to ErrDecryption.
+func truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrDecryption
+	}
+	return err
+}
+
+// encryptedRangeError range of encrypted content is responded, which can not be decrypted as is.
+type encryptedRangeError struct {
+	resp *DownloadResponse
+	env  *Envelope
+}
+
+func (e *encryptedRangeError) Error() string {
+	return "seaweedfs: ranges of encrypted content are not supported"
+}
+
+// decryptDownload wraps download callback, decrypting content of file which has encryption metadata. Fails with
+// ErrNoKeyProvider if provider is nil, and with *encryptedRangeError if range of encrypted content is responded.
+func decryptDownload(ctx context.Context, p KeyProvider, fileID string, callback func(*DownloadResponse, io.Reader) error) func(*DownloadResponse, io.Reader) error {
+	return func(resp *DownloadResponse, r io.Reader) error {
+		env := envelopeFromHeader(resp.Header)
+		if env == nil {
+			return callback(resp, r)
+		}
+		if resp.StatusCode == http.StatusPartialContent {
+			return &encryptedRangeError{resp: resp, env: env}
+		}
+
+		key, err := env.open(ctx, p, fileID)
+		if err != nil {
+			return err
+		}
+
+		if resp.ContentLength >= 0 {
+			resp.ContentLength = plainSize(resp.ContentLength)
+		}
+		return callback(resp, newDecryptingReader(r, key, 0))
+	}
+}
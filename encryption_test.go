@@ -0,0 +1,300 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestKeyProvider(t *testing.T) *StaticKeyProvider {
+	p, err := NewStaticKeyProvider("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	require.Nil(t, err)
+	return p
+}
+
+func encryptAll(t *testing.T, plain []byte, p KeyProvider) (*Envelope, []byte) {
+	env, key, err := newEnvelope(context.Background(), p, "3,01")
+	require.Nil(t, err)
+
+	r, err := newEncryptingReader(bytes.NewReader(plain), key, 0)
+	require.Nil(t, err)
+
+	sealed, err := ioutil.ReadAll(r)
+	require.Nil(t, err)
+	return env, sealed
+}
+
+func decryptAll(env *Envelope, sealed []byte, p KeyProvider) ([]byte, error) {
+	return decryptAt(env, sealed, p, "3,01", 0)
+}
+
+func decryptAt(env *Envelope, sealed []byte, p KeyProvider, fileID string, offset int64) ([]byte, error) {
+	key, err := env.open(context.Background(), p, fileID)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadAll(newDecryptingReader(bytes.NewReader(sealed), key, offset))
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	p := newTestKeyProvider(t)
+
+	for _, size := range []int{0, 1, encryptionSegmentSize - 1, encryptionSegmentSize, encryptionSegmentSize + 1, 3*encryptionSegmentSize + 5} {
+		plain := make([]byte, size)
+		_, _ = rand.Read(plain)
+
+		env, sealed := encryptAll(t, plain, p)
+		require.EqualValues(t, encryptedSize(int64(size)), len(sealed), size)
+		require.EqualValues(t, size, plainSize(int64(len(sealed))), size)
+
+		decrypted, err := decryptAll(env, sealed, p)
+		require.Nil(t, err, size)
+		require.Equal(t, plain, decrypted, size)
+
+		// tampered content
+		tampered := append([]byte(nil), sealed...)
+		tampered[len(tampered)-1] ^= 1
+		_, err = decryptAll(env, tampered, p)
+		require.Equal(t, ErrDecryption, err, size)
+
+		// truncated content, also at segment boundary
+		_, err = decryptAll(env, sealed[:len(sealed)-1], p)
+		require.Equal(t, ErrDecryption, err, size)
+		if size > encryptionSegmentSize {
+			_, err = decryptAll(env, sealed[:encryptionHeaderSize+encryptionSegmentSize+encryptionTagSize], p)
+			require.Equal(t, ErrDecryption, err, size)
+		}
+
+		// content is bound to its file id and offset
+		_, err = decryptAt(env, sealed, p, "3,02", 0)
+		require.Equal(t, ErrDecryption, err, size)
+		_, err = decryptAt(env, sealed, p, "3,01", encryptionSegmentSize)
+		require.Equal(t, ErrDecryption, err, size)
+	}
+}
+
+func TestStaticKeyProvider(t *testing.T) {
+	_, err := NewStaticKeyProvider("k1", map[string][]byte{"k1": []byte("short")})
+	require.NotNil(t, err)
+	_, err = NewStaticKeyProvider("k2", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	require.NotNil(t, err)
+
+	old := newTestKeyProvider(t)
+	env, sealed := encryptAll(t, []byte("secret"), old)
+	require.Equal(t, "k1", env.KeyID)
+
+	// rotated provider still reads content encrypted with old key
+	rotated, err := NewStaticKeyProvider("k2", map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 32),
+	})
+	require.Nil(t, err)
+
+	plain, err := decryptAll(env, sealed, rotated)
+	require.Nil(t, err)
+	require.Equal(t, "secret", string(plain))
+
+	env, _ = encryptAll(t, []byte("secret"), rotated)
+	require.Equal(t, "k2", env.KeyID)
+	_, err = env.open(context.Background(), old, "")
+	require.NotNil(t, err)
+
+	_, err = env.open(context.Background(), nil, "")
+	require.Equal(t, ErrNoKeyProvider, err)
+}
+
+func TestEncryptedUploadDownload(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithFilers(cluster.filer.URL), WithHTTPClient(http.DefaultClient),
+		WithChunkSize(10), WithChecksums(true), WithKeyProvider(newTestKeyProvider(t)))
+	require.Nil(t, err)
+	defer c.Close()
+
+	plain, err := New(WithMasters(cluster.master.URL), WithFilers(cluster.filer.URL), WithHTTPClient(http.DefaultClient))
+	require.Nil(t, err)
+	defer plain.Close()
+
+	read := func(r io.Reader) (content []byte) {
+		content, err = ioutil.ReadAll(r)
+		return
+	}
+
+	for _, content := range []string{"0123456789abcdefghijklmno", "small"} {
+		fp := NewFilePartFromReader(ioutil.NopCloser(bytes.NewReader([]byte(content))), "file.txt", int64(len(content)))
+		cm, err := c.UploadFilePart(fp)
+		require.Nil(t, err)
+
+		if cm != nil {
+			require.NotNil(t, cm.Encryption)
+			require.Equal(t, "k1", cm.Encryption.KeyID)
+			for _, chunk := range cm.Chunks {
+				stored, _ := cluster.file(chunk.Fid)
+				require.EqualValues(t, encryptedSize(chunk.Size), len(stored))
+			}
+		} else {
+			stored, _ := cluster.file(fp.FileID)
+			require.EqualValues(t, encryptedSize(int64(len(content))), len(stored))
+			require.NotContains(t, string(stored), content)
+		}
+
+		// transparent decryption
+		var downloaded []byte
+		_, err = c.Download(fp.FileID, nil, func(r io.Reader) error {
+			downloaded = read(r)
+			return err
+		})
+		require.Nil(t, err)
+		require.Equal(t, content, string(downloaded))
+
+		w := &memWriterAt{buf: make([]byte, len(content))}
+		size, err := c.DownloadTo(fp.FileID, w, nil)
+		require.Nil(t, err)
+		require.EqualValues(t, len(content), size)
+		require.Equal(t, content, string(w.buf))
+
+		// client without key provider can not read content
+		_, err = plain.DownloadTo(fp.FileID, &memWriterAt{buf: make([]byte, len(content))}, nil)
+		require.Equal(t, ErrNoKeyProvider, err)
+	}
+
+	// filer
+	filer := c.Filers()[0]
+	_, err = filer.Upload(bytes.NewReader([]byte("filer secret")), 12, "/dir/secret.txt", "", "")
+	require.Nil(t, err)
+
+	stored, ok := cluster.entry("/dir/secret.txt")
+	require.True(t, ok)
+	require.NotContains(t, string(stored), "filer secret")
+
+	var downloaded []byte
+	resp, err := filer.DownloadWithOptions("/dir/secret.txt", nil, nil, func(_ *DownloadResponse, r io.Reader) error {
+		downloaded = read(r)
+		return err
+	})
+	require.Nil(t, err)
+	require.EqualValues(t, 12, resp.ContentLength)
+	require.Equal(t, "filer secret", string(downloaded))
+
+	err = plain.Filers()[0].Download("/dir/secret.txt", nil, func(r io.Reader) error { return nil })
+	require.Equal(t, ErrNoKeyProvider, err)
+}
+
+func TestEncryptedDownloadRanges(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	chunkSize := int64(2*encryptionSegmentSize + 7)
+	content := make([]byte, 2*chunkSize+1000)
+	_, _ = rand.Read(content)
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient),
+		WithChunkSize(chunkSize), WithKeyProvider(newTestKeyProvider(t)))
+	require.Nil(t, err)
+	defer c.Close()
+
+	verifying, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient),
+		WithChunkSize(chunkSize), WithChecksums(true), WithKeyProvider(newTestKeyProvider(t)))
+	require.Nil(t, err)
+	defer verifying.Close()
+
+	// segments of chunks covering range are read, chunks with checksums are read whole to verify them
+	size := int64(len(content))
+	for _, client := range []*Seaweed{c, verifying} {
+		fp := NewFilePartFromReader(ioutil.NopCloser(bytes.NewReader(content)), "big.bin", size)
+		_, err = client.UploadFilePart(fp)
+		require.Nil(t, err)
+
+		for _, rng := range []ByteRange{
+			{Offset: 0, Length: 1},
+			{Offset: encryptionSegmentSize - 3, Length: 10},
+			{Offset: chunkSize - 5, Length: chunkSize + 10},
+			{Offset: 2*encryptionSegmentSize + 1, Length: 6},
+			{Offset: size - 1000},
+			{Offset: 5, Length: 3 * size},
+		} {
+			end := size
+			if rng.Length > 0 && rng.Offset+rng.Length < size {
+				end = rng.Offset + rng.Length
+			}
+
+			var downloaded []byte
+			resp, err := c.DownloadWithOptions(fp.FileID, nil, &DownloadOptions{Ranges: []ByteRange{rng}}, func(_ *DownloadResponse, r io.Reader) (err error) {
+				downloaded, err = ioutil.ReadAll(r)
+				return
+			})
+			require.Nil(t, err, rng)
+			require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+			require.EqualValues(t, end-rng.Offset, resp.ContentLength)
+			require.Equal(t, fmt.Sprintf("bytes %d-%d/%d", rng.Offset, end-1, size), resp.Header.Get("Content-Range"))
+			require.Equal(t, content[rng.Offset:end], downloaded, rng)
+		}
+
+		_, err = c.DownloadWithOptions(fp.FileID, nil, &DownloadOptions{Ranges: []ByteRange{{Offset: size}}}, func(*DownloadResponse, io.Reader) error { return nil })
+		require.NotNil(t, err)
+
+		_, err = c.DownloadWithOptions(fp.FileID, nil, &DownloadOptions{Ranges: []ByteRange{{Offset: 0, Length: 1}, {Offset: 5}}}, func(*DownloadResponse, io.Reader) error { return nil })
+		require.NotNil(t, err)
+	}
+}
+
+func TestEncryptedFilerRanges(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithFilers(cluster.filer.URL), WithHTTPClient(http.DefaultClient),
+		WithKeyProvider(newTestKeyProvider(t)))
+	require.Nil(t, err)
+	defer c.Close()
+
+	content := make([]byte, 3*encryptionSegmentSize+100)
+	_, _ = rand.Read(content)
+	size := int64(len(content))
+
+	filer := c.Filers()[0]
+	_, err = filer.Upload(bytes.NewReader(content), size, "/dir/big.bin", "", "")
+	require.Nil(t, err)
+
+	// header and segments covering range are read
+	for _, rng := range []ByteRange{
+		{Offset: 0, Length: 1},
+		{Offset: encryptionSegmentSize - 3, Length: 10},
+		{Offset: 2*encryptionSegmentSize + 1, Length: encryptionSegmentSize},
+		{Offset: size - 50},
+		{Offset: 5, Length: 3 * size},
+	} {
+		end := size
+		if rng.Length > 0 && rng.Offset+rng.Length < size {
+			end = rng.Offset + rng.Length
+		}
+
+		var downloaded []byte
+		resp, err := filer.DownloadWithOptions("/dir/big.bin", nil, &DownloadOptions{Ranges: []ByteRange{rng}}, func(_ *DownloadResponse, r io.Reader) (err error) {
+			downloaded, err = ioutil.ReadAll(r)
+			return
+		})
+		require.Nil(t, err, rng)
+		require.Equal(t, http.StatusPartialContent, resp.StatusCode)
+		require.EqualValues(t, end-rng.Offset, resp.ContentLength)
+		require.Equal(t, fmt.Sprintf("bytes %d-%d/%d", rng.Offset, end-1, size), resp.Header.Get("Content-Range"))
+		require.Equal(t, content[rng.Offset:end], downloaded, rng)
+	}
+
+	// beyond plain text, although within encrypted content
+	_, err = filer.DownloadWithOptions("/dir/big.bin", nil, &DownloadOptions{Ranges: []ByteRange{{Offset: size + 1}}}, func(*DownloadResponse, io.Reader) error { return nil })
+	var se *statusError
+	require.True(t, errors.As(err, &se))
+	require.Equal(t, http.StatusRequestedRangeNotSatisfiable, se.code)
+
+	_, err = filer.DownloadWithOptions("/dir/big.bin", nil, &DownloadOptions{Ranges: []ByteRange{{Offset: 0, Length: 1}, {Offset: 5}}}, func(*DownloadResponse, io.Reader) error { return nil })
+	require.NotNil(t, err)
+}
@@ -0,0 +1,502 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fakeCluster master assigning sequential file ids on a volume server, which stores uploaded files in memory,
+// and a filer storing entries in memory.
+type fakeCluster struct {
+	master *httptest.Server
+	volume *httptest.Server
+	filer  *httptest.Server
+
+	// assigns number of assign requests.
+	assigns int32
+
+	// lookups number of lookup requests.
+	lookups int32
+
+	// uploadFailures number of next uploads responded with error.
+	uploadFailures int32
+
+	mu    sync.Mutex
+	files map[string][]byte
+
+	// manifests file ids of chunk manifests.
+	manifests map[string]bool
+
+	// deleteFailures file ids which batch delete fails to delete.
+	deleteFailures map[string]bool
+	// batchDeleteDenied makes batch delete reject client as if it was not in white list of volume server.
+	batchDeleteDenied bool
+
+	// corruptUploads uploaded content is corrupted in transit.
+	corruptUploads int32
+
+	// pairs Seaweed-* metadata headers of files and entries.
+	pairs map[string]http.Header
+
+	// entries content of filer entries by path.
+	entries map[string][]byte
+
+	// encodings content encoding of compressed files and entries.
+	encodings map[string]string
+
+	// filerCipher filer encrypts chunks of entries in cipher mode.
+	filerCipher int32
+
+	// chunks chunks of filer entries by path, stored on volume server.
+	chunks map[string][]*FilerChunk
+
+	// volumeReads, filerReads number of content reads served by volume server and filer.
+	volumeReads int32
+	filerReads  int32
+}
+
+func newFakeCluster() *fakeCluster {
+	fc := &fakeCluster{
+		files:          make(map[string][]byte),
+		manifests:      make(map[string]bool),
+		deleteFailures: make(map[string]bool),
+		pairs:          make(map[string]http.Header),
+		entries:        make(map[string][]byte),
+		encodings:      make(map[string]string),
+		chunks:         make(map[string][]*FilerChunk),
+	}
+
+	var seq int32
+	fc.volume = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fid := r.URL.Path[1:]
+		switch {
+		case r.URL.Path == "/delete":
+			fc.mu.Lock()
+			denied := fc.batchDeleteDenied
+			fc.mu.Unlock()
+			if denied {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+
+			_ = r.ParseForm()
+			results := make([]map[string]interface{}, 0, len(r.Form["fid"]))
+			for _, fid := range r.Form["fid"] {
+				fc.mu.Lock()
+				data, ok := fc.files[fid]
+				failure := fc.deleteFailures[fid]
+				if !failure {
+					delete(fc.files, fid)
+				}
+				fc.mu.Unlock()
+
+				if failure {
+					results = append(results, map[string]interface{}{"fid": fid, "status": http.StatusInternalServerError, "error": "io error"})
+				} else if ok {
+					results = append(results, map[string]interface{}{"fid": fid, "size": len(data), "status": http.StatusAccepted})
+				} else {
+					results = append(results, map[string]interface{}{"fid": fid, "status": http.StatusNotFound, "error": "not found"})
+				}
+			}
+			w.WriteHeader(http.StatusAccepted)
+			_ = json.NewEncoder(w).Encode(results)
+
+		case r.Method == http.MethodPost:
+			if atomic.AddInt32(&fc.uploadFailures, -1) >= 0 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			file, fh, err := r.FormFile("file")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := ioutil.ReadAll(file)
+			if atomic.LoadInt32(&fc.corruptUploads) > 0 {
+				data = corrupt(data)
+			}
+
+			encoding := serverEncoding(fh.Header)
+			plain, err := decompress(data, encoding)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			sum := md5.Sum(plain)
+			contentMD5 := base64.StdEncoding.EncodeToString(sum[:])
+			if expected := r.Header.Get("Content-MD5"); expected != "" && expected != contentMD5 {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = fmt.Fprintf(w, `{"error":"Content-MD5 did not match md5 of file data expected [%s] received [%s]"}`, expected, contentMD5)
+				return
+			}
+
+			fc.setFile(fid, data)
+			fc.setEncoding(fid, encoding)
+			fc.setPairs(fid, r.Header)
+			fc.mu.Lock()
+			fc.manifests[fid] = r.URL.Query().Get("cm") == "true"
+			fc.mu.Unlock()
+
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprintf(w, `{"size":%d,"contentMd5":%q}`, len(plain), contentMD5)
+
+		case r.Method == http.MethodDelete:
+			// like SeaweedFS, chunks of manifest are deleted along with it, manifest is kept if any of them is not found
+			if err := fc.deleteManifestChunks(fid); err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = fmt.Fprintf(w, `{"error":"Delete chunks error: %v"}`, err)
+				return
+			}
+
+			fc.mu.Lock()
+			_, ok := fc.files[fid]
+			delete(fc.files, fid)
+			fc.mu.Unlock()
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusAccepted)
+
+		default:
+			data, ok := fc.file(fid)
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			atomic.AddInt32(&fc.volumeReads, 1)
+			fc.writePairs(w, fid)
+			if fc.isManifest(fid) && r.URL.Query().Get("cm") != "false" {
+				// like SeaweedFS, content of chunks is responded in place of manifest
+				w.Header().Set("X-File-Store", "chunked")
+				data = fc.chunksContent(fid)
+			} else {
+				data, _ = fc.encode(w, r, fid, data)
+			}
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		}
+	}))
+
+	fc.filer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			file, header, err := r.FormFile("file")
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			data, _ := ioutil.ReadAll(file)
+
+			path := r.URL.Path
+			if strings.HasSuffix(path, "/") {
+				path += header.Filename
+			}
+
+			// content is stored as a chunk too, encrypted in cipher mode
+			chunk := &FilerChunk{FileID: fmt.Sprintf("5,%02x", atomic.AddInt32(&seq, 1)), Size: int64(len(data))}
+			stored := data
+			if atomic.LoadInt32(&fc.filerCipher) > 0 {
+				stored, chunk.CipherKey, _ = cipherEncrypt(data)
+			}
+			fc.setFile(chunk.FileID, stored)
+
+			fc.mu.Lock()
+			if !fc.preconditions(r, path) {
+				fc.mu.Unlock()
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			fc.entries[path] = data
+			fc.chunks[path] = []*FilerChunk{chunk}
+			fc.mu.Unlock()
+			fc.setEncoding(path, serverEncoding(header.Header))
+			fc.setPairs(path, r.Header)
+
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprintf(w, `{"name":%q,"size":%d}`, header.Filename, len(data))
+
+		case http.MethodDelete:
+			fc.mu.Lock()
+			if !fc.preconditions(r, r.URL.Path) {
+				fc.mu.Unlock()
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+			delete(fc.entries, r.URL.Path)
+			delete(fc.chunks, r.URL.Path)
+			fc.mu.Unlock()
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			fc.mu.Lock()
+			data, ok := fc.entries[r.URL.Path]
+			chunks := fc.chunks[r.URL.Path]
+			fc.mu.Unlock()
+			if !ok && strings.HasSuffix(r.URL.Path, "/") {
+				_ = json.NewEncoder(w).Encode(fc.list(r.URL.Path))
+				return
+			}
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.URL.Query().Get("metadata") == "true" {
+				_ = json.NewEncoder(w).Encode(&FilerEntry{FullPath: r.URL.Path, FileSize: int64(len(data)), Chunks: chunks})
+				return
+			}
+			atomic.AddInt32(&fc.filerReads, 1)
+			w.Header().Set("ETag", entryETag(data))
+			fc.writePairs(w, r.URL.Path)
+			data, _ = fc.encode(w, r, r.URL.Path, data)
+			http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+		}
+	}))
+
+	fc.master = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, _ := url.Parse(fc.volume.URL)
+		switch r.URL.Path {
+		case "/dir/assign":
+			atomic.AddInt32(&fc.assigns, 1)
+			count, _ := strconv.Atoi(r.URL.Query().Get("count"))
+			if count <= 0 {
+				count = 1
+			}
+			_, _ = fmt.Fprintf(w, `{"fid":"3,%02x","url":%q,"publicUrl":%q,"count":%d}`, atomic.AddInt32(&seq, 1), u.Host, u.Host, count)
+		default:
+			atomic.AddInt32(&fc.lookups, 1)
+			_, _ = fmt.Fprintf(w, `{"volumeId":"3","locations":[{"url":%q,"publicUrl":%q}]}`, u.Host, u.Host)
+		}
+	}))
+
+	return fc
+}
+
+func (fc *fakeCluster) Close() {
+	fc.master.Close()
+	fc.volume.Close()
+	fc.filer.Close()
+}
+
+// setPairs stores Seaweed-* headers of request as metadata of file or entry.
+func (fc *fakeCluster) setPairs(key string, header http.Header) {
+	pairs := make(http.Header)
+	for k, v := range header {
+		if strings.HasPrefix(k, "Seaweed-") {
+			pairs[k] = v
+		}
+	}
+
+	fc.mu.Lock()
+	fc.pairs[key] = pairs
+	fc.mu.Unlock()
+}
+
+func (fc *fakeCluster) pair(key, name string) string {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.pairs[key].Get(name)
+}
+
+func (fc *fakeCluster) writePairs(w http.ResponseWriter, key string) {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for k, v := range fc.pairs[key] {
+		w.Header()[k] = v
+	}
+}
+
+func (fc *fakeCluster) setEncoding(key, encoding string) {
+	fc.mu.Lock()
+	fc.encodings[key] = encoding
+	fc.mu.Unlock()
+}
+
+func (fc *fakeCluster) encoding(key string) string {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.encodings[key]
+}
+
+// encode returns stored content to respond and its decompressed content. Like SeaweedFS, compressed content
+// is responded as is only to whole content requests accepting its encoding.
+func (fc *fakeCluster) encode(w http.ResponseWriter, r *http.Request, key string, data []byte) (body, plain []byte) {
+	encoding := fc.encoding(key)
+	if encoding == "" {
+		return data, data
+	}
+
+	plain, _ = decompress(data, encoding)
+	if r.Header.Get("Range") == "" && strings.Contains(r.Header.Get("Accept-Encoding"), encoding) {
+		w.Header().Set("Content-Encoding", encoding)
+		return data, plain
+	}
+	return plain, plain
+}
+
+// serverEncoding returns Content-Encoding of uploaded file part known to SeaweedFS, which knows gzip only.
+func serverEncoding(h textproto.MIMEHeader) string {
+	if encoding := h.Get("Content-Encoding"); encoding == CompressionGzip {
+		return encoding
+	}
+	return ""
+}
+
+func decompress(data []byte, encoding string) ([]byte, error) {
+	if encoding == "" {
+		return data, nil
+	}
+
+	r, err := newDecompressor(bytes.NewReader(data), encoding)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+// preconditions reports whether If-Match/If-None-Match of write request hold for entry at path. Caller holds fc.mu.
+func (fc *fakeCluster) preconditions(r *http.Request, path string) bool {
+	data, ok := fc.entries[path]
+	if r.Header.Get("If-None-Match") == "*" && ok {
+		return false
+	}
+	if etag := r.Header.Get("If-Match"); etag != "" && (!ok || etag != entryETag(data)) {
+		return false
+	}
+	return true
+}
+
+func entryETag(data []byte) string {
+	return fmt.Sprintf(`"%x"`, md5.Sum(data))
+}
+
+func (fc *fakeCluster) entry(path string) (data []byte, ok bool) {
+	fc.mu.Lock()
+	data, ok = fc.entries[path]
+	fc.mu.Unlock()
+	return
+}
+
+// list returns sorted paths of entries under directory dir.
+func (fc *fakeCluster) list(dir string) (paths []string) {
+	fc.mu.Lock()
+	for p := range fc.entries {
+		if strings.HasPrefix(p, dir) {
+			paths = append(paths, p)
+		}
+	}
+	fc.mu.Unlock()
+
+	sort.Strings(paths)
+	return
+}
+
+func (fc *fakeCluster) file(fid string) (data []byte, ok bool) {
+	fc.mu.Lock()
+	data, ok = fc.files[fid]
+	fc.mu.Unlock()
+	return
+}
+
+func (fc *fakeCluster) setFile(fid string, data []byte) {
+	fc.mu.Lock()
+	fc.files[fid] = data
+	fc.mu.Unlock()
+}
+
+func (fc *fakeCluster) isManifest(fid string) bool {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return fc.manifests[fid]
+}
+
+// deleteManifestChunks deletes chunks of file if it is chunk manifest, failing if any chunk is not found or fails to delete.
+func (fc *fakeCluster) deleteManifestChunks(fid string) error {
+	data, ok := fc.file(fid)
+	if !ok || !fc.isManifest(fid) {
+		return nil
+	}
+
+	data, err := decompress(data, fc.encoding(fid))
+	if err != nil {
+		return err
+	}
+	cm, err := loadChunkManifest(data, false)
+	if err != nil {
+		return err
+	}
+
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	for _, chunk := range cm.Chunks {
+		if _, ok := fc.files[chunk.Fid]; !ok {
+			err = fmt.Errorf("chunk %s is not found", chunk.Fid)
+		} else if fc.deleteFailures[chunk.Fid] {
+			err = fmt.Errorf("chunk %s is not deleted", chunk.Fid)
+		} else {
+			delete(fc.files, chunk.Fid)
+		}
+	}
+	return err
+}
+
+// chunksContent returns content of chunks of manifest concatenated as stored.
+func (fc *fakeCluster) chunksContent(fid string) (content []byte) {
+	data, _ := fc.file(fid)
+	data, _ = decompress(data, fc.encoding(fid))
+	cm, err := loadChunkManifest(data, false)
+	if err != nil {
+		return nil
+	}
+
+	for _, chunk := range cm.Chunks {
+		data, _ := fc.file(chunk.Fid)
+		data, _ = decompress(data, fc.encoding(chunk.Fid))
+		content = append(content, data...)
+	}
+	return
+}
+
+func (fc *fakeCluster) failDelete(fid string, fail bool) {
+	fc.mu.Lock()
+	fc.deleteFailures[fid] = fail
+	fc.mu.Unlock()
+}
+
+func (fc *fakeCluster) fileCount() int {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+	return len(fc.files)
+}
+
+// corrupt returns copy of data with first byte flipped.
+func corrupt(data []byte) []byte {
+	data = append([]byte(nil), data...)
+	if len(data) > 0 {
+		data[0] ^= 0xff
+	}
+	return data
+}
+
+// readSeekCloser seekable in-memory file content.
+type readSeekCloser struct {
+	*bytes.Reader
+}
+
+func (readSeekCloser) Close() error { return nil }
@@ -0,0 +1,201 @@
+package goseaweedfs
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+)
+
+const defaultFileIDPoolBatch = 64
+
+// ErrFileIDPoolClosed pool is closed and has no reserved file id left.
+var ErrFileIDPoolClosed = errors.New("seaweedfs: file id pool is closed")
+
+// FileIDPool reserves file ids from master in batches (assign with count) and hands them out one by one.
+// Reserved ids are grouped by assign options (collection, replication, ttl, dataCenter, ...) since each group
+// is assigned on different volumes. A background refill is triggered when remaining ids of a group drop to low watermark.
+//
+// FileIDPool is safe for concurrent use.
+type FileIDPool struct {
+	c            *Seaweed
+	batch        int
+	lowWatermark int
+
+	mu      sync.Mutex
+	buckets map[fileIDPoolKey]*fileIDBucket
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// fileIDPoolKey is assign options without count. Replica placement is encoded to string to make key comparable.
+type fileIDPoolKey struct {
+	opts        AssignOptions
+	replication string
+}
+
+type fileIDBucket struct {
+	reserved []*AssignResult
+	refill   *fileIDRefill
+}
+
+type fileIDRefill struct {
+	done chan struct{}
+	err  error
+}
+
+// NewFileIDPool creates new file id pool on top of seaweed client. Each assign request reserves `batch` file ids.
+// Background refill happens when number of reserved ids drops to `lowWatermark`.
+func NewFileIDPool(c *Seaweed, batch, lowWatermark int) *FileIDPool {
+	if batch <= 0 {
+		batch = defaultFileIDPoolBatch
+	}
+	if lowWatermark < 0 || lowWatermark >= batch {
+		lowWatermark = batch / 4
+	}
+
+	return &FileIDPool{
+		c:            c,
+		batch:        batch,
+		lowWatermark: lowWatermark,
+		buckets:      make(map[fileIDPoolKey]*fileIDBucket),
+	}
+}
+
+// Get takes a reserved file id for assign options. Count of options is ignored.
+// When there is no reserved id left, caller waits for an in-flight refill or requests master itself.
+// After Close, remaining reserved ids are still handed out, then ErrFileIDPoolClosed is returned.
+func (p *FileIDPool) Get(opts *AssignOptions) (result *AssignResult, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+
+	key := fileIDPoolKey{opts: *opts.clone()}
+	key.opts.Count = 0
+	key.replication, key.opts.Replication = key.opts.Replication.String(), nil
+
+	p.mu.Lock()
+	bucket := p.bucket(key)
+	for {
+		if n := len(bucket.reserved); n > 0 {
+			result = bucket.reserved[n-1]
+			bucket.reserved[n-1] = nil
+			bucket.reserved = bucket.reserved[:n-1]
+
+			if !p.closed && len(bucket.reserved) <= p.lowWatermark && bucket.refill == nil {
+				p.wg.Add(1)
+				go p.refill(key, bucket, p.startRefill(bucket))
+			}
+
+			p.mu.Unlock()
+			return
+		}
+
+		if r := bucket.refill; r != nil { // wait for in-flight refill
+			p.mu.Unlock()
+			<-r.done
+			if r.err != nil {
+				return nil, r.err
+			}
+			p.mu.Lock()
+			continue
+		}
+
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrFileIDPoolClosed
+		}
+
+		r := p.startRefill(bucket)
+		p.wg.Add(1)
+		p.mu.Unlock()
+
+		p.refill(key, bucket, r)
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		p.mu.Lock()
+	}
+}
+
+// Close stops refilling and waits for running background refills.
+func (p *FileIDPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+func (p *FileIDPool) bucket(key fileIDPoolKey) *fileIDBucket {
+	bucket, ok := p.buckets[key]
+	if !ok {
+		bucket = &fileIDBucket{}
+		p.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// startRefill must be called with p.mu held.
+func (p *FileIDPool) startRefill(bucket *fileIDBucket) *fileIDRefill {
+	bucket.refill = &fileIDRefill{done: make(chan struct{})}
+	return bucket.refill
+}
+
+func (p *FileIDPool) refill(key fileIDPoolKey, bucket *fileIDBucket, r *fileIDRefill) {
+	defer p.wg.Done()
+
+	reserved, err := p.reserve(key)
+
+	p.mu.Lock()
+	bucket.reserved = append(bucket.reserved, reserved...)
+	bucket.refill = nil
+	p.mu.Unlock()
+
+	r.err = err
+	close(r.done)
+}
+
+func (p *FileIDPool) reserve(key fileIDPoolKey) ([]*AssignResult, error) {
+	opts := key.opts
+	opts.Count = p.batch
+	opts.Replication, _ = ParseReplicaPlacement(key.replication)
+
+	assigned, err := p.c.AssignWithOptions(&opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return expandAssignResult(assigned), nil
+}
+
+// expandAssignResult splits assign result with count > 1 into single file id results.
+// According to SeaweedFS API, reserved file ids are: fid, fid_1, fid_2, ..., fid_(count-1).
+func expandAssignResult(assigned *AssignResult) []*AssignResult {
+	count := int(assigned.Count)
+	if count <= 0 {
+		count = 1
+	}
+
+	results := make([]*AssignResult, count)
+	for i := range results {
+		results[i] = &AssignResult{
+			FileID:    assignedFileID(assigned.FileID, i),
+			URL:       assigned.URL,
+			PublicURL: assigned.PublicURL,
+			Count:     1,
+			Auth:      assigned.Auth, // token of fid is also valid for fid_N
+
+		}
+	}
+
+	return results
+}
+
+// assignedFileID returns i-th file id reserved by an assign request with count.
+func assignedFileID(fid string, i int) string {
+	if i == 0 {
+		return fid
+	}
+	return fid + "_" + strconv.Itoa(i)
+}
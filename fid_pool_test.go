@@ -0,0 +1,98 @@
+package goseaweedfs
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandAssignResult(t *testing.T) {
+	results := expandAssignResult(&AssignResult{FileID: "3,01637037d6", URL: "localhost:8080", Count: 3})
+	require.Equal(t, 3, len(results))
+	require.Equal(t, "3,01637037d6", results[0].FileID)
+	require.Equal(t, "3,01637037d6_1", results[1].FileID)
+	require.Equal(t, "3,01637037d6_2", results[2].FileID)
+	for _, r := range results {
+		require.Equal(t, "localhost:8080", r.URL)
+		require.EqualValues(t, 1, r.Count)
+	}
+}
+
+func TestFileIDPool(t *testing.T) {
+	var assigns int32
+	master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&assigns, 1)
+		count, _ := strconv.Atoi(r.URL.Query().Get(ParamAssignCount))
+		fmt.Fprintf(w, `{"fid":"%s,%x","url":"127.0.0.1:8080","publicUrl":"127.0.0.1:8080","count":%d}`,
+			r.URL.Query().Get(ParamCollection), n, count)
+	}))
+	defer master.Close()
+
+	c, err := NewSeaweed(master.URL, nil, 0, http.DefaultClient)
+	require.Nil(t, err)
+
+	pool := NewFileIDPool(c, 8, 2)
+	c.UseFileIDPool(pool)
+
+	var (
+		mu   sync.Mutex
+		seen = make(map[string]struct{})
+		wg   sync.WaitGroup
+		errs = make(chan error, 64)
+	)
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			collection := "a"
+			if i%2 == 1 {
+				collection = "b"
+			}
+
+			res, err := pool.Get(&AssignOptions{Collection: collection})
+			if err != nil {
+				errs <- err
+				return
+			}
+			if res.FileID[:1] != collection {
+				errs <- fmt.Errorf("%s is not in collection %s", res.FileID, collection)
+				return
+			}
+
+			mu.Lock()
+			_, dup := seen[res.FileID]
+			seen[res.FileID] = struct{}{}
+			mu.Unlock()
+			if dup {
+				errs <- fmt.Errorf("duplicated %s", res.FileID)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.Nil(t, err)
+	}
+
+	require.Nil(t, c.Close())
+	require.Equal(t, 64, len(seen))
+	require.Less(t, int(atomic.LoadInt32(&assigns)), 64)
+
+	// closed pool hands out what is left, then stops requesting master
+	assigned := atomic.LoadInt32(&assigns)
+	for {
+		if _, err = pool.Get(&AssignOptions{Collection: "c"}); err != nil {
+			break
+		}
+	}
+	require.Equal(t, ErrFileIDPoolClosed, err)
+	require.Equal(t, assigned, atomic.LoadInt32(&assigns))
+}
@@ -18,17 +18,25 @@ type FilePart struct {
 	ModTime    int64 //in seconds
 	Collection string
 
-	// TTL Time to live.
-	// 3m: 3 minutes
-	// 4h: 4 hours
-	// 5d: 5 days
-	// 6w: 6 weeks
-	// 7M: 7 months
-	// 8y: 8 years
-	TTL string
+	// AssignOptions options for assigning file id(s), e.g: replication, time to live, data center.
+	// Collection of file part takes precedence over the one of options.
+	AssignOptions *AssignOptions
 
 	Server string
 	FileID string
+
+	// Auth JWT token for writing file id, issued by master on assign.
+	Auth string
+
+	// Progress receives progress of uploading file part.
+	Progress ProgressFunc
+
+	// Checksums of uploaded content, set after upload if client computes checksums.
+	Checksums Checksums
+
+	// CipherKey key of content encrypted in cipher mode, set after upload. Keys of chunks of chunked file are
+	// sealed by it.
+	CipherKey []byte
 }
 
 // Close underlying openned file.
@@ -37,6 +45,23 @@ func (f *FilePart) Close() (err error) {
 	return
 }
 
+func (f *FilePart) assignOptions() *AssignOptions {
+	opts := f.AssignOptions.clone()
+	opts.Count = 0
+	if f.Collection != "" {
+		opts.Collection = f.Collection
+	}
+	return opts
+}
+
+// ttl returns time to live of file part, empty if it has none.
+func (f *FilePart) ttl() string {
+	if f.AssignOptions == nil {
+		return ""
+	}
+	return f.AssignOptions.TTL.String()
+}
+
 // NewFilePartFromReader new file part from file reader.
 // fileName and fileSize must be known
 func NewFilePartFromReader(reader io.ReadCloser, fileName string, fileSize int64) *FilePart {
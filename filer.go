@@ -1,17 +1,28 @@
 package goseaweedfs
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 )
 
-// Filer client
+// Filer client. Methods with Context suffix send requests with ctx, see Seaweed.
 type Filer struct {
-	base   *url.URL
-	client *httpClient
+	base    *url.URL
+	client  *httpClient
+	jwt     *JWTConfig
+	metrics Metrics
+	keys    KeyProvider
+
+	compression *CompressionPolicy
+	cipher      bool
+	cache       *DiskCache
+	memCache    *MemoryCache
 }
 
 // FilerUploadResult upload result which responsed from filer server. According to https://github.com/chrislusf/seaweedfs/wiki/Filer-Server-API.
@@ -25,11 +36,11 @@ type FilerUploadResult struct {
 
 // NewFiler new filer with filer server's url
 func NewFiler(u string, client *http.Client) (f *Filer, err error) {
-	return newFiler(u, newHTTPClient(client))
+	return newFiler(u, "", newHTTPClient(client))
 }
 
-func newFiler(u string, client *httpClient) (f *Filer, err error) {
-	base, err := parseURI(u)
+func newFiler(u, defaultScheme string, client *httpClient) (f *Filer, err error) {
+	base, err := parseURIWithScheme(u, defaultScheme)
 	if err != nil {
 		return
 	}
@@ -52,15 +63,15 @@ func (f *Filer) Close() (err error) {
 
 // UploadFile a file.
 func (f *Filer) UploadFile(localFilePath, newPath, collection, ttl string) (result *FilerUploadResult, err error) {
+	return f.UploadFileContext(context.Background(), localFilePath, newPath, collection, ttl)
+}
+
+// UploadFileContext is like UploadFile, with context ctx.
+func (f *Filer) UploadFileContext(ctx context.Context, localFilePath, newPath, collection, ttl string) (result *FilerUploadResult, err error) {
 	fp, err := NewFilePart(localFilePath)
 	if err == nil {
-		var data []byte
-		data, _, err = f.client.upload(encodeURI(*f.base, newPath, normalize(nil, collection, ttl)), localFilePath, fp.Reader, fp.MimeType)
-		if err == nil {
-			result = &FilerUploadResult{}
-			err = json.Unmarshal(data, result)
-		}
-
+		fp.FileName = localFilePath
+		result, err = f.UploadFilePartContext(ctx, fp, newPath, collection, ttl)
 		_ = fp.Close()
 	}
 	return
@@ -68,34 +79,253 @@ func (f *Filer) UploadFile(localFilePath, newPath, collection, ttl string) (resu
 
 // Upload content.
 func (f *Filer) Upload(content io.Reader, fileSize int64, newPath, collection, ttl string) (result *FilerUploadResult, err error) {
+	return f.UploadContext(context.Background(), content, fileSize, newPath, collection, ttl)
+}
+
+// UploadContext is like Upload, with context ctx.
+func (f *Filer) UploadContext(ctx context.Context, content io.Reader, fileSize int64, newPath, collection, ttl string) (result *FilerUploadResult, err error) {
 	fp := NewFilePartFromReader(ioutil.NopCloser(content), newPath, fileSize)
+	result, err = f.UploadFilePartContext(ctx, fp, newPath, collection, ttl)
+	_ = fp.Close()
+	return
+}
+
+// UploadFilePart uploads file part to new path, reporting progress to file part's Progress.
+func (f *Filer) UploadFilePart(fp *FilePart, newPath, collection, ttl string) (result *FilerUploadResult, err error) {
+	return f.UploadFilePartContext(context.Background(), fp, newPath, collection, ttl)
+}
 
-	var data []byte
-	data, _, err = f.client.upload(encodeURI(*f.base, newPath, normalize(nil, collection, ttl)), newPath, ioutil.NopCloser(content), "")
+// UploadFilePartContext is like UploadFilePart, with context ctx.
+func (f *Filer) UploadFilePartContext(ctx context.Context, fp *FilePart, newPath, collection, ttl string) (result *FilerUploadResult, err error) {
+	ctx, end := f.startCall(ctx, OpFilerUpload, newPath)
+	defer end(&err)
+
+	progress := newProgressTracker(fp.Progress, fp.FileName, "", fp.FileSize)
+	defer func() { progress.done(err) }()
+
+	if _, err = ParseTTL(ttl); err != nil {
+		return
+	}
+
+	header := f.auth(true)
+	reader := progress.reader(fp.Reader, -1)
+	if f.keys != nil {
+		var env *Envelope
+		var key *contentKey
+		if env, key, err = newEnvelope(ctx, f.keys, ""); err != nil {
+			return
+		}
+		if reader, err = newEncryptingReader(reader, key, 0); err != nil {
+			return
+		}
+		header = env.header(header)
+	} else if reader, header, err = f.compression.compress(reader, fp.MimeType, fp.FileName, fp.FileSize, header); err != nil {
+		return
+	}
+
+	data, _, err := f.client.upload(ctx, OpFilerUpload, encodeURI(*f.base, newPath, normalize(nil, collection, ttl)), fp.FileName, reader, fp.MimeType, header)
 	if err == nil {
 		result = &FilerUploadResult{}
-		err = json.Unmarshal(data, result)
+		if err = json.Unmarshal(data, result); err == nil {
+			progress.setFile("", result.FileID, 0)
+			f.cache.InvalidatePath(entryPath(newPath, result.Name))
+			f.invalidateMemoryCache(entryPath(newPath, result.Name), false)
+			if f.cipher {
+				err = f.verifyCipher(ctx, entryPath(newPath, result.Name))
+			}
+		}
 	}
 
-	_ = fp.Close()
-
 	return
 }
 
-// Get response data from filer.
+// Get response data from filer. Content encrypted by client is returned as is. Gets without args and header
+// go through in-memory cache if filer has one, cached listing of directory is invalidated by uploads and deletes
+// of its entries through filer.
 func (f *Filer) Get(path string, args url.Values, header map[string]string) (data []byte, statusCode int, err error) {
-	data, statusCode, err = f.client.get(encodeURI(*f.base, path, args), header)
+	return f.GetContext(context.Background(), path, args, header)
+}
+
+// GetContext is like Get, with context ctx.
+func (f *Filer) GetContext(ctx context.Context, path string, args url.Values, header map[string]string) (data []byte, statusCode int, err error) {
+	if f.memCache != nil && len(args) == 0 && len(header) == 0 {
+		return f.getCached(ctx, path)
+	}
+	return f.get(ctx, path, args, header)
+}
+
+func (f *Filer) get(ctx context.Context, path string, args url.Values, header map[string]string) (data []byte, statusCode int, err error) {
+	ctx, end := f.startCall(ctx, OpFilerGet, path)
+	defer end(&err)
+
+	if auth := f.auth(false); auth != nil {
+		for k, v := range header {
+			auth[k] = v
+		}
+		header = auth
+	}
+
+	data, statusCode, err = f.client.get(ctx, OpFilerGet, encodeURI(*f.base, path, args), header)
 	return
 }
 
 // Download a file.
 func (f *Filer) Download(path string, args url.Values, callback func(io.Reader) error) (err error) {
-	_, err = f.client.download(encodeURI(*f.base, path, args), callback)
+	return f.DownloadContext(context.Background(), path, args, callback)
+}
+
+// DownloadContext is like Download, with context ctx.
+func (f *Filer) DownloadContext(ctx context.Context, path string, args url.Values, callback func(io.Reader) error) (err error) {
+	_, err = f.DownloadWithOptionsContext(ctx, path, args, nil, func(_ *DownloadResponse, r io.Reader) error {
+		return callback(r)
+	})
+	return
+}
+
+// DownloadWithOptions downloads a file with range/conditional options. Callback is not called if content is not modified.
+// A single range of content encrypted by client is read by reading header and sealed segments covering the range,
+// multiple ranges of such content are not supported.
+func (f *Filer) DownloadWithOptions(path string, args url.Values, opts *DownloadOptions, callback func(*DownloadResponse, io.Reader) error) (resp *DownloadResponse, err error) {
+	return f.DownloadWithOptionsContext(context.Background(), path, args, opts, callback)
+}
+
+// DownloadWithOptionsContext is like DownloadWithOptions, with context ctx.
+func (f *Filer) DownloadWithOptionsContext(ctx context.Context, path string, args url.Values, opts *DownloadOptions, callback func(*DownloadResponse, io.Reader) error) (resp *DownloadResponse, err error) {
+	ctx, end := f.startCall(ctx, OpFilerDownload, path)
+	defer end(&err)
+
+	callback, done := trackDownload(opts.progress(), "", callback)
+	defer func() { done(err) }()
+
+	plain := callback
+	callback = decryptDownload(ctx, f.keys, "", callback)
+
+	if f.cache != nil && opts.wholeContent() && len(args) == 0 {
+		resp, err = f.downloadCached(ctx, path, callback)
+		return
+	}
+
+	fileURL := encodeURI(*f.base, path, args)
+	resp, err = f.client.downloadWithOptions(ctx, OpFilerDownload, fileURL, opts.withHeader(f.auth(false)), callback)
+
+	var rangeErr *encryptedRangeError
+	if errors.As(err, &rangeErr) {
+		if len(opts.Ranges) > 1 {
+			return nil, errors.New("seaweedfs: multiple ranges of encrypted content are not supported")
+		}
+		resp, err = f.downloadEncryptedRange(ctx, fileURL, opts, rangeErr, plain)
+	}
+	return
+}
+
+// downloadEncryptedRange reads plain text range of options from content encrypted by client, whose encrypted range is
+// responded already. Size of content is known from that response, header of content and sealed segments covering the
+// range are read by range requests.
+func (f *Filer) downloadEncryptedRange(ctx context.Context, fileURL string, opts *DownloadOptions, partial *encryptedRangeError, callback func(*DownloadResponse, io.Reader) error) (resp *DownloadResponse, err error) {
+	_, total, err := parseContentRange(partial.resp.Header.Get("Content-Range"))
+	if err != nil {
+		return
+	}
+	size := plainSize(total)
+	if size < 0 {
+		return nil, ErrDecryption
+	}
+
+	lo, hi := opts.Ranges[0].Offset, size
+	if n := opts.Ranges[0].Length; n > 0 && lo+n < hi {
+		hi = lo + n
+	}
+	if lo < 0 || lo >= size {
+		return nil, &statusError{method: "Download", url: fileURL, status: http.StatusText(http.StatusRequestedRangeNotSatisfiable), code: http.StatusRequestedRangeNotSatisfiable}
+	}
+
+	key, err := partial.env.open(ctx, f.keys, "")
+	if err != nil {
+		return
+	}
+
+	rangeOpts := func(rng ByteRange) *DownloadOptions {
+		return (&DownloadOptions{Ranges: []ByteRange{rng}, Header: opts.Header}).withHeader(f.auth(false))
+	}
+
+	// header is read along with segments if they follow it
+	header := make([]byte, encryptionHeaderSize)
+	sealed, first, last, skip := segmentRange(lo, hi, size)
+	if first == 0 {
+		sealed = ByteRange{Length: sealed.Offset + sealed.Length}
+	} else if _, err = f.client.downloadWithOptions(ctx, OpFilerDownload, fileURL, rangeOpts(ByteRange{Length: encryptionHeaderSize}), func(_ *DownloadResponse, r io.Reader) error {
+		_, err := io.ReadFull(r, header)
+		return truncated(err)
+	}); err != nil {
+		return
+	}
+
+	return f.client.downloadWithOptions(ctx, OpFilerDownload, fileURL, rangeOpts(sealed), func(resp *DownloadResponse, r io.Reader) (err error) {
+		if resp.StatusCode != http.StatusPartialContent {
+			return fmt.Errorf("Download %s: range %s is not satisfied. Status:%d", fileURL, sealed, resp.StatusCode)
+		}
+		if first == 0 {
+			if _, err = io.ReadFull(r, header); err != nil {
+				return truncated(err)
+			}
+		}
+
+		src, err := newSegmentDecryptingReader(r, key, 0, header, first, last)
+		if err != nil {
+			return
+		}
+		if _, err = io.CopyN(ioutil.Discard, src, skip); err != nil {
+			return truncated(err)
+		}
+
+		resp.ContentLength = hi - lo
+		resp.Header = resp.Header.Clone()
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", lo, hi-1, size))
+		return callback(resp, io.LimitReader(src, hi-lo))
+	})
+}
+
+// downloadCached downloads whole content at path through disk cache. Cached content is revalidated by its ETag,
+// content is transferred only if it is modified.
+func (f *Filer) downloadCached(ctx context.Context, path string, callback func(*DownloadResponse, io.Reader) error) (resp *DownloadResponse, err error) {
+	opts := &DownloadOptions{}
+
+	cached := f.cache.open(f.cache.pathKey(path))
+	if cached != nil {
+		defer cached.Close()
+		opts.IfNoneMatch = cached.meta.ETag
+	}
+
+	resp, err = f.client.downloadWithOptions(ctx, OpFilerDownload, encodeURI(*f.base, path, nil), opts.withHeader(f.auth(false)),
+		f.cache.fill(filerCacheMeta(path), callback))
+	if err == nil && resp.NotModified && cached != nil {
+		resp = cached.response()
+		if err = callback(resp, cached); err != nil {
+			f.cache.remove(cached.meta.Key)
+		}
+	}
 	return
 }
 
 // Delete a file/dir.
 func (f *Filer) Delete(path string, args url.Values) (err error) {
-	_, err = f.client.delete(encodeURI(*f.base, path, args))
+	return f.DeleteContext(context.Background(), path, args)
+}
+
+// DeleteContext is like Delete, with context ctx.
+func (f *Filer) DeleteContext(ctx context.Context, path string, args url.Values) (err error) {
+	ctx, end := f.startCall(ctx, OpFilerDelete, path)
+	defer end(&err)
+
+	_, err = f.client.delete(ctx, OpFilerDelete, encodeURI(*f.base, path, args), f.auth(true))
+	if err == nil {
+		f.cache.InvalidatePath(path)
+		f.invalidateMemoryCache(path, true)
+	}
 	return
 }
+
+// auth builds Authorization header for filer request. Nil if filer keys are not set.
+func (f *Filer) auth(write bool) map[string]string {
+	return authHeader(f.jwt.filerToken(write))
+}
@@ -0,0 +1,235 @@
+package goseaweedfs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FilerEntry metadata of filer entry, including its chunks. According to SeaweedFS filer, which responds
+// it for reading with metadata=true.
+type FilerEntry struct {
+	FullPath string      `json:"FullPath"`
+	Mtime    time.Time   `json:"Mtime"`
+	Crtime   time.Time   `json:"Crtime"`
+	Mode     os.FileMode `json:"Mode"`
+	Mime     string      `json:"Mime"`
+	TtlSec   int32       `json:"TtlSec"`
+	Md5      []byte      `json:"Md5"`
+	FileSize int64       `json:"FileSize"`
+
+	// Extended extended attributes, e.g: Seaweed-* headers of upload.
+	Extended map[string][]byte `json:"Extended"`
+
+	// Chunks of content stored in volumes.
+	Chunks []*FilerChunk `json:"chunks"`
+
+	// Content of small file stored inside filer.
+	Content []byte `json:"Content"`
+}
+
+// FilerChunk chunk of filer entry.
+type FilerChunk struct {
+	FileID       string       `json:"file_id"`
+	Fid          *FilerFileID `json:"fid"`
+	Offset       int64        `json:"offset"`
+	Size         int64        `json:"size"`
+	ModifiedTsNs int64        `json:"modified_ts_ns"`
+	ETag         string       `json:"e_tag"`
+
+	// CipherKey key of chunk encrypted by filer in cipher mode.
+	CipherKey []byte `json:"cipher_key"`
+
+	// IsCompressed content of chunk is compressed.
+	IsCompressed bool `json:"is_compressed"`
+
+	// IsChunkManifest chunk is a manifest of other chunks.
+	IsChunkManifest bool `json:"is_chunk_manifest"`
+}
+
+// FilerFileID structured file id of chunk.
+type FilerFileID struct {
+	VolumeID uint32 `json:"volume_id"`
+	FileKey  uint64 `json:"file_key"`
+	Cookie   uint32 `json:"cookie"`
+}
+
+// FileIDString returns file id of chunk, formatted from structured file id if needed.
+func (c *FilerChunk) FileIDString() string {
+	if c.FileID != "" || c.Fid == nil {
+		return c.FileID
+	}
+
+	key := ""
+	if c.Fid.FileKey != 0 {
+		if key = fmt.Sprintf("%x", c.Fid.FileKey); len(key)%2 == 1 {
+			key = "0" + key
+		}
+	}
+	return fmt.Sprintf("%d,%s%08x", c.Fid.VolumeID, key, c.Fid.Cookie)
+}
+
+// IsCipher checks whether all chunks of entry are encrypted in cipher mode.
+func (e *FilerEntry) IsCipher() bool {
+	for _, chunk := range e.Chunks {
+		if len(chunk.CipherKey) == 0 {
+			return false
+		}
+	}
+	return len(e.Chunks) > 0
+}
+
+// GetEntry reads metadata of entry at path, including cipher keys of its chunks. Fails with ErrFileNotFound if there is no such entry.
+func (f *Filer) GetEntry(path string) (entry *FilerEntry, err error) {
+	return f.GetEntryContext(context.Background(), path)
+}
+
+// GetEntryContext is like GetEntry, with context ctx.
+func (f *Filer) GetEntryContext(ctx context.Context, path string) (entry *FilerEntry, err error) {
+	ctx, end := f.startCall(ctx, OpFilerGetEntry, path)
+	defer end(&err)
+
+	data, statusCode, err := f.client.get(ctx, OpFilerGetEntry, encodeURI(*f.base, path, url.Values{"metadata": []string{"true"}}), f.auth(false))
+	if err != nil {
+		return
+	}
+
+	switch {
+	case statusCode == http.StatusNotFound:
+		err = ErrFileNotFound
+	case statusCode >= http.StatusBadRequest:
+		err = &statusError{method: "GetEntry", url: path, status: http.StatusText(statusCode), code: statusCode}
+	default:
+		entry = &FilerEntry{}
+		if err = json.Unmarshal(data, entry); err != nil {
+			entry = nil
+		}
+	}
+
+	return
+}
+
+// verifyCipher checks that content of entry at path is encrypted in cipher mode, deleting the entry otherwise.
+func (f *Filer) verifyCipher(ctx context.Context, path string) error {
+	entry, err := f.GetEntryContext(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	if len(entry.Chunks) > 0 && !entry.IsCipher() {
+		f.client.warn("seaweedfs: delete of entry stored without cipher failed", f.DeleteContext(ctx, path, nil), "path", path)
+		return ErrCipherNotEnabled
+	}
+	return nil
+}
+
+// ReadEntry reads content of filer entry directly from volume servers into w, chunks are fetched concurrently.
+// Chunks encrypted in cipher mode are decrypted with their keys in entry. Newer chunks overwrite older ones,
+// content is truncated to file size of entry. Entries with chunk manifests are not supported.
+func (c *Seaweed) ReadEntry(entry *FilerEntry, w io.WriterAt, opts *ParallelDownloadOptions) (size int64, err error) {
+	return c.ReadEntryContext(context.Background(), entry, w, opts)
+}
+
+// ReadEntryContext is like ReadEntry, with context ctx.
+func (c *Seaweed) ReadEntryContext(ctx context.Context, entry *FilerEntry, w io.WriterAt, opts *ParallelDownloadOptions) (size int64, err error) {
+	ctx, end := c.startCall(ctx, OpReadEntry, attrFilerPath.String(entry.FullPath))
+	defer end(&err)
+
+	o := c.normalizeParallelDownloadOptions(opts)
+
+	progress := newProgressTracker(o.Progress, entry.FullPath, "", -1)
+	defer func() { progress.done(err) }()
+
+	if len(entry.Chunks) == 0 {
+		var n int
+		n, err = w.WriteAt(entry.Content, 0)
+		size = int64(n)
+		return
+	}
+
+	chunks := make([]*FilerChunk, len(entry.Chunks))
+	copy(chunks, entry.Chunks)
+	sort.SliceStable(chunks, func(i, j int) bool { return chunks[i].ModifiedTsNs < chunks[j].ModifiedTsNs })
+
+	tasks := make([]downloadTask, len(chunks))
+	for i, chunk := range chunks {
+		if chunk.IsChunkManifest {
+			return 0, fmt.Errorf("Entry %s has chunk manifests, which are not supported", entry.FullPath)
+		}
+
+		tasks[i] = downloadTask{
+			fileID:     chunk.FileIDString(),
+			offset:     chunk.Offset,
+			size:       chunk.Size,
+			chunk:      i,
+			cipherKey:  chunk.CipherKey,
+			compressed: chunk.IsCompressed && len(chunk.CipherKey) > 0, // otherwise volume server knows it is compressed
+		}
+
+		if end := chunk.Offset + chunk.Size; end > size {
+			size = end
+		}
+	}
+
+	if entry.FileSize > 0 {
+		size = entry.FileSize
+	}
+
+	if overlapping(chunks) { // newer chunks must be written last
+		o.Concurrency = 1
+	}
+
+	setSpanAttributes(ctx, attrBytes.Int64(size))
+	progress.setFile("", "", size)
+	err = c.runDownloadTasks(ctx, tasks, &truncatedWriterAt{w: w, size: size}, newLocationCache(c, o.Args), o, progress)
+	return
+}
+
+func overlapping(chunks []*FilerChunk) bool {
+	sorted := make([]*FilerChunk, len(chunks))
+	copy(sorted, chunks)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Offset < sorted[j].Offset })
+
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i-1].Offset+sorted[i-1].Size > sorted[i].Offset {
+			return true
+		}
+	}
+	return false
+}
+
+// truncatedWriterAt discards writes beyond size.
+type truncatedWriterAt struct {
+	w    io.WriterAt
+	size int64
+}
+
+func (t *truncatedWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	if off >= t.size {
+		return len(p), nil
+	}
+
+	n := len(p)
+	if off+int64(n) > t.size {
+		p = p[:t.size-off]
+	}
+	if _, err := t.w.WriteAt(p, off); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// entryPath returns path of uploaded entry, uploads to directory are named by filer.
+func entryPath(newPath, name string) string {
+	if strings.HasSuffix(newPath, "/") {
+		return newPath + name
+	}
+	return newPath
+}
@@ -1,40 +1,67 @@
 package goseaweedfs
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/textproto"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type httpClient struct {
-	client *http.Client
+	client  *http.Client
+	metrics Metrics
+	tracer  trace.Tracer
+	logger  *slog.Logger
 }
 
 func newHTTPClient(client *http.Client) *httpClient {
-	c := &httpClient{client: client}
+	c := &httpClient{client: client, tracer: otel.GetTracerProvider().Tracer(tracerName)}
 	return c
 }
 
+// clone copies client sharing underlying http client, so that tracer, metrics and logger of the copy are set independently.
+func (c *httpClient) clone() *httpClient {
+	cloned := *c
+	return &cloned
+}
+
 func (c *httpClient) Close() (err error) {
 	return
 }
 
-func (c *httpClient) get(url string, header map[string]string) (body []byte, statusCode int, err error) {
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+func (c *httpClient) get(ctx context.Context, op, url string, header map[string]string) (body []byte, statusCode int, err error) {
+	body, _, statusCode, err = c.getWithHeader(ctx, op, url, header)
+	return
+}
+
+// getWithHeader sends GET request, returning header of response too.
+func (c *httpClient) getWithHeader(ctx context.Context, op, url string, header map[string]string) (body []byte, respHeader http.Header, statusCode int, err error) {
+	start := time.Now()
+	ctx, span := c.startRequest(ctx, op, http.MethodGet, url)
+	defer func() { c.finishRequest(span, op, http.MethodGet, url, start, statusCode, 0, int64(len(body)), err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err == nil {
 		for k, v := range header {
 			req.Header.Set(k, v)
 		}
 
 		var resp *http.Response
-		resp, err = c.client.Do(req)
+		resp, err = c.do(req)
 		if err == nil {
+			respHeader = resp.Header
 			body, statusCode, err = readAll(resp)
 		}
 	}
@@ -42,18 +69,55 @@ func (c *httpClient) get(url string, header map[string]string) (body []byte, sta
 	return
 }
 
-func (c *httpClient) delete(url string) (statusCode int, err error) {
-	req, err := http.NewRequest(http.MethodDelete, url, nil)
+func (c *httpClient) head(ctx context.Context, op, url string, opts *DownloadOptions) (resp *DownloadResponse, err error) {
+	start := time.Now()
+	statusCode := 0
+	ctx, span := c.startRequest(ctx, op, http.MethodHead, url)
+	defer func() { c.finishRequest(span, op, http.MethodHead, url, start, statusCode, 0, 0, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return
+	}
+	req.Header = opts.header()
+
+	r, err := c.do(req)
+	if err == nil {
+		c.drainAndClose(r)
+		statusCode = r.StatusCode
+
+		switch r.StatusCode {
+		case http.StatusOK, http.StatusPartialContent, http.StatusNotModified:
+			resp = newDownloadResponse(r)
+		default:
+			err = &statusError{method: "Head", url: url, status: r.Status, code: r.StatusCode}
+		}
+	}
+
+	return
+}
+
+func (c *httpClient) delete(ctx context.Context, op, url string, header map[string]string) (statusCode int, err error) {
+	start := time.Now()
+	var received int64
+	ctx, span := c.startRequest(ctx, op, http.MethodDelete, url)
+	defer func() { c.finishRequest(span, op, http.MethodDelete, url, start, statusCode, 0, received, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
 	if err != nil {
 		return
 	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
 
-	r, err := c.client.Do(req)
+	r, err := c.do(req)
 	if err != nil {
 		return
 	}
 
 	body, statusCode, err := readAll(r)
+	received = int64(len(body))
 	if err == nil {
 		switch r.StatusCode {
 		case http.StatusNoContent, http.StatusNotFound, http.StatusAccepted, http.StatusOK:
@@ -75,34 +139,95 @@ func (c *httpClient) delete(url string) (statusCode int, err error) {
 	return
 }
 
-func (c *httpClient) download(url string, callback func(io.Reader) error) (filename string, err error) {
-	r, err := c.client.Get(url)
+func (c *httpClient) downloadWithOptions(ctx context.Context, op, url string, opts *DownloadOptions, callback func(*DownloadResponse, io.Reader) error) (resp *DownloadResponse, err error) {
+	r, err := c.openDownload(ctx, op, url, opts)
 	if err == nil {
-		if r.StatusCode != http.StatusOK {
-			drainAndClose(r.Body)
-			err = fmt.Errorf("Download %s but error. Status:%s", url, r.Status)
-			return
+		resp, err = c.consumeDownload(r, callback)
+	}
+	return
+}
+
+// openDownload sends download request. Response is returned only with 2xx or 304 status, caller must consume it.
+// Compressed content is decompressed unless raw content is requested.
+// Request span ends and request is reported to metrics when response body is closed.
+func (c *httpClient) openDownload(ctx context.Context, op, url string, opts *DownloadOptions) (r *http.Response, err error) {
+	start := time.Now()
+	ctx, span := c.startRequest(ctx, op, http.MethodGet, url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		c.finishRequest(span, op, http.MethodGet, url, start, 0, 0, 0, err)
+		return
+	}
+	req.Header = opts.header()
+	if encoding := opts.acceptEncoding(); encoding != "" && req.Header.Get("Accept-Encoding") == "" {
+		req.Header.Set("Accept-Encoding", encoding)
+	}
+
+	statusCode := 0
+	if r, err = c.do(req); err == nil {
+		statusCode = r.StatusCode
+		switch r.StatusCode {
+		case http.StatusOK, http.StatusPartialContent, http.StatusNotModified:
+		default:
+			c.drainAndClose(r)
+			err = &statusError{method: "Download", url: url, status: r.Status, code: r.StatusCode}
+			r = nil
 		}
+	}
 
-		contentDisposition := r.Header["Content-Disposition"]
-		if len(contentDisposition) > 0 {
-			if strings.HasPrefix(contentDisposition[0], "filename=") {
-				filename = contentDisposition[0][len("filename="):]
-				filename = strings.Trim(filename, "\"")
-			}
+	if err != nil {
+		c.finishRequest(span, op, http.MethodGet, url, start, statusCode, 0, 0, err)
+	} else {
+		r.Body = &meteredBody{ReadCloser: r.Body, onClose: func(received int64, err error) {
+			c.finishRequest(span, op, http.MethodGet, url, start, statusCode, 0, received, err)
+		}}
+
+		if err = decodeContent(r, opts.rawContent()); err != nil {
+			c.drainAndClose(r)
+			r = nil
 		}
+	}
 
-		// execute callback
-		err = callback(r.Body)
+	return
+}
+
+// consumeDownload executes callback on response body, then drains and closes it. Callback is not called if content is not modified.
+func (c *httpClient) consumeDownload(r *http.Response, callback func(*DownloadResponse, io.Reader) error) (resp *DownloadResponse, err error) {
+	resp = newDownloadResponse(r)
 
-		// drain and close body
-		drainAndClose(r.Body)
+	// execute callback
+	if !resp.NotModified {
+		err = callback(resp, r.Body)
 	}
 
+	// drain and close body
+	c.drainAndClose(r)
+
 	return
 }
 
-func (c *httpClient) upload(url string, filename string, fileReader io.Reader, mtype string) (respBody []byte, statusCode int, err error) {
+// statusError unexpected response status.
+type statusError struct {
+	method string
+	url    string
+	status string
+	code   int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s %s but error. Status:%s", e.method, e.url, e.status)
+}
+
+// upload posts content as multipart form file. Content-Encoding of header is of file content, it is sent in header of file part.
+func (c *httpClient) upload(ctx context.Context, op, url string, filename string, fileReader io.Reader, mtype string, header map[string]string) (respBody []byte, statusCode int, err error) {
+	start := time.Now()
+	counter := &countingReader{r: fileReader}
+	ctx, span := c.startRequest(ctx, op, http.MethodPost, url)
+	defer func() {
+		c.finishRequest(span, op, http.MethodPost, url, start, statusCode, counter.count(), int64(len(respBody)), err)
+	}()
+
 	r, w := io.Pipe()
 
 	// create multipart writer
@@ -118,10 +243,13 @@ func (c *httpClient) upload(url string, filename string, fileReader io.Reader, m
 		if mtype != "" {
 			h.Set("Content-Type", mtype)
 		}
+		if encoding := header["Content-Encoding"]; encoding != "" {
+			h.Set("Content-Encoding", encoding)
+		}
 
 		part, err := mw.CreatePart(h)
 		if err == nil {
-			_, err = io.Copy(part, fileReader)
+			_, err = io.Copy(part, counter)
 		}
 
 		if err == nil {
@@ -139,7 +267,16 @@ func (c *httpClient) upload(url string, filename string, fileReader io.Reader, m
 	}()
 
 	var resp *http.Response
-	resp, err = c.client.Post(url, mw.FormDataContentType(), r)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, r)
+	if err == nil {
+		for k, v := range header {
+			if k != "Content-Encoding" {
+				req.Header.Set(k, v)
+			}
+		}
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		resp, err = c.do(req)
+	}
 
 	// closing reader in case Posting error.
 	// This causes pipe writer fail to write and stop above task.
@@ -153,3 +290,26 @@ func (c *httpClient) upload(url string, filename string, fileReader io.Reader, m
 
 	return
 }
+
+func (c *httpClient) post(ctx context.Context, op, url, contentType string, data []byte, header map[string]string) (body []byte, statusCode int, err error) {
+	start := time.Now()
+	ctx, span := c.startRequest(ctx, op, http.MethodPost, url)
+	defer func() {
+		c.finishRequest(span, op, http.MethodPost, url, start, statusCode, int64(len(data)), int64(len(body)), err)
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err == nil {
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		req.Header.Set("Content-Type", contentType)
+
+		var resp *http.Response
+		if resp, err = c.do(req); err == nil {
+			body, statusCode, err = readAll(resp)
+		}
+	}
+
+	return
+}
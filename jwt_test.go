@@ -0,0 +1,138 @@
+package goseaweedfs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestJWTSign(t *testing.T) {
+	cfg := &JWTConfig{WriteKey: "secret", ExpiresAfter: time.Minute}
+
+	token := cfg.writeToken("3,01")
+	parts := strings.Split(token, ".")
+	require.Equal(t, 3, len(parts))
+
+	mac := hmac.New(sha256.New, []byte("secret"))
+	_, _ = mac.Write([]byte(parts[0] + "." + parts[1]))
+	require.Equal(t, base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), parts[2])
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	require.Nil(t, err)
+
+	var claims jwtClaims
+	require.Nil(t, json.Unmarshal(payload, &claims))
+	require.Equal(t, "3,01", claims.Fid)
+	require.Greater(t, claims.ExpiresAt, time.Now().Unix())
+
+	// no key, no token
+	require.Equal(t, "", cfg.readToken("3,01"))
+	require.Equal(t, "", (*JWTConfig)(nil).writeToken("3,01"))
+}
+
+func TestJWTUploadAndDelete(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		headers = make(map[string]string)
+	)
+
+	volume := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers[r.Method] = r.Header.Get("Authorization")
+		mu.Unlock()
+		fmt.Fprint(w, `{"size":5}`)
+	}))
+	defer volume.Close()
+	u, _ := url.Parse(volume.URL)
+
+	master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dir/assign":
+			fmt.Fprintf(w, `{"fid":"3,01","url":"%s","publicUrl":"%s","count":1,"auth":"issued"}`, u.Host, u.Host)
+		case "/dir/lookup":
+			fmt.Fprintf(w, `{"locations":[{"url":"%s","publicUrl":"%s"}]}`, u.Host, u.Host)
+		}
+	}))
+	defer master.Close()
+
+	c, err := NewSeaweed(master.URL, nil, 0, http.DefaultClient)
+	require.Nil(t, err)
+	c.SetJWT(JWTConfig{WriteKey: "secret"})
+
+	_, err = c.Upload(strings.NewReader("hello"), "a.txt", 5, "", "")
+	require.Nil(t, err)
+	require.Equal(t, "BEARER issued", headers[http.MethodPost])
+
+	require.Nil(t, c.DeleteFile("3,01", nil))
+	require.True(t, strings.HasPrefix(headers[http.MethodDelete], "BEARER "))
+	require.NotEqual(t, "BEARER issued", headers[http.MethodDelete])
+}
+
+func TestJWTIssuedTokens(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		headers = make(map[string]string) // by method and file id
+	)
+
+	volume := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		fid := r.URL.Path[1:]
+		headers[r.Method+" "+fid] = r.Header.Get("Authorization")
+		if r.Method == http.MethodPost && fid == "3,04" { // third chunk fails
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"size":10}`)
+	}))
+	defer volume.Close()
+	u, _ := url.Parse(volume.URL)
+
+	var seq int32
+	master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		switch r.URL.Path {
+		case "/dir/assign":
+			seq++
+			fmt.Fprintf(w, `{"fid":"3,%02x","url":"%s","publicUrl":"%s","count":1,"auth":"assigned-%02x"}`, seq, u.Host, u.Host, seq)
+		case "/dir/lookup":
+			if fid := r.URL.Query().Get(ParamLookupFileID); fid != "" {
+				w.Header().Set("Authorization", "BEARER looked-up-"+fid)
+			}
+			fmt.Fprintf(w, `{"locations":[{"url":"%s","publicUrl":"%s"}]}`, u.Host, u.Host)
+		}
+	}))
+	defer master.Close()
+
+	// client has no key, master issues tokens
+	c, err := NewSeaweed(master.URL, nil, 10, http.DefaultClient)
+	require.Nil(t, err)
+
+	require.Nil(t, c.DeleteFile("3,0a", nil))
+	require.Equal(t, "BEARER looked-up-3,0a", headers["DELETE 3,0a"])
+
+	require.Nil(t, c.Replace("3,0b", strings.NewReader("hello"), "a.txt", 5, "", "", false))
+	require.Equal(t, "BEARER looked-up-3,0b", headers["POST 3,0b"])
+
+	// rollback of chunked upload deletes uploaded chunks with tokens issued on assign
+	_, err = c.Upload(strings.NewReader(strings.Repeat("x", 25)), "big.txt", 25, "", "")
+	require.NotNil(t, err)
+	require.Equal(t, "BEARER assigned-02", headers["DELETE 3,02"])
+	require.Equal(t, "BEARER assigned-03", headers["DELETE 3,03"])
+	_, ok := headers["DELETE 3,04"]
+	require.False(t, ok)
+}
@@ -0,0 +1,138 @@
+package goseaweedfs
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+const topologyRefreshInterval = time.Minute
+
+// Locality location of client in cluster topology.
+type Locality struct {
+	DataCenter string
+	Rack       string
+}
+
+// IsZero reports whether locality is not set.
+func (l Locality) IsZero() bool {
+	return l.DataCenter == "" && l.Rack == ""
+}
+
+// SetLocality sets location of client. Assigns without explicit data center/rack/data node prefer local
+// rack and data center, falling back to remote ones when master can not assign locally. Reads prefer local
+// replicas unless a custom read selector is set. Must be called before using client.
+func (c *Seaweed) SetLocality(l Locality) {
+	c.locality, c.localSelector, c.topology = l, nil, nil
+	if !l.IsZero() {
+		c.localSelector = NewLocalitySelector(l.DataCenter, l.Rack)
+	}
+	if l.Rack != "" {
+		c.topology = newTopologyCache(c)
+	}
+}
+
+// localityCandidates returns assign options to try in order: local rack, local data center, anywhere.
+func (c *Seaweed) localityCandidates(opts *AssignOptions) []*AssignOptions {
+	if c.locality.IsZero() || (opts != nil && (opts.DataCenter != "" || opts.Rack != "" || opts.DataNode != "")) {
+		return []*AssignOptions{opts}
+	}
+
+	candidates := make([]*AssignOptions, 0, 3)
+	if c.locality.Rack != "" {
+		local := opts.clone()
+		local.DataCenter, local.Rack = c.locality.DataCenter, c.locality.Rack
+		candidates = append(candidates, local)
+	}
+	if c.locality.DataCenter != "" {
+		local := opts.clone()
+		local.DataCenter = c.locality.DataCenter
+		candidates = append(candidates, local)
+	}
+
+	return append(candidates, opts)
+}
+
+// canFallbackAssign reports whether assign error could be resolved by assigning in other location.
+// Transport errors are not since master is not reachable anyway.
+func canFallbackAssign(err error) bool {
+	var ne net.Error
+	return err != nil && !errors.As(err, &ne)
+}
+
+// resolveLocality fills data center and rack of locations from cluster topology.
+func (c *Seaweed) resolveLocality(locations VolumeLocations) {
+	if c.topology == nil {
+		return
+	}
+
+	for _, loc := range locations {
+		if node, ok := c.topology.get(loc.URL); ok {
+			if loc.DataCenter == "" {
+				loc.DataCenter = node.DataCenter
+			}
+			loc.Rack = node.Rack
+		}
+	}
+}
+
+// topologyCache maps data nodes' urls to their locality, refreshed periodically from master status.
+type topologyCache struct {
+	c *Seaweed
+
+	mu         sync.RWMutex
+	nodes      map[string]Locality
+	refreshed  time.Time
+	refreshing bool
+}
+
+func newTopologyCache(c *Seaweed) *topologyCache {
+	return &topologyCache{c: c}
+}
+
+func (t *topologyCache) get(url string) (node Locality, ok bool) {
+	t.refreshIfStale()
+
+	t.mu.RLock()
+	node, ok = t.nodes[url]
+	t.mu.RUnlock()
+
+	return
+}
+
+// refreshIfStale refreshes topology synchronously. Concurrent callers do not wait but use current data.
+func (t *topologyCache) refreshIfStale() {
+	t.mu.Lock()
+	if t.refreshing || time.Since(t.refreshed) < topologyRefreshInterval {
+		t.mu.Unlock()
+		return
+	}
+	t.refreshing = true
+	t.mu.Unlock()
+
+	status, err := t.c.Status()
+
+	t.mu.Lock()
+	if err == nil {
+		t.nodes = topologyLocalities(&status.Topology)
+	}
+	t.refreshed, t.refreshing = time.Now(), false
+	t.mu.Unlock()
+}
+
+func topologyLocalities(topo *Topology) map[string]Locality {
+	nodes := make(map[string]Locality)
+	for _, dc := range topo.DataCenters {
+		for _, rack := range dc.Racks {
+			for _, node := range rack.DataNodes {
+				locality := Locality{DataCenter: dc.ID, Rack: rack.ID}
+				nodes[node.URL] = locality
+				if node.PublicURL != "" {
+					nodes[node.PublicURL] = locality
+				}
+			}
+		}
+	}
+	return nodes
+}
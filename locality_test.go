@@ -0,0 +1,80 @@
+package goseaweedfs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocality(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		assigns []string
+	)
+
+	master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dir/assign":
+			q := r.URL.Query()
+			mu.Lock()
+			assigns = append(assigns, q.Get(ParamAssignDataCenter)+"/"+q.Get(ParamAssignRack))
+			mu.Unlock()
+
+			if q.Get(ParamAssignRack) != "" {
+				fmt.Fprint(w, `{"error":"No more writable volumes in rack"}`)
+				return
+			}
+			fmt.Fprint(w, `{"fid":"3,01","url":"b:8080","publicUrl":"b:8080","count":1}`)
+
+		case "/dir/status":
+			_ = json.NewEncoder(w).Encode(SystemStatus{Topology: Topology{DataCenters: []*DataCenter{
+				{ID: "dc1", Racks: []*Rack{
+					{ID: "r1", DataNodes: []*DataNode{{URL: "a:8080", PublicURL: "a:8080"}}},
+					{ID: "r2", DataNodes: []*DataNode{{URL: "b:8080", PublicURL: "b:8080"}}},
+				}},
+				{ID: "dc2", Racks: []*Rack{
+					{ID: "r1", DataNodes: []*DataNode{{URL: "c:8080", PublicURL: "c:8080"}}},
+				}},
+			}}})
+
+		case "/dir/lookup":
+			fmt.Fprint(w, `{"locations":[{"url":"c:8080","publicUrl":"c:8080"},{"url":"a:8080","publicUrl":"a:8080"},{"url":"b:8080","publicUrl":"b:8080"}]}`)
+		}
+	}))
+	defer master.Close()
+
+	c, err := NewSeaweed(master.URL, nil, 0, http.DefaultClient)
+	require.Nil(t, err)
+	c.SetLocality(Locality{DataCenter: "dc1", Rack: "r2"})
+
+	// local rack is out of capacity, falls back to local data center
+	result, err := c.AssignWithOptions(nil)
+	require.Nil(t, err)
+	require.Equal(t, "3,01", result.FileID)
+	require.Equal(t, []string{"dc1/r2", "dc1/"}, assigns)
+
+	// explicit location is not overridden
+	assigns = nil
+	_, err = c.AssignWithOptions(&AssignOptions{DataCenter: "dc2"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"dc2/"}, assigns)
+
+	// reads prefer local rack, then local data center
+	for i := 0; i < 5; i++ {
+		server, err := c.LookupServerByFileID("3,01", nil, true)
+		require.Nil(t, err)
+		require.Equal(t, "b:8080", server)
+	}
+
+	locations, err := c.lookupLocations(context.Background(), "3,01", nil)
+	require.Nil(t, err)
+	locations = c.selectForRead("3,01", locations)
+	require.Equal(t, "a:8080", locations[1].URL)
+	require.Equal(t, "dc2", locations[2].DataCenter)
+}
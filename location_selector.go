@@ -0,0 +1,222 @@
+package goseaweedfs
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LocationSelector orders locations of a volume by preference for a request. The first location is requested first,
+// the others are used for failover. Implementations must be safe for concurrent use and must not modify input.
+type LocationSelector interface {
+	Select(fileID string, locations VolumeLocations) VolumeLocations
+}
+
+// LocationFeedback is optionally implemented by read selectors which learn from requests' outcome.
+// Server is location's public url used for the request.
+type LocationFeedback interface {
+	// Begin is called before sending request to server.
+	Begin(server string)
+
+	// Done is called when request to server completed. Latency is time to response header.
+	Done(server string, latency time.Duration, err error)
+}
+
+// SetLocationSelectors sets selectors of locations for reads and writes. Nil selector means default one:
+// locality (if client locality is set) or random for reads, first location for writes. Must be called before using client.
+func (c *Seaweed) SetLocationSelectors(read, write LocationSelector) {
+	c.readSelector, c.writeSelector = read, write
+}
+
+func (c *Seaweed) selectForRead(fileID string, locations VolumeLocations) VolumeLocations {
+	if c.readSelector == nil {
+		if c.localSelector != nil {
+			return c.localSelector.Select(fileID, locations)
+		}
+		return RandomSelector.Select(fileID, locations)
+	}
+	return c.readSelector.Select(fileID, locations)
+}
+
+func (c *Seaweed) selectForWrite(fileID string, locations VolumeLocations) VolumeLocations {
+	if c.writeSelector == nil {
+		return HeadSelector.Select(fileID, locations)
+	}
+	return c.writeSelector.Select(fileID, locations)
+}
+
+var (
+	// RandomSelector orders locations randomly.
+	RandomSelector LocationSelector = randomSelector{}
+
+	// HeadSelector keeps order of locations responded by master.
+	HeadSelector LocationSelector = headSelector{}
+)
+
+type randomSelector struct{}
+
+func (randomSelector) Select(_ string, locations VolumeLocations) VolumeLocations {
+	return shuffleLocations(locations)
+}
+
+type headSelector struct{}
+
+func (headSelector) Select(_ string, locations VolumeLocations) VolumeLocations {
+	return locations
+}
+
+// NewLocalitySelector creates selector preferring locations in the same rack, then the same data center as client.
+// Locations in the same group are ordered randomly.
+func NewLocalitySelector(dataCenter, rack string) LocationSelector {
+	return &localitySelector{dataCenter: dataCenter, rack: rack}
+}
+
+type localitySelector struct {
+	dataCenter string
+	rack       string
+}
+
+func (s *localitySelector) Select(_ string, locations VolumeLocations) VolumeLocations {
+	selected := shuffleLocations(locations)
+	sort.SliceStable(selected, func(i, j int) bool {
+		return s.distance(selected[i]) < s.distance(selected[j])
+	})
+	return selected
+}
+
+func (s *localitySelector) distance(loc *VolumeLocation) int {
+	if s.dataCenter == "" || loc.DataCenter != s.dataCenter {
+		return 2
+	}
+	if s.rack == "" || loc.Rack != s.rack {
+		return 1
+	}
+	return 0
+}
+
+// NewLeastOutstandingSelector creates selector preferring locations with least in-flight requests from this client.
+func NewLeastOutstandingSelector() LocationSelector {
+	return &leastOutstandingSelector{outstanding: make(map[string]int)}
+}
+
+type leastOutstandingSelector struct {
+	mu          sync.Mutex
+	outstanding map[string]int
+}
+
+func (s *leastOutstandingSelector) Select(_ string, locations VolumeLocations) VolumeLocations {
+	selected := shuffleLocations(locations)
+
+	s.mu.Lock()
+	sort.SliceStable(selected, func(i, j int) bool {
+		return s.outstanding[selected[i].PublicURL] < s.outstanding[selected[j].PublicURL]
+	})
+	s.mu.Unlock()
+
+	return selected
+}
+
+func (s *leastOutstandingSelector) Begin(server string) {
+	s.mu.Lock()
+	s.outstanding[server]++
+	s.mu.Unlock()
+}
+
+func (s *leastOutstandingSelector) Done(server string, _ time.Duration, _ error) {
+	s.mu.Lock()
+	if s.outstanding[server]--; s.outstanding[server] <= 0 {
+		delete(s.outstanding, server)
+	}
+	s.mu.Unlock()
+}
+
+const (
+	defaultLatencyDecay = 0.3
+
+	// latencyErrorPenalty is added to latency of failed requests.
+	latencyErrorPenalty = time.Second
+)
+
+// NewLatencySelector creates selector preferring locations with lowest EWMA latency. Decay in (0, 1] is weight
+// of the newest sample, default is 0.3. Locations without samples are preferred so that they get measured.
+func NewLatencySelector(decay float64) LocationSelector {
+	if decay <= 0 || decay > 1 {
+		decay = defaultLatencyDecay
+	}
+	return &latencySelector{decay: decay, ewma: make(map[string]float64)}
+}
+
+type latencySelector struct {
+	decay float64
+
+	mu   sync.Mutex
+	ewma map[string]float64
+}
+
+func (s *latencySelector) Select(_ string, locations VolumeLocations) VolumeLocations {
+	selected := shuffleLocations(locations)
+
+	s.mu.Lock()
+	sort.SliceStable(selected, func(i, j int) bool {
+		return s.ewma[selected[i].PublicURL] < s.ewma[selected[j].PublicURL]
+	})
+	s.mu.Unlock()
+
+	return selected
+}
+
+func (s *latencySelector) Begin(string) {}
+
+func (s *latencySelector) Done(server string, latency time.Duration, err error) {
+	if errors.Is(err, context.Canceled) { // cancelled hedged request says nothing about server
+		return
+	}
+
+	sample := float64(latency)
+	if err != nil {
+		sample += float64(latencyErrorPenalty)
+	}
+
+	s.mu.Lock()
+	if v, ok := s.ewma[server]; ok {
+		s.ewma[server] = v + s.decay*(sample-v)
+	} else {
+		s.ewma[server] = sample
+	}
+	s.mu.Unlock()
+}
+
+// ConsistentHashSelector orders locations by rendezvous hashing of file id, so that a file is always read
+// from the same replica while it is available. This improves cache hit ratio of volume servers.
+var ConsistentHashSelector LocationSelector = consistentHashSelector{}
+
+type consistentHashSelector struct{}
+
+func (consistentHashSelector) Select(fileID string, locations VolumeLocations) VolumeLocations {
+	scores := make(map[*VolumeLocation]uint64, len(locations))
+	for _, loc := range locations {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(loc.URL))
+		_, _ = h.Write([]byte{'/'})
+		_, _ = h.Write([]byte(fileID))
+		scores[loc] = h.Sum64()
+	}
+
+	selected := append(VolumeLocations(nil), locations...)
+	sort.Slice(selected, func(i, j int) bool {
+		return scores[selected[i]] > scores[selected[j]]
+	})
+	return selected
+}
+
+func shuffleLocations(locations VolumeLocations) VolumeLocations {
+	shuffled := append(VolumeLocations(nil), locations...)
+	rand.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	return shuffled
+}
@@ -0,0 +1,82 @@
+package goseaweedfs
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testLocations() VolumeLocations {
+	return VolumeLocations{
+		{URL: "a:8080", PublicURL: "a:8080", DataCenter: "dc1", Rack: "r1"},
+		{URL: "b:8080", PublicURL: "b:8080", DataCenter: "dc1", Rack: "r2"},
+		{URL: "c:8080", PublicURL: "c:8080", DataCenter: "dc2", Rack: "r1"},
+	}
+}
+
+func TestLocalitySelector(t *testing.T) {
+	locations := testLocations()
+
+	selected := NewLocalitySelector("dc1", "r2").Select("3,01", locations)
+	require.Equal(t, "b:8080", selected[0].URL)
+	require.Equal(t, "a:8080", selected[1].URL)
+	require.Equal(t, "c:8080", selected[2].URL)
+
+	selected = NewLocalitySelector("dc2", "").Select("3,01", locations)
+	require.Equal(t, "c:8080", selected[0].URL)
+
+	// input is not modified
+	require.Equal(t, testLocations(), locations)
+}
+
+func TestLeastOutstandingSelector(t *testing.T) {
+	s := NewLeastOutstandingSelector()
+	fb := s.(LocationFeedback)
+
+	fb.Begin("a:8080")
+	fb.Begin("b:8080")
+	fb.Begin("b:8080")
+	require.Equal(t, "c:8080", s.Select("3,01", testLocations())[0].URL)
+
+	fb.Begin("c:8080")
+	fb.Begin("c:8080")
+	fb.Begin("c:8080")
+	require.Equal(t, "a:8080", s.Select("3,01", testLocations())[0].URL)
+
+	fb.Done("b:8080", 0, nil)
+	fb.Done("b:8080", 0, nil)
+	require.Equal(t, "b:8080", s.Select("3,01", testLocations())[0].URL)
+}
+
+func TestLatencySelector(t *testing.T) {
+	s := NewLatencySelector(0.5)
+	fb := s.(LocationFeedback)
+
+	fb.Done("a:8080", 10*time.Millisecond, nil)
+	fb.Done("b:8080", 5*time.Millisecond, nil)
+	fb.Done("c:8080", time.Millisecond, errors.New("broken"))
+
+	selected := s.Select("3,01", testLocations())
+	require.Equal(t, "b:8080", selected[0].URL)
+	require.Equal(t, "a:8080", selected[1].URL)
+	require.Equal(t, "c:8080", selected[2].URL)
+}
+
+func TestConsistentHashSelector(t *testing.T) {
+	first := ConsistentHashSelector.Select("3,01", testLocations())[0].URL
+	for i := 0; i < 10; i++ {
+		require.Equal(t, first, ConsistentHashSelector.Select("3,01", testLocations())[0].URL)
+	}
+
+	// removing another replica does not change selection
+	locations := testLocations()
+	for i := range locations {
+		if locations[i].URL != first {
+			locations = append(locations[:i], locations[i+1:]...)
+			break
+		}
+	}
+	require.Equal(t, first, ConsistentHashSelector.Select("3,01", locations)[0].URL)
+}
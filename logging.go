@@ -0,0 +1,70 @@
+package goseaweedfs
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// SetLogger sets logger of client and its filers. Requests are logged at debug level, failures of cleanups
+// which do not fail operations (e.g: rollbacks of uploaded chunks) at warn level. Auth tokens are redacted.
+// Nil disables logging. Must be called before using client.
+func (c *Seaweed) SetLogger(l *slog.Logger) {
+	c.client.logger = l
+	for _, f := range c.filers {
+		f.SetLogger(l)
+	}
+}
+
+// SetLogger sets logger of filer only. See Seaweed.SetLogger.
+func (f *Filer) SetLogger(l *slog.Logger) {
+	f.client.logger = l
+}
+
+func (c *httpClient) logRequest(op, method, rawURL string, latency time.Duration, statusCode int, sent, received int64, err error) {
+	if c.logger == nil || !c.logger.Enabled(context.Background(), slog.LevelDebug) {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("op", op),
+		slog.String("method", method),
+		slog.String("url", redact(rawURL)),
+		slog.Int("status", statusCode),
+		slog.Int64("sent", sent),
+		slog.Int64("received", received),
+		slog.Duration("latency", latency),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", redact(err.Error())))
+	}
+
+	c.logger.LogAttrs(context.Background(), slog.LevelDebug, "seaweedfs request", attrs...)
+}
+
+// warn logs failure which is not returned to caller.
+func (c *httpClient) warn(msg string, err error, args ...interface{}) {
+	if c.logger != nil && err != nil {
+		c.logger.Warn(msg, append(args, "error", redact(err.Error()))...)
+	}
+}
+
+// drainAndClose drains and closes response body, logging failure.
+func (c *httpClient) drainAndClose(r *http.Response) {
+	if err := drainAndClose(r.Body); err != nil {
+		c.warn("seaweedfs: drain response body failed", err, "url", redact(r.Request.URL.String()))
+	}
+}
+
+var (
+	redactBearer = regexp.MustCompile(`(?i)(bearer\s+)[^\s"',]+`)
+	redactQuery  = regexp.MustCompile(`(?i)([?&](?:jwt|auth|token)=)[^&\s"']+`)
+)
+
+// redact hides auth tokens in urls, headers and error messages.
+func redact(s string) string {
+	s = redactBearer.ReplaceAllString(s, "${1}REDACTED")
+	return redactQuery.ReplaceAllString(s, "${1}REDACTED")
+}
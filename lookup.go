@@ -4,8 +4,12 @@ import "math/rand"
 
 // VolumeLocation location of volume responsed from master API. According to https://github.com/chrislusf/seaweedfs/wiki/Master-Server-API
 type VolumeLocation struct {
-	URL       string `json:"url,omitempty"`
-	PublicURL string `json:"publicUrl,omitempty"`
+	URL        string `json:"url,omitempty"`
+	PublicURL  string `json:"publicUrl,omitempty"`
+	DataCenter string `json:"dataCenter,omitempty"`
+
+	// Rack is not responded by master lookup API, it is resolved by client from topology if locality is configured.
+	Rack string `json:"rack,omitempty"`
 }
 
 // VolumeLocations returned VolumeLocations (volumes)
@@ -0,0 +1,104 @@
+package goseaweedfs
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	masterRetryDelay    = 100 * time.Millisecond
+	masterRetryMaxDelay = 2 * time.Second
+)
+
+// masterList masters of cluster.
+type masterList struct {
+	urls []*url.URL
+	idx  uint32
+}
+
+// currentMaster returns master which requests are sent to.
+func (c *Seaweed) currentMaster() *url.URL {
+	m := c.masters
+	return m.urls[atomic.LoadUint32(&m.idx)%uint32(len(m.urls))]
+}
+
+// nextMaster switches to next master after request to failed one.
+func (c *Seaweed) nextMaster(failed *url.URL) {
+	m := c.masters
+	idx := atomic.LoadUint32(&m.idx)
+	if m.urls[idx%uint32(len(m.urls))] == failed {
+		atomic.CompareAndSwapUint32(&m.idx, idx, idx+1)
+	}
+}
+
+// masterGet sends GET request to master. On connection errors and 5xx responses, request is retried
+// on next masters, at least once for each master. Once all masters failed, retries back off exponentially.
+// 5xx response of last attempt is returned as error.
+func (c *Seaweed) masterGet(ctx context.Context, op, path string, args url.Values) (body []byte, statusCode int, err error) {
+	body, _, statusCode, err = c.masterGetWithHeader(ctx, op, path, args)
+	return
+}
+
+// masterGetWithHeader is masterGet returning header of response too.
+func (c *Seaweed) masterGetWithHeader(ctx context.Context, op, path string, args url.Values) (body []byte, header http.Header, statusCode int, err error) {
+	attempts := c.retries + 1
+	if attempts < len(c.masters.urls) {
+		attempts = len(c.masters.urls)
+	}
+
+	var masterURL string
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			if err = c.waitMasterRetry(ctx, i); err != nil {
+				return
+			}
+		}
+
+		master := c.currentMaster()
+		masterURL = encodeURI(*master, path, args)
+		if body, header, statusCode, err = c.client.getWithHeader(ctx, op, masterURL, nil); err == nil && statusCode < http.StatusInternalServerError {
+			return
+		}
+		c.nextMaster(master)
+
+		if i+1 < attempts && ctx.Err() == nil {
+			observeRetry(c.metrics, op, master.Host)
+		}
+	}
+
+	if err == nil {
+		err = &statusError{method: "Get", url: masterURL, status: http.StatusText(statusCode), code: statusCode}
+	}
+	return
+}
+
+// waitMasterRetry waits before attempt of master request. Failing over to next master is immediate, rounds over
+// all masters are delayed exponentially. Error of ctx is returned if it is done.
+func (c *Seaweed) waitMasterRetry(ctx context.Context, attempt int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	round := attempt / len(c.masters.urls)
+	if attempt%len(c.masters.urls) != 0 || round == 0 {
+		return nil
+	}
+
+	delay := masterRetryDelay << (round - 1)
+	if delay <= 0 || delay > masterRetryMaxDelay {
+		delay = masterRetryMaxDelay
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
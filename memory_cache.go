@@ -0,0 +1,446 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	defaultMemoryCacheSize       = 16 << 20
+	defaultMemoryCacheObjectSize = 4 << 10
+	defaultMemoryCacheTTL        = time.Minute
+
+	// memoryCacheFetchTimeout timeout of fetch shared by concurrent loads, which is detached from their contexts.
+	memoryCacheFetchTimeout = time.Minute
+)
+
+// CacheMetrics is optionally implemented by Metrics to observe lookups of in-memory cache.
+type CacheMetrics interface {
+	// ObserveCache is called on lookup of cached content by operation, e.g: OpDownload, OpFilerGet.
+	ObserveCache(op string, hit bool)
+}
+
+func observeCache(m Metrics, op string, hit bool) {
+	if cm, ok := m.(CacheMetrics); ok {
+		cm.ObserveCache(op, hit)
+	}
+}
+
+// MemoryCacheOptions options of in-memory cache.
+type MemoryCacheOptions struct {
+	// MaxSize max total size of cached objects in bytes. Default: 16MiB.
+	MaxSize int64
+
+	// MaxObjectSize objects larger than this are not cached. Default: 4KiB.
+	MaxObjectSize int64
+
+	// TTL time to live of cached objects. Default: 1 minute.
+	TTL time.Duration
+}
+
+// MemoryCacheStats statistics of in-memory cache.
+type MemoryCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Len       int
+	Size      int64
+}
+
+// HitRatio returns ratio of lookups served from cache, zero if there were none.
+func (s MemoryCacheStats) HitRatio() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+// MemoryCache size-bounded LRU cache of small objects in memory, e.g: thumbnails and config blobs. Cached objects
+// expire after TTL. Concurrent fetches of the same object are coalesced into one request.
+//
+// MemoryCache is safe for concurrent use.
+type MemoryCache struct {
+	maxSize       int64
+	maxObjectSize int64
+	ttl           time.Duration
+
+	mu    sync.Mutex
+	size  int64
+	lru   *list.List               // of *memoryCacheItem, most recently used first
+	items map[string]*list.Element // by key
+
+	// variants keys of cached objects by key without args, objects read with args are invalidated with the object.
+	variants map[string]map[string]struct{}
+
+	// children keys without args of cached objects and of their ancestor directories by parent directory, so that
+	// invalidation of directory visits only objects under it.
+	children map[string]map[string]struct{}
+
+	// gen generation of invalidations, content fetched before an invalidation is not cached.
+	gen uint64
+
+	group singleflight.Group
+
+	hits, misses, evictions uint64
+}
+
+type memoryCacheItem struct {
+	key     string
+	value   *memoryCacheValue
+	expires time.Time
+}
+
+// memoryCacheValue fetched object, cached if its status code is 200. Object too large to be cached is cached as
+// such without data, so that it is read bypassing cache.
+type memoryCacheValue struct {
+	data       []byte
+	fileName   string
+	statusCode int
+	large      bool
+}
+
+func (v *memoryCacheValue) size() int64 {
+	return int64(len(v.data) + len(v.fileName))
+}
+
+// NewMemoryCache creates in-memory cache.
+func NewMemoryCache(opts MemoryCacheOptions) *MemoryCache {
+	m := &MemoryCache{
+		maxSize:       opts.MaxSize,
+		maxObjectSize: opts.MaxObjectSize,
+		ttl:           opts.TTL,
+		lru:           list.New(),
+		items:         make(map[string]*list.Element),
+		variants:      make(map[string]map[string]struct{}),
+		children:      make(map[string]map[string]struct{}),
+	}
+
+	if m.maxSize <= 0 {
+		m.maxSize = defaultMemoryCacheSize
+	}
+	if m.maxObjectSize <= 0 {
+		m.maxObjectSize = defaultMemoryCacheObjectSize
+	}
+	if m.ttl <= 0 {
+		m.ttl = defaultMemoryCacheTTL
+	}
+
+	return m
+}
+
+// Stats returns statistics of cache.
+func (m *MemoryCache) Stats() MemoryCacheStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return MemoryCacheStats{
+		Hits:      atomic.LoadUint64(&m.hits),
+		Misses:    atomic.LoadUint64(&m.misses),
+		Evictions: atomic.LoadUint64(&m.evictions),
+		Len:       m.lru.Len(),
+		Size:      m.size,
+	}
+}
+
+// Invalidate removes cached objects of file id, read with any args. Files replaced or deleted through client are
+// invalidated automatically.
+func (m *MemoryCache) Invalidate(fileID string) {
+	m.invalidate(fileIDCacheKey(fileID), false)
+}
+
+// Purge removes all cached objects.
+func (m *MemoryCache) Purge() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.gen++
+	for e := m.lru.Front(); e != nil; e = m.lru.Front() {
+		m.drop(e)
+	}
+}
+
+// invalidate removes cached object of key along with objects of key read with args, and objects with keys under key
+// as directory if dir is set.
+func (m *MemoryCache) invalidate(key string, dir bool) {
+	if m == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.gen++
+	m.remove(key)
+	for k := range m.variants[key] {
+		m.remove(k)
+	}
+	if dir {
+		m.invalidateDir(strings.TrimSuffix(key, "/"))
+	}
+}
+
+// invalidateDir removes cached objects with keys under directory dir.
+func (m *MemoryCache) invalidateDir(dir string) {
+	for child := range m.children[dir] {
+		for k := range m.variants[child] {
+			m.remove(k)
+		}
+		m.invalidateDir(child)
+	}
+}
+
+// remove removes cached object of key, forgetting its fetch in flight.
+func (m *MemoryCache) remove(key string) {
+	if e, ok := m.items[key]; ok {
+		m.drop(e)
+	}
+	m.group.Forget(key)
+}
+
+// get returns cached object of key, nil if it is not cached or expired.
+func (m *MemoryCache) get(key string) *memoryCacheValue {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.items[key]
+	if !ok {
+		return nil
+	}
+
+	item := e.Value.(*memoryCacheItem)
+	if time.Now().After(item.expires) {
+		m.drop(e)
+		return nil
+	}
+
+	m.lru.MoveToFront(e)
+	return item.value
+}
+
+// add caches object of key unless cache was invalidated since generation gen.
+func (m *MemoryCache) add(key string, value *memoryCacheValue, gen uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if gen != m.gen || int64(len(value.data)) > m.maxObjectSize {
+		return
+	}
+
+	if e, ok := m.items[key]; ok {
+		m.drop(e)
+	}
+	m.items[key] = m.lru.PushFront(&memoryCacheItem{key: key, value: value, expires: time.Now().Add(m.ttl)})
+	m.size += value.size()
+
+	base := baseCacheKey(key)
+	if m.variants[base] == nil {
+		m.variants[base] = make(map[string]struct{})
+	}
+	m.variants[base][key] = struct{}{}
+	m.link(base)
+
+	for m.size > m.maxSize {
+		m.drop(m.lru.Back())
+		atomic.AddUint64(&m.evictions, 1)
+	}
+}
+
+func (m *MemoryCache) drop(e *list.Element) {
+	item := e.Value.(*memoryCacheItem)
+	m.lru.Remove(e)
+	delete(m.items, item.key)
+	m.size -= item.value.size()
+
+	base := baseCacheKey(item.key)
+	if delete(m.variants[base], item.key); len(m.variants[base]) == 0 {
+		delete(m.variants, base)
+		m.unlink(base)
+	}
+}
+
+// link adds key without args to children of its parent directory, and so on up to the first directory linked already.
+func (m *MemoryCache) link(base string) {
+	for parent, ok := parentCacheKey(base); ok; parent, ok = parentCacheKey(base) {
+		if _, linked := m.children[parent][base]; linked {
+			return
+		}
+		if m.children[parent] == nil {
+			m.children[parent] = make(map[string]struct{})
+		}
+		m.children[parent][base] = struct{}{}
+		base = parent
+	}
+}
+
+// unlink removes key without args from children of its parent directory unless it has cached objects or children,
+// and so on up.
+func (m *MemoryCache) unlink(base string) {
+	for parent, ok := parentCacheKey(base); ok; parent, ok = parentCacheKey(base) {
+		if len(m.variants[base]) > 0 || len(m.children[base]) > 0 {
+			return
+		}
+		if delete(m.children[parent], base); len(m.children[parent]) == 0 {
+			delete(m.children, parent)
+		}
+		base = parent
+	}
+}
+
+// baseCacheKey returns key without args.
+func baseCacheKey(key string) string {
+	if i := strings.IndexByte(key, '?'); i >= 0 {
+		return key[:i]
+	}
+	return key
+}
+
+// parentCacheKey returns key of parent directory of key without args, false if key is not of path.
+func parentCacheKey(base string) (string, bool) {
+	if i := strings.LastIndexByte(base, '/'); i >= 0 {
+		return base[:i], true
+	}
+	return "", false
+}
+
+// load returns cached object of key, fetching it if it is not cached. Concurrent loads of the same key share a single
+// fetch, which is detached from ctx so that canceled load does not fail others; each load waits for it until its
+// own ctx is done. Fetched object is cached if it is small enough.
+func (m *MemoryCache) load(ctx context.Context, key string, metrics Metrics, op string, fetch func(context.Context) (*memoryCacheValue, error)) (*memoryCacheValue, error) {
+	if value := m.get(key); value != nil {
+		atomic.AddUint64(&m.hits, 1)
+		observeCache(metrics, op, true)
+		return value, nil
+	}
+	atomic.AddUint64(&m.misses, 1)
+	observeCache(metrics, op, false)
+
+	m.mu.Lock()
+	gen := m.gen
+	m.mu.Unlock()
+
+	ch := m.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), memoryCacheFetchTimeout)
+		defer cancel()
+
+		value, err := fetch(ctx)
+		if err == nil && value.statusCode == http.StatusOK {
+			m.add(key, value, gen)
+		}
+		return value, err
+	})
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-ch:
+		value, _ := res.Val.(*memoryCacheValue)
+		return value, res.Err
+	}
+}
+
+// readSmall reads content up to max size. If content is larger, data is nil and returned reader reads whole content.
+func readSmall(r io.Reader, max int64) (data []byte, rest io.Reader, err error) {
+	buf := bytes.NewBuffer(nil)
+	n, err := io.Copy(buf, io.LimitReader(r, max+1))
+	if err != nil {
+		return
+	}
+	if n > max {
+		return nil, io.MultiReader(buf, r), nil
+	}
+	return buf.Bytes(), nil, nil
+}
+
+// downloadCached downloads file through in-memory cache. Content too large to be cached is downloaded by each caller.
+func (c *Seaweed) downloadCached(ctx context.Context, fileID string, args url.Values, callback func(io.Reader) error) (fileName string, err error) {
+	value, err := c.memCache.load(ctx, memoryCacheKey(fileID, args), c.metrics, OpDownload, func(ctx context.Context) (value *memoryCacheValue, err error) {
+		resp, err := c.readFile(ctx, fileID, args, nil, func(_ *DownloadResponse, r io.Reader) error {
+			data, rest, err := readSmall(r, c.memCache.maxObjectSize)
+			if err == nil {
+				value = &memoryCacheValue{data: data, statusCode: http.StatusOK, large: rest != nil}
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		value.fileName = resp.FileName
+		return
+	})
+
+	switch {
+	case err != nil:
+		return
+	case value.large:
+		return c.download(ctx, fileID, args, callback)
+	default:
+		return value.fileName, callback(bytes.NewReader(value.data))
+	}
+}
+
+// memoryCacheKey returns key of cached content of file id read with args, which may change content, e.g: resizing images.
+func memoryCacheKey(fileID string, args url.Values) string {
+	if len(args) == 0 {
+		return fileIDCacheKey(fileID)
+	}
+	return fileIDCacheKey(fileID) + "?" + args.Encode()
+}
+
+// getCached gets response of filer through in-memory cache. Responses other than 200 are shared by concurrent gets, but not cached.
+func (f *Filer) getCached(ctx context.Context, path string) (data []byte, statusCode int, err error) {
+	value, err := f.memCache.load(ctx, f.memoryCacheKey(path), f.metrics, OpFilerGet, func(ctx context.Context) (*memoryCacheValue, error) {
+		data, statusCode, err := f.get(ctx, path, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &memoryCacheValue{data: data, statusCode: statusCode}, nil
+	})
+	if err != nil {
+		return
+	}
+
+	// copy, callers may modify returned data
+	return append([]byte(nil), value.data...), value.statusCode, nil
+}
+
+// memoryCacheKey returns key of cached response of path.
+func (f *Filer) memoryCacheKey(path string) string {
+	return "filer:" + f.base.Host + path
+}
+
+// invalidateMemoryCache removes cached responses of fullPath, of paths under it if dir is set, and listings of its
+// parent directory.
+func (f *Filer) invalidateMemoryCache(fullPath string, dir bool) {
+	f.memCache.invalidate(f.memoryCacheKey(fullPath), dir)
+
+	parent := path.Dir(strings.TrimSuffix(fullPath, "/"))
+	f.memCache.invalidate(f.memoryCacheKey(parent), false)
+	if parent != "/" {
+		f.memCache.invalidate(f.memoryCacheKey(parent+"/"), false)
+	}
+}
+
+// SetMemoryCache makes downloads by file id and filer gets go through in-memory cache, nil disables caching.
+// Sets memory cache of filers too. Cache may be shared by clients.
+func (c *Seaweed) SetMemoryCache(m *MemoryCache) {
+	c.memCache = m
+	for _, f := range c.filers {
+		f.memCache = m
+	}
+}
+
+// SetMemoryCache makes gets go through in-memory cache, nil disables caching.
+func (f *Filer) SetMemoryCache(m *MemoryCache) {
+	f.memCache = m
+}
@@ -0,0 +1,292 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type cacheRecordingMetrics struct {
+	recordingMetrics
+	hits, misses int32
+}
+
+func (m *cacheRecordingMetrics) ObserveCache(op string, hit bool) {
+	if hit {
+		atomic.AddInt32(&m.hits, 1)
+	} else {
+		atomic.AddInt32(&m.misses, 1)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	m := NewMemoryCache(MemoryCacheOptions{MaxSize: 25, MaxObjectSize: 10, TTL: 50 * time.Millisecond})
+
+	var fetches int32
+	load := func(key, content string) string {
+		value, err := m.load(context.Background(), key, nil, OpDownload, func(context.Context) (*memoryCacheValue, error) {
+			atomic.AddInt32(&fetches, 1)
+			return &memoryCacheValue{data: []byte(content), statusCode: http.StatusOK}, nil
+		})
+		require.Nil(t, err)
+		return string(value.data)
+	}
+
+	require.Equal(t, "aaaaaaaaaa", load("a", "aaaaaaaaaa"))
+	require.Equal(t, "aaaaaaaaaa", load("a", "changed"))
+	require.EqualValues(t, 1, fetches)
+
+	// objects larger than max object size are not cached
+	load("big", strings.Repeat("x", 11))
+	load("big", strings.Repeat("x", 11))
+	require.EqualValues(t, 3, fetches)
+
+	// least recently used is evicted
+	load("b", "bbbbbbbbbb")
+	load("a", "")
+	load("c", "cccccccccc")
+	require.Equal(t, "aaaaaaaaaa", load("a", "changed"))
+	require.Equal(t, "changed", load("b", "changed"))
+
+	stats := m.Stats()
+	require.Equal(t, 2, stats.Len)
+	require.EqualValues(t, 17, stats.Size)
+	require.EqualValues(t, 2, stats.Evictions)
+	require.EqualValues(t, 3, stats.Hits)
+	require.EqualValues(t, 6, stats.Misses)
+	require.InDelta(t, 1.0/3, stats.HitRatio(), 1e-9)
+
+	// objects expire
+	time.Sleep(60 * time.Millisecond)
+	require.Equal(t, "expired", load("a", "expired"))
+
+	// errors and other statuses are not cached
+	_, err := m.load(context.Background(), "err", nil, OpDownload, func(context.Context) (*memoryCacheValue, error) { return nil, io.ErrUnexpectedEOF })
+	require.Equal(t, io.ErrUnexpectedEOF, err)
+	value, err := m.load(context.Background(), "404", nil, OpDownload, func(context.Context) (*memoryCacheValue, error) {
+		return &memoryCacheValue{statusCode: http.StatusNotFound}, nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, http.StatusNotFound, value.statusCode)
+	require.Nil(t, m.get("404"))
+
+	m.Purge()
+	require.Equal(t, 0, m.Stats().Len)
+	require.Equal(t, MemoryCacheStats{}.HitRatio(), float64(0))
+}
+
+func TestMemoryCacheSingleflight(t *testing.T) {
+	m := NewMemoryCache(MemoryCacheOptions{})
+
+	var fetches int32
+	release := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, err := m.load(context.Background(), "key", nil, OpDownload, func(context.Context) (*memoryCacheValue, error) {
+				atomic.AddInt32(&fetches, 1)
+				<-release
+				return &memoryCacheValue{data: []byte("data"), statusCode: http.StatusOK}, nil
+			})
+			require.Nil(t, err)
+			require.Equal(t, "data", string(value.data))
+		}()
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// late comers are served from cache
+	require.EqualValues(t, 1, fetches)
+}
+
+func TestMemoryCacheInvalidation(t *testing.T) {
+	m := NewMemoryCache(MemoryCacheOptions{})
+
+	// content fetched before invalidation is not cached
+	value, err := m.load(context.Background(), "key", nil, OpDownload, func(context.Context) (*memoryCacheValue, error) {
+		m.invalidate("key", false)
+		return &memoryCacheValue{data: []byte("stale"), statusCode: http.StatusOK}, nil
+	})
+	require.Nil(t, err)
+	require.Equal(t, "stale", string(value.data))
+	require.Nil(t, m.get("key"))
+
+	for _, key := range []string{"filer:h/dir", "filer:h/dir/a", "filer:h/dir/b/c", "filer:h/dir2"} {
+		m.add(key, &memoryCacheValue{data: []byte(key), statusCode: http.StatusOK}, m.gen)
+	}
+	m.invalidate("filer:h/dir", true)
+	require.Equal(t, 1, m.Stats().Len)
+	require.NotNil(t, m.get("filer:h/dir2"))
+
+	// objects read with args are invalidated along with the object
+	for _, key := range []string{"fid:3,01", "fid:3,01?width=10", "fid:3,012"} {
+		m.add(key, &memoryCacheValue{data: []byte(key), statusCode: http.StatusOK}, m.gen)
+	}
+	m.invalidate("fid:3,01", false)
+	require.Equal(t, 2, m.Stats().Len)
+	require.NotNil(t, m.get("fid:3,012"))
+
+	// keys of removed objects are removed from indexes
+	m.invalidate("filer:h/", true)
+	require.Nil(t, m.get("filer:h/dir2"))
+	m.Purge()
+	require.Empty(t, m.variants)
+	require.Empty(t, m.children)
+}
+
+func TestMemoryCacheCanceledLoad(t *testing.T) {
+	m := NewMemoryCache(MemoryCacheOptions{})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	fetch := func(ctx context.Context) (*memoryCacheValue, error) {
+		close(started)
+		select {
+		case <-release:
+			return &memoryCacheValue{data: []byte("data"), statusCode: http.StatusOK}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	// load starting fetch gives up, fetch goes on for other loads
+	ctx, cancel := context.WithCancel(context.Background())
+	canceled := make(chan error, 1)
+	go func() {
+		_, err := m.load(ctx, "key", nil, OpDownload, fetch)
+		canceled <- err
+	}()
+	<-started
+
+	loaded := make(chan *memoryCacheValue, 1)
+	go func() {
+		value, err := m.load(context.Background(), "key", nil, OpDownload, fetch)
+		require.Nil(t, err)
+		loaded <- value
+	}()
+
+	cancel()
+	require.Equal(t, context.Canceled, <-canceled)
+
+	close(release)
+	require.Equal(t, "data", string((<-loaded).data))
+	require.NotNil(t, m.get("key"))
+}
+
+func TestMemoryCacheDownload(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	metrics := &cacheRecordingMetrics{}
+	c, err := New(WithMasters(cluster.master.URL), WithFilers(cluster.filer.URL), WithHTTPClient(http.DefaultClient),
+		WithMetrics(metrics), WithMemoryCache(MemoryCacheOptions{}))
+	require.Nil(t, err)
+	defer c.Close()
+
+	download := func(fid string) string {
+		var downloaded []byte
+		_, err := c.Download(fid, nil, func(r io.Reader) (err error) {
+			downloaded, err = ioutil.ReadAll(r)
+			return
+		})
+		require.Nil(t, err)
+		return string(downloaded)
+	}
+
+	fp, err := c.Upload(bytes.NewReader([]byte("thumbnail")), "thumb.png", 9, "", "")
+	require.Nil(t, err)
+
+	// concurrent downloads are coalesced
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			require.Equal(t, "thumbnail", download(fp.FileID))
+		}()
+	}
+	wg.Wait()
+	require.EqualValues(t, 1, atomic.LoadInt32(&cluster.volumeReads))
+	require.EqualValues(t, 10, atomic.LoadInt32(&metrics.hits)+atomic.LoadInt32(&metrics.misses))
+
+	// content read with args is cached on its own
+	_, err = c.Download(fp.FileID, url.Values{"width": []string{"10"}}, func(io.Reader) error { return nil })
+	require.Nil(t, err)
+	require.EqualValues(t, 2, atomic.LoadInt32(&cluster.volumeReads))
+	require.Equal(t, 2, c.memCache.Stats().Len)
+
+	// replace invalidates
+	require.Nil(t, c.Replace(fp.FileID, bytes.NewReader([]byte("thumbnail2")), "thumb.png", 10, "", "", false))
+	require.Equal(t, 0, c.memCache.Stats().Len)
+	require.Equal(t, "thumbnail2", download(fp.FileID))
+	require.EqualValues(t, 3, atomic.LoadInt32(&cluster.volumeReads))
+
+	// large content is not cached, it is downloaded bypassing cache once known to be large
+	big := strings.Repeat("x", 5000)
+	fp2, err := c.Upload(strings.NewReader(big), "big.bin", int64(len(big)), "", "")
+	require.Nil(t, err)
+	require.Equal(t, big, download(fp2.FileID))
+	require.EqualValues(t, 5, atomic.LoadInt32(&cluster.volumeReads))
+	require.Equal(t, big, download(fp2.FileID))
+	require.EqualValues(t, 6, atomic.LoadInt32(&cluster.volumeReads))
+
+	// delete invalidates
+	require.Nil(t, c.DeleteFile(fp.FileID, nil))
+	_, err = c.Download(fp.FileID, nil, func(io.Reader) error { return nil })
+	require.NotNil(t, err)
+
+	// filer gets
+	filer := c.Filers()[0]
+	_, err = filer.Upload(bytes.NewReader([]byte("config")), 6, "/etc/app.json", "", "")
+	require.Nil(t, err)
+
+	for i := 0; i < 2; i++ {
+		data, status, err := filer.Get("/etc/app.json", nil, nil)
+		require.Nil(t, err)
+		require.Equal(t, http.StatusOK, status)
+		require.Equal(t, "config", string(data))
+		data[0] = 'X' // returned data is a copy
+	}
+	require.EqualValues(t, 1, atomic.LoadInt32(&cluster.filerReads))
+
+	// upload through client invalidates
+	_, err = filer.Upload(bytes.NewReader([]byte("config2")), 7, "/etc/app.json", "", "")
+	require.Nil(t, err)
+	data, _, err := filer.Get("/etc/app.json", nil, nil)
+	require.Nil(t, err)
+	require.Equal(t, "config2", string(data))
+
+	// upload into directory invalidates its listing
+	data, _, err = filer.Get("/etc/", nil, nil)
+	require.Nil(t, err)
+	require.NotContains(t, string(data), "/etc/other.json")
+
+	_, err = filer.Upload(bytes.NewReader([]byte("other")), 5, "/etc/other.json", "", "")
+	require.Nil(t, err)
+	data, _, err = filer.Get("/etc/", nil, nil)
+	require.Nil(t, err)
+	require.Contains(t, string(data), "/etc/other.json")
+
+	require.Nil(t, filer.Delete("/etc/app.json", nil))
+	_, status, err := filer.Get("/etc/app.json", nil, nil)
+	require.Nil(t, err)
+	require.Equal(t, http.StatusNotFound, status)
+
+	stats := c.memCache.Stats()
+	require.EqualValues(t, atomic.LoadInt32(&metrics.hits), stats.Hits)
+	require.EqualValues(t, atomic.LoadInt32(&metrics.misses), stats.Misses)
+}
@@ -0,0 +1,135 @@
+package goseaweedfs
+
+import (
+	"io"
+	"net/url"
+	"sync/atomic"
+	"time"
+)
+
+// Operations labeling metrics. Http requests are labeled by the request they send, high-level calls by the
+// method called: e.g: UploadFile is a call of OpUpload, sending requests of OpAssign, OpChunkUpload and OpManifestUpload.
+const (
+	OpAssign         = "assign"
+	OpLookup         = "lookup"
+	OpGrow           = "grow"
+	OpGC             = "gc"
+	OpStatus         = "status"
+	OpClusterStatus  = "cluster_status"
+	OpSubmit         = "submit"
+	OpUpload         = "upload"
+	OpChunkUpload    = "chunk_upload"
+	OpManifestUpload = "manifest_upload"
+	OpBatchUpload    = "batch_upload"
+	OpReplace        = "replace"
+	OpHead           = "head"
+	OpDownload       = "download"
+	OpDownloadTo     = "download_to"
+	OpDelete         = "delete"
+	OpDeleteChunks   = "delete_chunks"
+	OpDeleteFiles    = "delete_files"
+	OpReadEntry      = "read_entry"
+
+	OpFilerUpload   = "filer_upload"
+	OpFilerGet      = "filer_get"
+	OpFilerDownload = "filer_download"
+	OpFilerDelete   = "filer_delete"
+	OpFilerGetEntry = "filer_get_entry"
+)
+
+// Metrics receives measurements of client operations. Implementations must be safe for concurrent use.
+// See package github.com/linxGnu/goseaweedfs/metrics/prometheus for Prometheus collector.
+type Metrics interface {
+	// ObserveRequest is called when http request to host completed, after response body is read.
+	// Sent and received are sizes of request and response bodies.
+	ObserveRequest(op, host string, latency time.Duration, sent, received int64, err error)
+
+	// ObserveRetry is called when request failed on host is retried on the same or another host.
+	ObserveRetry(op, host string)
+
+	// ObserveCall is called when high-level operation completed.
+	ObserveCall(op string, latency time.Duration, err error)
+}
+
+// SetMetrics sets metrics hook of client and its filers. Must be called before using client.
+func (c *Seaweed) SetMetrics(m Metrics) {
+	c.metrics = m
+	c.client.metrics = m
+	for _, f := range c.filers {
+		f.SetMetrics(m)
+	}
+}
+
+// SetMetrics sets metrics hook of filer only. Must be called before using filer.
+func (f *Filer) SetMetrics(m Metrics) {
+	f.metrics = m
+	f.client.metrics = m
+}
+
+// observeCall reports high-level call. Intended to be deferred with start time and pointer to returned error.
+func observeCall(m Metrics, op string, start time.Time, err *error) {
+	if m != nil {
+		m.ObserveCall(op, time.Since(start), *err)
+	}
+}
+
+func observeRetry(m Metrics, op, host string) {
+	if m != nil {
+		m.ObserveRetry(op, host)
+	}
+}
+
+func (c *httpClient) observe(op, rawURL string, start time.Time, sent, received int64, err error) {
+	if c.metrics != nil {
+		c.metrics.ObserveRequest(op, hostOf(rawURL), time.Since(start), sent, received, err)
+	}
+}
+
+func hostOf(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Host
+	}
+	return ""
+}
+
+// countingReader counts bytes read. Safe to read count from another goroutine.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return
+}
+
+func (r *countingReader) count() int64 {
+	return atomic.LoadInt64(&r.n)
+}
+
+// meteredBody reports request when response body is closed.
+type meteredBody struct {
+	io.ReadCloser
+	n       int64
+	err     error
+	onClose func(received int64, err error)
+}
+
+func (b *meteredBody) Read(p []byte) (n int, err error) {
+	n, err = b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return
+}
+
+func (b *meteredBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.onClose != nil {
+		b.onClose(b.n, b.err)
+		b.onClose = nil
+	}
+	return err
+}
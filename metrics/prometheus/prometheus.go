@@ -0,0 +1,140 @@
+// Package prometheus implements goseaweedfs.Metrics with Prometheus collectors.
+package prometheus
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Result label values.
+const (
+	ResultSuccess = "success"
+	ResultError   = "error"
+	ResultHit     = "hit"
+	ResultMiss    = "miss"
+)
+
+// Options of collector.
+type Options struct {
+	// Namespace prefix of metric names. Default: goseaweedfs.
+	Namespace string
+
+	// ConstLabels labels added to all metrics.
+	ConstLabels prometheus.Labels
+
+	// Buckets of latency histograms in seconds. Default: prometheus.DefBuckets.
+	Buckets []float64
+}
+
+// Collector collects client metrics. Implements goseaweedfs.Metrics and prometheus.Collector.
+type Collector struct {
+	requests      *prometheus.CounterVec
+	requestErrors *prometheus.CounterVec
+	latency       *prometheus.HistogramVec
+	bytesSent     *prometheus.CounterVec
+	bytesReceived *prometheus.CounterVec
+	retries       *prometheus.CounterVec
+	calls         *prometheus.CounterVec
+	callLatency   *prometheus.HistogramVec
+	cacheLookups  *prometheus.CounterVec
+}
+
+// New creates collector. Register it with prometheus.Registerer and pass to goseaweedfs.WithMetrics.
+func New(opts Options) *Collector {
+	ns := opts.Namespace
+	if ns == "" {
+		ns = "goseaweedfs"
+	}
+
+	buckets := opts.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+
+	counter := func(name, help string, labels ...string) *prometheus.CounterVec {
+		return prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: ns, Name: name, Help: help, ConstLabels: opts.ConstLabels,
+		}, labels)
+	}
+
+	histogram := func(name, help string, labels ...string) *prometheus.HistogramVec {
+		return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: ns, Name: name, Help: help, ConstLabels: opts.ConstLabels, Buckets: buckets,
+		}, labels)
+	}
+
+	return &Collector{
+		requests:      counter("requests_total", "Number of http requests sent to SeaweedFS servers.", "op", "host", "result"),
+		requestErrors: counter("request_errors_total", "Number of failed http requests.", "op", "host"),
+		latency:       histogram("request_duration_seconds", "Latency of http requests, including reading response body.", "op", "host"),
+		bytesSent:     counter("sent_bytes_total", "Bytes of request bodies sent.", "op", "host"),
+		bytesReceived: counter("received_bytes_total", "Bytes of response bodies received.", "op", "host"),
+		retries:       counter("retries_total", "Number of retried requests, labeled by failed host.", "op", "host"),
+		calls:         counter("calls_total", "Number of client operations.", "op", "result"),
+		callLatency:   histogram("call_duration_seconds", "Latency of client operations.", "op"),
+		cacheLookups:  counter("cache_lookups_total", "Number of lookups of in-memory cache, hit ratio is hits over all lookups.", "op", "result"),
+	}
+}
+
+// ObserveRequest implements goseaweedfs.Metrics.
+func (c *Collector) ObserveRequest(op, host string, latency time.Duration, sent, received int64, err error) {
+	c.requests.WithLabelValues(op, host, result(err)).Inc()
+	if err != nil {
+		c.requestErrors.WithLabelValues(op, host).Inc()
+	}
+	c.latency.WithLabelValues(op, host).Observe(latency.Seconds())
+	if sent > 0 {
+		c.bytesSent.WithLabelValues(op, host).Add(float64(sent))
+	}
+	if received > 0 {
+		c.bytesReceived.WithLabelValues(op, host).Add(float64(received))
+	}
+}
+
+// ObserveRetry implements goseaweedfs.Metrics.
+func (c *Collector) ObserveRetry(op, host string) {
+	c.retries.WithLabelValues(op, host).Inc()
+}
+
+// ObserveCall implements goseaweedfs.Metrics.
+func (c *Collector) ObserveCall(op string, latency time.Duration, err error) {
+	c.calls.WithLabelValues(op, result(err)).Inc()
+	c.callLatency.WithLabelValues(op).Observe(latency.Seconds())
+}
+
+// ObserveCache implements goseaweedfs.CacheMetrics.
+func (c *Collector) ObserveCache(op string, hit bool) {
+	if hit {
+		c.cacheLookups.WithLabelValues(op, ResultHit).Inc()
+	} else {
+		c.cacheLookups.WithLabelValues(op, ResultMiss).Inc()
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, col := range c.collectors() {
+		col.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, col := range c.collectors() {
+		col.Collect(ch)
+	}
+}
+
+func (c *Collector) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		c.requests, c.requestErrors, c.latency, c.bytesSent, c.bytesReceived, c.retries, c.calls, c.callLatency, c.cacheLookups,
+	}
+}
+
+func result(err error) string {
+	if err != nil {
+		return ResultError
+	}
+	return ResultSuccess
+}
@@ -0,0 +1,49 @@
+package prometheus
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/linxGnu/goseaweedfs"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	_ goseaweedfs.Metrics      = (*Collector)(nil)
+	_ goseaweedfs.CacheMetrics = (*Collector)(nil)
+)
+
+func TestCollector(t *testing.T) {
+	c := New(Options{})
+
+	reg := prometheus.NewPedanticRegistry()
+	require.Nil(t, reg.Register(c))
+
+	c.ObserveRequest(goseaweedfs.OpUpload, "v1:8080", time.Millisecond, 100, 20, nil)
+	c.ObserveRequest(goseaweedfs.OpUpload, "v1:8080", time.Millisecond, 50, 0, errors.New("broken"))
+	c.ObserveRetry(goseaweedfs.OpDownload, "v2:8080")
+	c.ObserveCall(goseaweedfs.OpUpload, time.Second, nil)
+	c.ObserveCache(goseaweedfs.OpDownload, true)
+	c.ObserveCache(goseaweedfs.OpDownload, true)
+	c.ObserveCache(goseaweedfs.OpDownload, false)
+
+	require.Equal(t, float64(150), testutil.ToFloat64(c.bytesSent.WithLabelValues("upload", "v1:8080")))
+	require.Equal(t, float64(1), testutil.ToFloat64(c.requestErrors.WithLabelValues("upload", "v1:8080")))
+	require.Equal(t, float64(1), testutil.ToFloat64(c.retries.WithLabelValues("download", "v2:8080")))
+	require.Equal(t, float64(2), testutil.ToFloat64(c.cacheLookups.WithLabelValues("download", ResultHit)))
+	require.Equal(t, float64(1), testutil.ToFloat64(c.cacheLookups.WithLabelValues("download", ResultMiss)))
+
+	require.Nil(t, testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP goseaweedfs_calls_total Number of client operations.
+# TYPE goseaweedfs_calls_total counter
+goseaweedfs_calls_total{op="upload",result="success"} 1
+# HELP goseaweedfs_requests_total Number of http requests sent to SeaweedFS servers.
+# TYPE goseaweedfs_requests_total counter
+goseaweedfs_requests_total{host="v1:8080",op="upload",result="error"} 1
+goseaweedfs_requests_total{host="v1:8080",op="upload",result="success"} 1
+`), "goseaweedfs_calls_total", "goseaweedfs_requests_total"))
+}
@@ -0,0 +1,95 @@
+package goseaweedfs
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recordedRequest struct {
+	op       string
+	received int64
+	err      error
+}
+
+type recordingMetrics struct {
+	mu       sync.Mutex
+	requests []recordedRequest
+	retries  []string
+	calls    []string
+}
+
+func (m *recordingMetrics) ObserveRequest(op, host string, latency time.Duration, sent, received int64, err error) {
+	m.mu.Lock()
+	m.requests = append(m.requests, recordedRequest{op: op, received: received, err: err})
+	m.mu.Unlock()
+}
+
+func (m *recordingMetrics) ObserveRetry(op, host string) {
+	m.mu.Lock()
+	m.retries = append(m.retries, op)
+	m.mu.Unlock()
+}
+
+func (m *recordingMetrics) ObserveCall(op string, latency time.Duration, err error) {
+	m.mu.Lock()
+	m.calls = append(m.calls, op)
+	m.mu.Unlock()
+}
+
+func TestMetrics(t *testing.T) {
+	files := map[string][]byte{"3,01": []byte("hello world")}
+
+	var failures int32 = 1
+	broken, healthy := newFakeVolumeServer(files, &failures), newFakeVolumeServer(files, nil)
+	defer broken.Close()
+	defer healthy.Close()
+
+	master := newFakeMaster(broken, healthy)
+	defer master.Close()
+
+	m := &recordingMetrics{}
+	c, err := New(WithMasters(master.URL), WithHTTPClient(http.DefaultClient), WithMetrics(m),
+		WithLocationSelectors(HeadSelector, nil))
+	require.Nil(t, err)
+	defer c.Close()
+
+	_, err = c.Download("3,01", nil, func(r io.Reader) error {
+		_, err := io.Copy(ioutil.Discard, r)
+		return err
+	})
+	require.Nil(t, err)
+
+	require.Equal(t, []string{OpLookup, OpDownload}, m.calls)
+	require.Equal(t, []string{OpDownload}, m.retries)
+	require.Len(t, m.requests, 3)
+	require.Equal(t, OpLookup, m.requests[0].op)
+	require.Equal(t, OpDownload, m.requests[1].op)
+	require.NotNil(t, m.requests[1].err)
+	require.Equal(t, recordedRequest{op: OpDownload, received: 11}, m.requests[2])
+}
+
+func TestFilerMetrics(t *testing.T) {
+	c, err := New(WithMasters("http://localhost:9333"), WithFilers("localhost:8888", "localhost:8889"), WithHTTPClient(http.DefaultClient))
+	require.Nil(t, err)
+	defer c.Close()
+
+	m := &recordingMetrics{}
+	c.SetMetrics(m)
+	for _, f := range c.Filers() {
+		require.Same(t, m, f.metrics)
+		require.Same(t, m, f.client.metrics)
+	}
+
+	// setting metrics of a filer changes neither client nor other filers
+	fm := &recordingMetrics{}
+	c.Filers()[0].SetMetrics(fm)
+	require.Same(t, fm, c.Filers()[0].client.metrics)
+	require.Same(t, m, c.client.metrics)
+	require.Same(t, m, c.Filers()[1].client.metrics)
+}
@@ -0,0 +1,320 @@
+package goseaweedfs
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures seaweed client created by New.
+type Option func(*settings)
+
+type settings struct {
+	masters    []string
+	filers     []string
+	chunkSize  int64
+	httpClient *http.Client
+	timeout    time.Duration
+	tls        *TLSConfig
+
+	retries     int
+	concurrency int
+	readPolicy  ReadPolicy
+
+	jwt      *JWTConfig
+	locality Locality
+
+	readSelector  LocationSelector
+	writeSelector LocationSelector
+
+	volumeScheme  string
+	volumeSchemes map[string]string
+
+	fidPoolBatch        int
+	fidPoolLowWatermark int
+
+	metrics        Metrics
+	tracerProvider trace.TracerProvider
+	logger         *slog.Logger
+
+	checksums   bool
+	keys        KeyProvider
+	compression *CompressionPolicy
+	cipher      bool
+
+	validatePlacement bool
+
+	diskCacheDir  string
+	diskCacheSize int64
+	memoryCache   *MemoryCacheOptions
+}
+
+// WithMasters sets master urls. Requests fail over to other masters on connection errors.
+func WithMasters(urls ...string) Option {
+	return func(s *settings) {
+		s.masters = append(s.masters, urls...)
+	}
+}
+
+// WithFilers sets filer urls.
+func WithFilers(urls ...string) Option {
+	return func(s *settings) {
+		s.filers = append(s.filers, urls...)
+	}
+}
+
+// WithChunkSize sets size of chunks for uploading large files. Zero disables chunking.
+func WithChunkSize(size int64) Option {
+	return func(s *settings) {
+		s.chunkSize = size
+	}
+}
+
+// WithHTTPClient sets underlying http client. Timeout and TLS options are ignored if http client is set.
+func WithHTTPClient(client *http.Client) Option {
+	return func(s *settings) {
+		s.httpClient = client
+	}
+}
+
+// WithTimeout sets timeout of http requests.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *settings) {
+		s.timeout = timeout
+	}
+}
+
+// WithTLS sets TLS config for connecting to cluster.
+func WithTLS(cfg TLSConfig) Option {
+	return func(s *settings) {
+		s.tls = &cfg
+	}
+}
+
+// WithRetries sets number of retries for master requests and reads (on other masters/replicas).
+func WithRetries(retries int) Option {
+	return func(s *settings) {
+		s.retries = retries
+	}
+}
+
+// WithConcurrency sets default number of concurrent requests of a parallel operation, e.g: DownloadTo.
+func WithConcurrency(concurrency int) Option {
+	return func(s *settings) {
+		s.concurrency = concurrency
+	}
+}
+
+// WithReadPolicy sets policy for reading from replicas.
+func WithReadPolicy(p ReadPolicy) Option {
+	return func(s *settings) {
+		s.readPolicy = p
+	}
+}
+
+// WithJWT sets keys for signing requests.
+func WithJWT(cfg JWTConfig) Option {
+	return func(s *settings) {
+		s.jwt = &cfg
+	}
+}
+
+// WithLocality sets location of client in cluster topology.
+func WithLocality(l Locality) Option {
+	return func(s *settings) {
+		s.locality = l
+	}
+}
+
+// WithLocationSelectors sets selectors of locations for reads and writes.
+func WithLocationSelectors(read, write LocationSelector) Option {
+	return func(s *settings) {
+		s.readSelector, s.writeSelector = read, write
+	}
+}
+
+// WithVolumeSchemes sets schemes of volume servers.
+func WithVolumeSchemes(defaultScheme string, perHost map[string]string) Option {
+	return func(s *settings) {
+		s.volumeScheme, s.volumeSchemes = defaultScheme, perHost
+	}
+}
+
+// WithFileIDPool makes uploads take file ids from a pool reserving `batch` ids per assign request.
+func WithFileIDPool(batch, lowWatermark int) Option {
+	return func(s *settings) {
+		s.fidPoolBatch, s.fidPoolLowWatermark = batch, lowWatermark
+	}
+}
+
+// WithMetrics sets metrics hook receiving measurements of requests and calls.
+func WithMetrics(m Metrics) Option {
+	return func(s *settings) {
+		s.metrics = m
+	}
+}
+
+// WithTracerProvider sets OpenTelemetry tracer provider. Global provider is used by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *settings) {
+		s.tracerProvider = tp
+	}
+}
+
+// WithLogger sets logger of client. See Seaweed.SetLogger.
+func WithLogger(l *slog.Logger) Option {
+	return func(s *settings) {
+		s.logger = l
+	}
+}
+
+// WithChecksums enables computing and verifying checksums of content. See Seaweed.SetChecksums.
+func WithChecksums(enabled bool) Option {
+	return func(s *settings) {
+		s.checksums = enabled
+	}
+}
+
+// WithKeyProvider enables client-side envelope encryption with keys of provider. See Seaweed.SetKeyProvider.
+func WithKeyProvider(p KeyProvider) Option {
+	return func(s *settings) {
+		s.keys = p
+	}
+}
+
+// WithCompression enables compressing uploaded content according to policy. See Seaweed.SetCompression.
+func WithCompression(p CompressionPolicy) Option {
+	return func(s *settings) {
+		s.compression = &p
+	}
+}
+
+// WithCipher enables cipher mode of SeaweedFS for uploads. See Seaweed.SetCipher.
+func WithCipher(enabled bool) Option {
+	return func(s *settings) {
+		s.cipher = enabled
+	}
+}
+
+// WithPlacementValidation makes growing volumes validate replica placement against topology first. See Seaweed.SetPlacementValidation.
+func WithPlacementValidation(enabled bool) Option {
+	return func(s *settings) {
+		s.validatePlacement = enabled
+	}
+}
+
+// WithDiskCache makes downloads read through disk cache in dir, bounded by max size in bytes. See NewDiskCache.
+func WithDiskCache(dir string, maxSize int64) Option {
+	return func(s *settings) {
+		s.diskCacheDir, s.diskCacheSize = dir, maxSize
+	}
+}
+
+// WithMemoryCache makes downloads by file id and filer gets go through in-memory cache of small objects. See NewMemoryCache.
+func WithMemoryCache(opts MemoryCacheOptions) Option {
+	return func(s *settings) {
+		s.memoryCache = &opts
+	}
+}
+
+// WithConfig applies loaded config. Options after this one override config.
+func WithConfig(cfg *Config) Option {
+	return func(s *settings) {
+		if cfg != nil {
+			cfg.apply(s)
+		}
+	}
+}
+
+// New creates seaweed client with options. At least one master is required.
+func New(opts ...Option) (c *Seaweed, err error) {
+	s := &settings{}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if len(s.masters) == 0 {
+		return nil, errors.New("Master url is required")
+	}
+
+	client := s.httpClient
+	if client == nil {
+		if client, err = NewHTTPClient(s.tls, s.timeout); err != nil {
+			return
+		}
+	}
+
+	c = &Seaweed{
+		client:      newHTTPClient(client),
+		chunkSize:   s.chunkSize,
+		retries:     s.retries,
+		concurrency: s.concurrency,
+		readPolicy:  s.readPolicy,
+	}
+
+	if c.readPolicy.MaxAttempts == 0 && s.retries > 0 {
+		c.readPolicy.MaxAttempts = s.retries + 1
+	}
+
+	c.masters = &masterList{urls: make([]*url.URL, len(s.masters))}
+	for i := range s.masters {
+		if c.masters.urls[i], err = parseURI(s.masters[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(s.filers) > 0 {
+		c.filers = make([]*Filer, 0, len(s.filers))
+		for i := range s.filers {
+			var filer *Filer
+			if filer, err = newFiler(s.filers[i], c.masters.urls[0].Scheme, c.client.clone()); err != nil {
+				_ = c.Close()
+				return nil, err
+			}
+			c.filers = append(c.filers, filer)
+		}
+	}
+
+	if s.jwt != nil {
+		c.SetJWT(*s.jwt)
+	}
+	c.SetLocality(s.locality)
+	c.SetLocationSelectors(s.readSelector, s.writeSelector)
+	c.SetVolumeSchemes(s.volumeScheme, s.volumeSchemes)
+	if s.metrics != nil {
+		c.SetMetrics(s.metrics)
+	}
+	if s.tracerProvider != nil {
+		c.SetTracerProvider(s.tracerProvider)
+	}
+	c.SetLogger(s.logger)
+	c.SetChecksums(s.checksums)
+	c.SetKeyProvider(s.keys)
+	c.SetCipher(s.cipher)
+	c.SetPlacementValidation(s.validatePlacement)
+	if err = c.SetCompression(s.compression); err != nil {
+		_ = c.Close()
+		return nil, err
+	}
+	if s.diskCacheDir != "" {
+		var cache *DiskCache
+		if cache, err = NewDiskCache(s.diskCacheDir, s.diskCacheSize); err != nil {
+			_ = c.Close()
+			return nil, err
+		}
+		c.SetDiskCache(cache)
+	}
+	if s.memoryCache != nil {
+		c.SetMemoryCache(NewMemoryCache(*s.memoryCache))
+	}
+
+	if s.fidPoolBatch > 0 {
+		c.UseFileIDPool(NewFileIDPool(c, s.fidPoolBatch, s.fidPoolLowWatermark))
+	}
+
+	return
+}
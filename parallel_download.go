@@ -0,0 +1,421 @@
+package goseaweedfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+const (
+	defaultDownloadConcurrency = 4
+	defaultDownloadRangeSize   = 8 << 20
+	defaultDownloadRetries     = 2
+)
+
+// ParallelDownloadOptions options for downloading file concurrently by ranges.
+type ParallelDownloadOptions struct {
+	// Concurrency number of ranges fetched at the same time. Default: client concurrency or 4.
+	Concurrency int
+
+	// RangeSize size of each range. Default: chunk size of client or 8MB. Chunked files are split by their chunks instead.
+	RangeSize int64
+
+	// Retries number of retries for each range. Each retry is sent to another replica if possible.
+	// Default: 2. Negative value disables retrying.
+	Retries int
+
+	// Args extra args for looking up volumes, e.g: collection.
+	Args url.Values
+
+	// Progress receives progress of download. Chunk is index of chunk for chunked files.
+	Progress ProgressFunc
+
+	// CipherKey key of file encrypted in cipher mode, see FilePart.CipherKey. Such file is downloaded sequentially
+	// unless it is chunked.
+	CipherKey []byte
+}
+
+func (c *Seaweed) normalizeParallelDownloadOptions(opts *ParallelDownloadOptions) ParallelDownloadOptions {
+	var o ParallelDownloadOptions
+	if opts != nil {
+		o = *opts
+	}
+
+	if o.Concurrency <= 0 {
+		if o.Concurrency = c.concurrency; o.Concurrency <= 0 {
+			o.Concurrency = defaultDownloadConcurrency
+		}
+	}
+	if o.RangeSize <= 0 {
+		if o.RangeSize = c.chunkSize; o.RangeSize <= 0 {
+			o.RangeSize = defaultDownloadRangeSize
+		}
+	}
+	if o.Retries < 0 {
+		o.Retries = 0
+	} else if opts == nil || opts.Retries == 0 {
+		o.Retries = defaultDownloadRetries
+	}
+
+	return o
+}
+
+// downloadTask a piece of file to be fetched and written at offset.
+type downloadTask struct {
+	fileID string
+	offset int64
+
+	// rng range to request, nil means whole file (chunk).
+	rng *ByteRange
+
+	// size expected size of piece.
+	size int64
+
+	// chunk index of chunk of chunked file, -1 for range of file.
+	chunk int
+
+	// sums checksums of chunk recorded in manifest, verified after chunk is fetched.
+	sums Checksums
+
+	// key decrypts chunk of encrypted file.
+	key *contentKey
+
+	// cipherKey decrypts chunk encrypted in cipher mode.
+	cipherKey []byte
+
+	// compressed chunk is decompressed by client after decryption.
+	compressed bool
+}
+
+// DownloadTo downloads file by id into w. File size is discovered with a HEAD request, then file is split
+// into ranges (or chunks for chunked file) which are fetched concurrently from replicas of volume
+// and written in place.
+func (c *Seaweed) DownloadTo(fileID string, w io.WriterAt, opts *ParallelDownloadOptions) (size int64, err error) {
+	return c.DownloadToContext(context.Background(), fileID, w, opts)
+}
+
+// DownloadToContext is like DownloadTo, with context ctx.
+func (c *Seaweed) DownloadToContext(ctx context.Context, fileID string, w io.WriterAt, opts *ParallelDownloadOptions) (size int64, err error) {
+	ctx, end := c.startCall(ctx, OpDownloadTo, fileIDAttributes(fileID)...)
+	defer end(&err)
+
+	o := c.normalizeParallelDownloadOptions(opts)
+
+	progress := newProgressTracker(o.Progress, "", fileID, -1)
+	defer func() { progress.done(err) }()
+
+	locations := newLocationCache(c, o.Args)
+
+	urls, err := locations.urls(ctx, fileID, nil)
+	if err != nil {
+		return
+	}
+
+	auth := (*DownloadOptions)(nil).withHeader(authHeader(c.jwt.readToken(fileID)))
+
+	var head *DownloadResponse
+	for i := range urls {
+		if head, err = c.client.head(ctx, OpHead, urls[i], auth); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	if isCiphered(head.Header) && len(o.CipherKey) == 0 {
+		return 0, ErrNoCipherKey
+	}
+
+	var tasks []downloadTask
+	if isChunkedFile(head) {
+		var cm *ChunkManifest
+		if cm, err = c.readChunkManifest(ctx, fileID, locations); err != nil {
+			return
+		}
+		if err = cm.unsealKeys(o.CipherKey); err != nil {
+			return
+		}
+
+		var key *contentKey
+		if cm.Encryption != nil {
+			if key, err = cm.Encryption.open(ctx, c.keys, fileID); err != nil {
+				return
+			}
+		}
+
+		size = cm.Size
+		tasks = make([]downloadTask, len(cm.Chunks))
+		for i, chunk := range cm.Chunks {
+			tasks[i] = downloadTask{fileID: chunk.Fid, offset: chunk.Offset, size: chunk.Size, chunk: i, sums: chunk.Checksums, key: key, cipherKey: chunk.CipherKey}
+		}
+	} else if env := envelopeFromHeader(head.Header); env != nil || len(o.CipherKey) > 0 { // ranges of encrypted content can not be decrypted
+		var key *contentKey
+		if size = head.ContentLength; size >= 0 && len(o.CipherKey) > 0 {
+			size = cipherSize(size)
+		}
+		if env != nil {
+			if key, err = env.open(ctx, c.keys, fileID); err != nil {
+				return
+			}
+			if size >= 0 {
+				size = plainSize(size)
+			}
+		}
+		progress.setFile(head.FileName, "", size)
+		return c.downloadSequentially(ctx, urls, auth, w, progress, key, o.CipherKey)
+	} else {
+		// ranges of content compressed unknown to volume server are of compressed content
+		if size = head.ContentLength; size < 0 || head.Header.Get(headerContentEncoding) != "" {
+			return c.downloadSequentially(ctx, urls, auth, w, progress, nil, nil)
+		}
+
+		for offset := int64(0); offset < size; offset += o.RangeSize {
+			length := o.RangeSize
+			if offset+length > size {
+				length = size - offset
+			}
+
+			tasks = append(tasks, downloadTask{
+				fileID: fileID,
+				offset: offset,
+				rng:    &ByteRange{Offset: offset, Length: length},
+				size:   length,
+				chunk:  -1,
+			})
+		}
+	}
+
+	setSpanAttributes(ctx, attrBytes.Int64(size))
+	progress.setFile(head.FileName, "", size)
+	err = c.runDownloadTasks(ctx, tasks, w, locations, o, progress)
+	return
+}
+
+// runDownloadTasks downloads tasks concurrently. First failure cancels pieces in flight and stops starting others.
+func (c *Seaweed) runDownloadTasks(ctx context.Context, tasks []downloadTask, w io.WriterAt, locations *locationCache, o ParallelDownloadOptions, progress *progressTracker) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		once     sync.Once
+		firstErr error
+		failed   = make(chan struct{})
+		sem      = make(chan struct{}, o.Concurrency)
+	)
+
+	for i := range tasks {
+		select {
+		case <-failed:
+			wg.Wait()
+			return firstErr
+		case sem <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			if err := c.downloadPiece(ctx, &tasks[i], i, w, locations, o.Retries, progress); err != nil {
+				once.Do(func() {
+					firstErr = err
+					close(failed)
+					cancel()
+				})
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// downloadPiece fetches a piece with retries. Attempts are spread over replicas, starting from a replica
+// depending on piece index so that concurrent pieces are fetched from different replicas.
+func (c *Seaweed) downloadPiece(ctx context.Context, task *downloadTask, index int, w io.WriterAt, locations *locationCache, retries int, progress *progressTracker) (err error) {
+	copyPiece := func(r io.Reader) error {
+		src := newCipherReader(newVerifyingReader(r, task.fileID, task.sums), task.cipherKey)
+		if task.key != nil {
+			src = newDecryptingReader(src, task.key, task.offset)
+		}
+		if task.compressed {
+			d, err := newSniffingDecompressor(src)
+			if err != nil {
+				return err
+			}
+			defer d.Close()
+			src = d
+		}
+
+		n, err := io.Copy(&offsetWriter{w: w, offset: task.offset}, progress.reader(src, task.chunk))
+		if err == nil && task.size > 0 && n != task.size {
+			err = fmt.Errorf("Download %s: expected %d bytes but got %d", task.fileID, task.size, n)
+		}
+		if err != nil {
+			progress.rollback(n)
+		}
+		return err
+	}
+
+	// whole chunks are cached, corrupted cached chunk is downloaded again
+	if task.rng == nil {
+		if cached := c.cache.open(fileIDCacheKey(task.fileID)); cached != nil {
+			err = copyPiece(cached)
+			_ = cached.Close()
+			if err == nil {
+				return
+			}
+			c.cache.remove(fileIDCacheKey(task.fileID))
+		}
+	}
+
+	urls, err := locations.urls(ctx, task.fileID, nil)
+	if err != nil {
+		return
+	}
+
+	var opts *DownloadOptions
+	if task.rng != nil {
+		opts = &DownloadOptions{Ranges: []ByteRange{*task.rng}}
+	}
+	opts = opts.withHeader(authHeader(c.jwt.readToken(task.fileID)))
+
+	for attempt := 0; attempt <= retries; attempt++ {
+		fileURL := urls[(index+attempt)%len(urls)]
+		if attempt > 0 {
+			observeRetry(c.metrics, OpDownload, hostOf(urls[(index+attempt-1)%len(urls)]))
+		}
+
+		_, err = c.client.downloadWithOptions(ctx, OpDownload, fileURL, opts, func(resp *DownloadResponse, r io.Reader) (err error) {
+			if task.rng != nil {
+				if resp.StatusCode != http.StatusPartialContent {
+					return fmt.Errorf("Download %s: range %s is not satisfied. Status:%d", fileURL, task.rng, resp.StatusCode)
+				}
+				return copyPiece(r)
+			}
+
+			body := c.cache.tee(&diskCacheMeta{Key: fileIDCacheKey(task.fileID), Header: resp.Header}, r)
+			err = copyPiece(body)
+			body.done(err)
+			return
+		})
+		if err == nil {
+			return
+		}
+	}
+
+	return
+}
+
+// downloadSequentially downloads whole file from first replica which succeeds, decrypting it with cipher key and by key if set.
+func (c *Seaweed) downloadSequentially(ctx context.Context, urls []string, opts *DownloadOptions, w io.WriterAt, progress *progressTracker, key *contentKey, cipherKey []byte) (size int64, err error) {
+	for i := range urls {
+		_, err = c.client.downloadWithOptions(ctx, OpDownload, urls[i], opts, func(_ *DownloadResponse, r io.Reader) (err error) {
+			if r = newCipherReader(r, cipherKey); key != nil {
+				r = newDecryptingReader(r, key, 0)
+			}
+			if size, err = io.Copy(&offsetWriter{w: w}, progress.reader(r, -1)); err != nil {
+				progress.rollback(size)
+			}
+			return
+		})
+		if err == nil {
+			return
+		}
+	}
+	return
+}
+
+// readChunkManifest reads raw chunk manifest of chunked file.
+func (c *Seaweed) readChunkManifest(ctx context.Context, fileID string, locations *locationCache) (cm *ChunkManifest, err error) {
+	urls, err := locations.urls(ctx, fileID, url.Values{"cm": []string{"false"}})
+	if err != nil {
+		return
+	}
+
+	for i := range urls {
+		var data []byte
+		if data, _, err = c.client.get(ctx, OpDownload, urls[i], authHeader(c.jwt.readToken(fileID))); err == nil {
+			if cm, err = loadChunkManifest(data, isGzipped(data)); err == nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// isChunkedFile checks whether response is of a chunked file (manifest). According to SeaweedFS volume server.
+func isChunkedFile(resp *DownloadResponse) bool {
+	return resp.Header.Get("X-File-Store") == "chunked"
+}
+
+func isGzipped(data []byte) bool {
+	return len(data) > 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// locationCache resolves file ids to read urls of their replicas, looking up each volume once.
+// Urls are ordered by read selector of client.
+type locationCache struct {
+	c    *Seaweed
+	args url.Values
+
+	mu      sync.Mutex
+	volumes map[string]VolumeLocations
+}
+
+func newLocationCache(c *Seaweed, args url.Values) *locationCache {
+	return &locationCache{
+		c:       c,
+		args:    args,
+		volumes: make(map[string]VolumeLocations),
+	}
+}
+
+func (l *locationCache) urls(ctx context.Context, fileID string, args url.Values) (urls []string, err error) {
+	volID, err := parseVolumeID(fileID)
+	if err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	locations, ok := l.volumes[volID]
+	l.mu.Unlock()
+
+	if !ok {
+		if locations, err = l.c.lookupLocations(ctx, fileID, l.args); err != nil {
+			return
+		}
+
+		l.mu.Lock()
+		l.volumes[volID] = locations
+		l.mu.Unlock()
+	}
+
+	locations = l.c.selectForRead(fileID, locations)
+
+	urls = make([]string, len(locations))
+	for i := range locations {
+		urls[i] = l.c.fileURL(locations[i].PublicURL, fileID, args)
+	}
+
+	return
+}
+
+// offsetWriter writes sequentially to an io.WriterAt starting from offset.
+type offsetWriter struct {
+	w      io.WriterAt
+	offset int64
+}
+
+func (o *offsetWriter) Write(p []byte) (n int, err error) {
+	n, err = o.w.WriteAt(p, o.offset)
+	o.offset += int64(n)
+	return
+}
@@ -0,0 +1,155 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newFakeVolumeServer(files map[string][]byte, failures *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures != nil && atomic.AddInt32(failures, -1) >= 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		fid := strings.TrimPrefix(r.URL.Path, "/")
+		data, ok := files[fid]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		if cm, ok := files[fid+".cm"]; ok {
+			w.Header().Set("X-File-Store", "chunked")
+			if r.URL.Query().Get("cm") == "false" {
+				data = cm
+			}
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+	}))
+}
+
+func newFakeMaster(volumes ...*httptest.Server) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result := LookupResult{}
+		for _, v := range volumes {
+			u, _ := url.Parse(v.URL)
+			result.VolumeLocations = append(result.VolumeLocations, &VolumeLocation{URL: u.Host, PublicURL: u.Host})
+		}
+		_ = json.NewEncoder(w).Encode(result)
+	}))
+}
+
+type memWriterAt struct {
+	buf []byte
+}
+
+func (m *memWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	return copy(m.buf[off:], p), nil
+}
+
+func TestDownloadTo(t *testing.T) {
+	content := make([]byte, 100000)
+	rand.Read(content)
+
+	cm := &ChunkManifest{Name: "big", Size: int64(len(content))}
+	for offset, i := 0, 0; offset < len(content); offset, i = offset+30000, i+1 {
+		end := offset + 30000
+		if end > len(content) {
+			end = len(content)
+		}
+		cm.Chunks = append(cm.Chunks, &ChunkInfo{Fid: fmt.Sprintf("3,%02x", i+10), Offset: int64(offset), Size: int64(end - offset)})
+	}
+	manifest, _ := cm.Marshal()
+
+	files := map[string][]byte{
+		"3,01":    content,
+		"3,02":    {},
+		"3,02.cm": manifest,
+	}
+	for _, chunk := range cm.Chunks {
+		files[chunk.Fid] = content[chunk.Offset : chunk.Offset+chunk.Size]
+	}
+
+	var failures int32 = 3
+	v1, v2 := newFakeVolumeServer(files, &failures), newFakeVolumeServer(files, nil)
+	defer v1.Close()
+	defer v2.Close()
+
+	master := newFakeMaster(v1, v2)
+	defer master.Close()
+
+	c, err := NewSeaweed(master.URL, nil, 0, http.DefaultClient)
+	require.Nil(t, err)
+	defer c.Close()
+
+	for _, fid := range []string{"3,01", "3,02"} {
+		w := &memWriterAt{buf: make([]byte, len(content))}
+		size, err := c.DownloadTo(fid, w, &ParallelDownloadOptions{Concurrency: 3, RangeSize: 7000})
+		require.Nil(t, err, fid)
+		require.EqualValues(t, len(content), size)
+		require.Equal(t, content, w.buf)
+	}
+
+	// without retries, failing replica makes download fail
+	atomic.StoreInt32(&failures, 1000)
+	f, err := os.CreateTemp("", "goswfs")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	_, err = c.DownloadTo("3,01", f, &ParallelDownloadOptions{Retries: -1, RangeSize: 7000})
+	require.NotNil(t, err)
+}
+
+func TestDownloadToCancelsPiecesOnFailure(t *testing.T) {
+	cm := &ChunkManifest{Name: "big", Size: 200, Chunks: []*ChunkInfo{
+		{Fid: "3,10", Offset: 0, Size: 100},
+		{Fid: "3,11", Offset: 100, Size: 100},
+	}}
+	manifest, _ := cm.Marshal()
+
+	// 3,10 is missing, 3,11 stalls until its request is cancelled
+	fake := newFakeVolumeServer(map[string][]byte{"3,02": {}, "3,02.cm": manifest}, nil)
+	defer fake.Close()
+
+	var cancelled int32
+	volume := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/3,11" {
+			fake.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			atomic.StoreInt32(&cancelled, 1)
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	defer volume.Close()
+
+	master := newFakeMaster(volume)
+	defer master.Close()
+
+	c, err := NewSeaweed(master.URL, nil, 0, http.DefaultClient)
+	require.Nil(t, err)
+	defer c.Close()
+
+	start := time.Now()
+	_, err = c.DownloadTo("3,02", &memWriterAt{buf: make([]byte, 200)}, &ParallelDownloadOptions{Concurrency: 2, Retries: -1})
+	require.NotNil(t, err)
+	require.Less(t, time.Since(start), 5*time.Second)
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&cancelled) == 1 }, 5*time.Second, 10*time.Millisecond)
+}
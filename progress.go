@@ -0,0 +1,131 @@
+package goseaweedfs
+
+import (
+	"io"
+	"sync"
+)
+
+// ProgressEvent progress of transferring a file.
+type ProgressEvent struct {
+	FileName string
+	FileID   string
+
+	// Transferred bytes of file transferred so far.
+	Transferred int64
+
+	// Total size of file, -1 if unknown.
+	Total int64
+
+	// Chunk index of chunk being transferred, -1 if file is not transferred by chunks.
+	Chunk int
+
+	// Done transfer of file completed. Err is set if it failed.
+	Done bool
+	Err  error
+}
+
+// ProgressFunc receives progress of a transfer. Calls for a file are sequential, the last one has Done set.
+// Calls for different files of a batch may be concurrent. Callback must not block.
+type ProgressFunc func(ProgressEvent)
+
+// progressTracker reports progress of transferring a file. Nil tracker reports nothing.
+type progressTracker struct {
+	mu    sync.Mutex
+	fn    ProgressFunc
+	event ProgressEvent
+}
+
+func newProgressTracker(fn ProgressFunc, fileName, fileID string, total int64) *progressTracker {
+	if fn == nil {
+		return nil
+	}
+	if total <= 0 {
+		total = -1
+	}
+	return &progressTracker{fn: fn, event: ProgressEvent{FileName: fileName, FileID: fileID, Total: total, Chunk: -1}}
+}
+
+func (t *progressTracker) setFile(fileName, fileID string, total int64) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	if fileName != "" {
+		t.event.FileName = fileName
+	}
+	if fileID != "" {
+		t.event.FileID = fileID
+	}
+	if total > 0 {
+		t.event.Total = total
+	}
+	t.mu.Unlock()
+}
+
+func (t *progressTracker) add(n int64, chunk int) {
+	if t == nil || n <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	t.event.Transferred += n
+	t.event.Chunk = chunk
+	t.fn(t.event)
+	t.mu.Unlock()
+}
+
+func (t *progressTracker) done(err error) {
+	if t == nil {
+		return
+	}
+
+	t.mu.Lock()
+	t.event.Done, t.event.Err = true, err
+	t.fn(t.event)
+	t.mu.Unlock()
+}
+
+// rollback discounts bytes of failed attempt which is retried. Nothing is reported.
+func (t *progressTracker) rollback(n int64) {
+	if t == nil || n <= 0 {
+		return
+	}
+
+	t.mu.Lock()
+	t.event.Transferred -= n
+	t.mu.Unlock()
+}
+
+// reader wraps r, reporting bytes read as transferred bytes of chunk.
+func (t *progressTracker) reader(r io.Reader, chunk int) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &progressReader{r: r, t: t, chunk: chunk}
+}
+
+type progressReader struct {
+	r     io.Reader
+	t     *progressTracker
+	chunk int
+}
+
+func (r *progressReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	r.t.add(int64(n), r.chunk)
+	return
+}
+
+// trackDownload wraps download callback, reporting bytes read from response body. Returned function reports completion.
+func trackDownload(fn ProgressFunc, fileID string, callback func(*DownloadResponse, io.Reader) error) (func(*DownloadResponse, io.Reader) error, func(error)) {
+	t := newProgressTracker(fn, "", fileID, -1)
+	if t == nil {
+		return callback, func(error) {}
+	}
+
+	return func(resp *DownloadResponse, r io.Reader) error {
+		t.setFile(resp.FileName, "", resp.ContentLength)
+		return callback(resp, t.reader(r, -1))
+	}, t.done
+}
@@ -0,0 +1,60 @@
+package goseaweedfs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadDownloadProgress(t *testing.T) {
+	cluster := newFakeCluster()
+	defer cluster.Close()
+
+	c, err := New(WithMasters(cluster.master.URL), WithHTTPClient(http.DefaultClient), WithChunkSize(10))
+	require.Nil(t, err)
+	defer c.Close()
+
+	content := bytes.Repeat([]byte("x"), 25)
+
+	var events []ProgressEvent
+	fp := NewFilePartFromReader(ioutil.NopCloser(bytes.NewReader(content)), "big.bin", int64(len(content)))
+	fp.Progress = func(e ProgressEvent) { events = append(events, e) }
+
+	cm, err := c.UploadFilePart(fp)
+	require.Nil(t, err)
+	require.Len(t, cm.Chunks, 3)
+
+	last := events[len(events)-1]
+	require.True(t, last.Done)
+	require.Nil(t, last.Err)
+	require.Equal(t, "3,01", last.FileID)
+	require.EqualValues(t, 25, last.Transferred)
+	require.EqualValues(t, 25, last.Total)
+	require.Equal(t, 2, last.Chunk)
+
+	chunks := make(map[int]bool)
+	for _, e := range events {
+		chunks[e.Chunk] = true
+	}
+	require.Equal(t, map[int]bool{0: true, 1: true, 2: true}, chunks)
+
+	events = nil
+	_, err = c.DownloadWithOptions(cm.Chunks[0].Fid, nil, &DownloadOptions{
+		Progress: func(e ProgressEvent) { events = append(events, e) },
+	}, func(_ *DownloadResponse, r io.Reader) error {
+		_, err := io.Copy(ioutil.Discard, r)
+		return err
+	})
+	require.Nil(t, err)
+
+	last = events[len(events)-1]
+	require.True(t, last.Done)
+	require.Equal(t, cm.Chunks[0].Fid, last.FileID)
+	require.EqualValues(t, 10, last.Transferred)
+	require.EqualValues(t, 10, last.Total)
+	require.Equal(t, -1, last.Chunk)
+}
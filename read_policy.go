@@ -0,0 +1,480 @@
+package goseaweedfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ReadPolicy controls how reads are spread over replicas of a volume. Reads fail over to other replicas
+// on connection errors, timeouts and 5xx responses.
+type ReadPolicy struct {
+	// MaxAttempts max number of replicas tried for a read. Default: all replicas.
+	MaxAttempts int
+
+	// HedgeDelay if positive, another replica is requested when previous requests have not responded
+	// after this delay. The first successful response wins, others are cancelled.
+	HedgeDelay time.Duration
+}
+
+// SetReadPolicy sets policy for reading from replicas. Must be called before using client.
+func (c *Seaweed) SetReadPolicy(p ReadPolicy) {
+	c.readPolicy = p
+}
+
+// readFile reads file from replicas of its volume, failing over or hedging according to read policy.
+func (c *Seaweed) readFile(ctx context.Context, fileID string, args url.Values, opts *DownloadOptions, callback func(*DownloadResponse, io.Reader) error) (resp *DownloadResponse, err error) {
+	ctx, end := c.startCall(ctx, OpDownload, fileIDAttributes(fileID)...)
+	defer end(&err)
+
+	defer func() {
+		if resp != nil {
+			setSpanAttributes(ctx, attrBytes.Int64(resp.ContentLength))
+		}
+	}()
+
+	callback, done := trackDownload(opts.progress(), fileID, callback)
+	defer func() { done(err) }()
+
+	plain := callback
+	callback = decryptDownload(ctx, c.keys, fileID, callback)
+	callback = decipherDownload(opts.cipherKey(), callback)
+	if c.checksums {
+		callback = verifyDownload(fileID, callback)
+	}
+
+	// whole content is cached as received, so that it is decrypted and verified on cache hits too
+	var cacheMeta func(*DownloadResponse) *diskCacheMeta
+	if c.cache != nil && opts.wholeContent() {
+		var hit bool
+		if resp, hit, err = c.cache.read(fileIDCacheKey(fileID), callback); hit {
+			return
+		}
+		cacheMeta = fileIDCacheMeta(fileID)
+	}
+
+	locations, err := c.lookupLocations(ctx, fileID, args)
+	if err != nil {
+		return
+	}
+
+	locations = c.selectForRead(fileID, locations)
+	if n := c.readPolicy.MaxAttempts; n > 0 && n < len(locations) {
+		locations = locations[:n]
+	}
+
+	targets := make([]readTarget, len(locations))
+	for i, loc := range locations {
+		targets[i] = readTarget{server: loc.PublicURL, url: c.fileURL(loc.PublicURL, fileID, nil)}
+	}
+
+	r, err := c.openRead(ctx, targets, opts.withHeader(authHeader(c.jwt.readToken(fileID))))
+	if err != nil {
+		return
+	}
+
+	// chunks may be encrypted or have checksums to verify, read them by client instead of volume server
+	if head := newDownloadResponse(r); (c.keys != nil || c.cipher || c.checksums || isCiphered(head.Header)) && !head.NotModified && isChunkedFile(head) {
+		_ = r.Body.Close()
+		resp, err = c.readChunkedFile(ctx, fileID, args, head, opts, plain)
+	} else {
+		resp, err = c.client.consumeDownload(r, c.cache.fill(cacheMeta, callback))
+	}
+
+	return
+}
+
+// readChunkedFile reads chunks of chunked file in order, decrypting them if file or chunks are encrypted. Checksums of chunks
+// are verified. Head is response of volume server to conditional options, a single range of options is read by reading only
+// chunks and segments of encrypted chunks it covers.
+func (c *Seaweed) readChunkedFile(ctx context.Context, fileID string, args url.Values, head *DownloadResponse, opts *DownloadOptions, callback func(*DownloadResponse, io.Reader) error) (resp *DownloadResponse, err error) {
+	var ranges []ByteRange
+	if opts != nil {
+		ranges = opts.Ranges
+	}
+	if len(ranges) > 1 {
+		return nil, errors.New("seaweedfs: multiple ranges of chunked file read by client are not supported")
+	}
+
+	locations := newLocationCache(c, args)
+
+	cm, err := c.readChunkManifest(ctx, fileID, locations)
+	if err != nil {
+		return
+	}
+	if err = cm.unsealKeys(opts.cipherKey()); err != nil {
+		return
+	}
+
+	var key *contentKey
+	if cm.Encryption != nil {
+		if key, err = cm.Encryption.open(ctx, c.keys, fileID); err != nil {
+			return
+		}
+	}
+
+	resp = &DownloadResponse{
+		StatusCode:    http.StatusOK,
+		FileName:      cm.Name,
+		ETag:          head.ETag,
+		ContentLength: cm.Size,
+		ContentType:   cm.Mime,
+		LastModified:  head.LastModified,
+		Header:        head.Header,
+	}
+
+	lo, hi := int64(0), cm.Size
+	if len(ranges) == 1 {
+		if lo, hi = ranges[0].Offset, cm.Size; ranges[0].Length > 0 && lo+ranges[0].Length < hi {
+			hi = lo + ranges[0].Length
+		}
+		if lo < 0 || lo >= cm.Size {
+			return nil, &statusError{method: "Download", url: fileID, status: http.StatusText(http.StatusRequestedRangeNotSatisfiable), code: http.StatusRequestedRangeNotSatisfiable}
+		}
+
+		resp.StatusCode, resp.ContentLength = http.StatusPartialContent, hi-lo
+		resp.Header = head.Header.Clone()
+		resp.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", lo, hi-1, cm.Size))
+	}
+
+	pr, pw := io.Pipe()
+	var copyErr error
+	copied := make(chan struct{})
+	go func() {
+		defer close(copied)
+
+		for _, chunk := range cm.Chunks {
+			from, to := chunk.Offset, chunk.Offset+chunk.Size
+			if from < lo {
+				from = lo
+			}
+			if to > hi {
+				to = hi
+			}
+			if from >= to && chunk.Size > 0 {
+				continue
+			}
+
+			if from == chunk.Offset && to == chunk.Offset+chunk.Size {
+				copyErr = c.copyChunk(ctx, pw, chunk, locations, key)
+			} else {
+				copyErr = c.copyChunkRange(ctx, pw, chunk, locations, key, from-chunk.Offset, to-chunk.Offset)
+			}
+			if copyErr != nil {
+				break
+			}
+		}
+		_ = pw.CloseWithError(copyErr)
+	}()
+
+	err = callback(resp, pr)
+	_ = pr.Close()
+	<-copied
+
+	// callback may not read till failure of copying
+	if err == nil && copyErr != nil && !errors.Is(copyErr, io.ErrClosedPipe) {
+		err = copyErr
+	}
+
+	return
+}
+
+// copyChunk writes content of chunk to w, trying replicas until one is opened.
+func (c *Seaweed) copyChunk(ctx context.Context, w io.Writer, chunk *ChunkInfo, locations *locationCache, key *contentKey) (err error) {
+	chunkReader := func(r io.Reader) io.Reader {
+		src := newCipherReader(newVerifyingReader(r, chunk.Fid, chunk.Checksums), chunk.CipherKey)
+		if key != nil {
+			src = newDecryptingReader(src, key, chunk.Offset)
+		}
+		return src
+	}
+
+	if cached := c.cache.open(fileIDCacheKey(chunk.Fid)); cached != nil {
+		defer cached.Close()
+		if _, err = io.Copy(w, chunkReader(cached)); err != nil {
+			c.cache.remove(fileIDCacheKey(chunk.Fid))
+		}
+		return
+	}
+
+	urls, err := locations.urls(ctx, chunk.Fid, nil)
+	if err != nil {
+		return
+	}
+
+	opts := (*DownloadOptions)(nil).withHeader(authHeader(c.jwt.readToken(chunk.Fid)))
+	for i := range urls {
+		var r *http.Response
+		if r, err = c.client.openDownload(ctx, OpDownload, urls[i], opts); err != nil {
+			continue
+		}
+
+		body := c.cache.tee(&diskCacheMeta{Key: fileIDCacheKey(chunk.Fid), Header: r.Header}, r.Body)
+		_, err = io.Copy(w, chunkReader(body))
+		body.done(err)
+		c.client.drainAndClose(r)
+		return
+	}
+
+	return
+}
+
+// copyChunkRange writes plain text range [lo, hi) of chunk to w. Chunks encrypted by client are read by segments covering
+// the range, other chunks by the range itself. Chunks which are cached, encrypted in cipher mode or have checksums to verify
+// are read whole.
+func (c *Seaweed) copyChunkRange(ctx context.Context, w io.Writer, chunk *ChunkInfo, locations *locationCache, key *contentKey, lo, hi int64) (err error) {
+	whole := chunk.CipherKey != nil || !chunk.Checksums.IsZero()
+	if cached := c.cache.open(fileIDCacheKey(chunk.Fid)); cached != nil {
+		_ = cached.Close()
+		whole = true
+	}
+	if whole {
+		return c.copyChunk(ctx, &rangeWriter{w: w, skip: lo, n: hi - lo}, chunk, locations, key)
+	}
+
+	urls, err := locations.urls(ctx, chunk.Fid, nil)
+	if err != nil {
+		return
+	}
+	auth := authHeader(c.jwt.readToken(chunk.Fid))
+
+	read := func(rng ByteRange, fn func(io.Reader) error) (err error) {
+		opts := (&DownloadOptions{Ranges: []ByteRange{rng}}).withHeader(auth)
+		for i := range urls {
+			var r *http.Response
+			if r, err = c.client.openDownload(ctx, OpDownload, urls[i], opts); err != nil {
+				continue
+			}
+			if r.StatusCode != http.StatusPartialContent {
+				err = fmt.Errorf("Download %s: range %s is not satisfied. Status:%d", urls[i], rng, r.StatusCode)
+			} else {
+				err = fn(r.Body)
+			}
+			c.client.drainAndClose(r)
+			return
+		}
+		return
+	}
+
+	copyN := func(r io.Reader, skip, n int64) (err error) {
+		if skip > 0 {
+			if _, err = io.CopyN(ioutil.Discard, r, skip); err != nil {
+				return truncated(err)
+			}
+		}
+		if _, err = io.CopyN(w, r, n); err != nil {
+			return truncated(err)
+		}
+		return nil
+	}
+
+	if key == nil {
+		return read(ByteRange{Offset: lo, Length: hi - lo}, func(r io.Reader) error {
+			return copyN(r, 0, hi-lo)
+		})
+	}
+
+	header := make([]byte, encryptionHeaderSize)
+	if err = read(ByteRange{Length: encryptionHeaderSize}, func(r io.Reader) (err error) {
+		_, err = io.ReadFull(r, header)
+		return truncated(err)
+	}); err != nil {
+		return
+	}
+
+	sealed, first, last, skip := segmentRange(lo, hi, chunk.Size)
+	return read(sealed, func(r io.Reader) error {
+		src, err := newSegmentDecryptingReader(r, key, chunk.Offset, header, first, last)
+		if err == nil {
+			err = copyN(src, skip, hi-lo)
+		}
+		return err
+	})
+}
+
+// rangeWriter writes n bytes after skipping skip bytes to w, discarding the rest.
+type rangeWriter struct {
+	w       io.Writer
+	skip, n int64
+}
+
+func (r *rangeWriter) Write(p []byte) (int, error) {
+	size := len(p)
+	if r.skip > 0 {
+		if int64(len(p)) <= r.skip {
+			r.skip -= int64(len(p))
+			return size, nil
+		}
+		p, r.skip = p[r.skip:], 0
+	}
+	if int64(len(p)) > r.n {
+		p = p[:r.n]
+	}
+	if len(p) > 0 {
+		if _, err := r.w.Write(p); err != nil {
+			return 0, err
+		}
+		r.n -= int64(len(p))
+	}
+	return size, nil
+}
+
+// readTarget a replica to read from.
+type readTarget struct {
+	server string
+	url    string
+}
+
+func (c *Seaweed) openRead(ctx context.Context, targets []readTarget, opts *DownloadOptions) (r *http.Response, err error) {
+	if c.readPolicy.HedgeDelay <= 0 || len(targets) == 1 {
+		for i := range targets {
+			if r, err = c.openReadTarget(ctx, targets[i], opts); err == nil || !isRetriableReadError(err) {
+				return
+			}
+			if i+1 < len(targets) {
+				observeRetry(c.metrics, OpDownload, hostOf(targets[i].url))
+			}
+		}
+		return
+	}
+
+	return c.openHedgedRead(ctx, targets, opts)
+}
+
+// openReadTarget opens read on a replica, reporting outcome to read selector if it accepts feedback.
+func (c *Seaweed) openReadTarget(ctx context.Context, target readTarget, opts *DownloadOptions) (r *http.Response, err error) {
+	feedback, ok := c.readSelector.(LocationFeedback)
+	if !ok {
+		return c.client.openDownload(ctx, OpDownload, target.url, opts)
+	}
+
+	feedback.Begin(target.server)
+	start := time.Now()
+
+	r, err = c.client.openDownload(ctx, OpDownload, target.url, opts)
+	latency := time.Since(start)
+
+	if err != nil {
+		feedback.Done(target.server, latency, err)
+	} else {
+		r.Body = &callOnClose{ReadCloser: r.Body, fn: func() {
+			feedback.Done(target.server, latency, nil)
+		}}
+	}
+
+	return
+}
+
+type hedgedResult struct {
+	index int
+	r     *http.Response
+	err   error
+}
+
+// openHedgedRead requests replicas one by one, firing the next request when a previous one failed
+// with retriable error or has not responded after hedge delay.
+func (c *Seaweed) openHedgedRead(ctx context.Context, targets []readTarget, opts *DownloadOptions) (r *http.Response, err error) {
+	results := make(chan hedgedResult, len(targets))
+	cancels := make([]context.CancelFunc, 0, len(targets))
+	inflight := 0
+
+	fire := func() {
+		ctx, cancel := context.WithCancel(ctx)
+		go func(index int) {
+			r, err := c.openReadTarget(ctx, targets[index], opts)
+			results <- hedgedResult{index: index, r: r, err: err}
+		}(len(cancels))
+		cancels = append(cancels, cancel)
+		inflight++
+	}
+
+	// stop cancels in-flight requests except winner, releasing their responses in background.
+	stop := func(winner int) {
+		for i := range cancels {
+			if i != winner {
+				cancels[i]()
+			}
+		}
+
+		if inflight > 0 {
+			go func(n int) {
+				for i := 0; i < n; i++ {
+					if res := <-results; res.r != nil {
+						_ = res.r.Body.Close()
+					}
+				}
+			}(inflight)
+		}
+	}
+
+	timer := time.NewTimer(c.readPolicy.HedgeDelay)
+	defer timer.Stop()
+
+	fire()
+	for inflight > 0 {
+		select {
+		case <-timer.C:
+			if len(cancels) < len(targets) {
+				fire()
+				timer.Reset(c.readPolicy.HedgeDelay)
+			}
+
+		case res := <-results:
+			inflight--
+
+			if res.err == nil {
+				r, err = res.r, nil
+				r.Body = &callOnClose{ReadCloser: r.Body, fn: cancels[res.index]}
+				stop(res.index)
+				return
+			}
+
+			if err = res.err; !isRetriableReadError(err) {
+				stop(-1)
+				return
+			}
+
+			if len(cancels) < len(targets) { // failed without waiting for hedge delay, others may still be in flight
+				observeRetry(c.metrics, OpDownload, hostOf(targets[res.index].url))
+				fire()
+			}
+		}
+	}
+
+	stop(-1)
+	return
+}
+
+// isRetriableReadError reports whether read should be retried on another replica: connection errors,
+// timeouts and 5xx responses. Cancelled reads and exceeded deadlines are not retried.
+func isRetriableReadError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.code >= http.StatusInternalServerError
+	}
+
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// callOnClose calls fn after closing underlying reader.
+type callOnClose struct {
+	io.ReadCloser
+	fn func()
+}
+
+func (c *callOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.fn()
+	return err
+}
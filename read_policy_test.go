@@ -0,0 +1,124 @@
+package goseaweedfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadFailover(t *testing.T) {
+	files := map[string][]byte{"3,01": []byte("hello")}
+
+	var failures int32 = 1 << 20
+	broken, healthy := newFakeVolumeServer(files, &failures), newFakeVolumeServer(files, nil)
+	defer broken.Close()
+	defer healthy.Close()
+
+	master := newFakeMaster(broken, healthy)
+	defer master.Close()
+
+	c, err := NewSeaweed(master.URL, nil, 0, http.DefaultClient)
+	require.Nil(t, err)
+
+	for i := 0; i < 10; i++ {
+		var data []byte
+		_, err = c.Download("3,01", nil, func(r io.Reader) (err error) {
+			data, err = ioutil.ReadAll(r)
+			return
+		})
+		require.Nil(t, err)
+		require.Equal(t, "hello", string(data))
+	}
+
+	// not found is not retried
+	_, err = c.Download("3,02", nil, func(r io.Reader) error { return nil })
+	require.NotNil(t, err)
+	require.False(t, isRetriableReadError(err))
+
+	// neither are cancelled reads
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.DownloadContext(ctx, "3,01", nil, func(r io.Reader) error { return nil })
+	require.True(t, errors.Is(err, context.Canceled))
+	require.False(t, isRetriableReadError(err))
+	require.False(t, isRetriableReadError(fmt.Errorf("read: %w", context.DeadlineExceeded)))
+}
+
+func TestDownloadHedged(t *testing.T) {
+	files := map[string][]byte{"3,01": []byte("hello")}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer slow.Close()
+
+	fast := newFakeVolumeServer(files, nil)
+	defer fast.Close()
+
+	master := newFakeMaster(slow, fast)
+	defer master.Close()
+
+	c, err := NewSeaweed(master.URL, nil, 0, http.DefaultClient)
+	require.Nil(t, err)
+	c.SetReadPolicy(ReadPolicy{HedgeDelay: 20 * time.Millisecond})
+
+	for i := 0; i < 5; i++ {
+		start := time.Now()
+
+		var data []byte
+		_, err = c.Download("3,01", nil, func(r io.Reader) (err error) {
+			data, err = ioutil.ReadAll(r)
+			return
+		})
+		require.Nil(t, err)
+		require.Equal(t, "hello", string(data))
+		require.Less(t, int64(time.Since(start)), int64(time.Second))
+	}
+}
+
+func TestDownloadHedgedFailure(t *testing.T) {
+	files := map[string][]byte{"3,01": []byte("hello")}
+
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer slow.Close()
+
+	var failures int32 = 1 << 20
+	broken, fast := newFakeVolumeServer(files, &failures), newFakeVolumeServer(files, nil)
+	defer broken.Close()
+	defer fast.Close()
+
+	master := newFakeMaster(slow, broken, fast)
+	defer master.Close()
+
+	c, err := NewSeaweed(master.URL, nil, 0, http.DefaultClient)
+	require.Nil(t, err)
+	c.SetLocationSelectors(HeadSelector, nil)
+	c.SetReadPolicy(ReadPolicy{HedgeDelay: 300 * time.Millisecond})
+
+	// failure of hedged request fires next one, although slow request is still in flight
+	start := time.Now()
+	_, err = c.Download("3,01", nil, func(r io.Reader) error {
+		_, err := ioutil.ReadAll(r)
+		return err
+	})
+	require.Nil(t, err)
+	require.Less(t, int64(time.Since(start)), int64(550*time.Millisecond))
+}
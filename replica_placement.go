@@ -0,0 +1,112 @@
+package goseaweedfs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrInvalidReplication invalid replication string. Replication must be 3 digits, e.g: "001".
+var ErrInvalidReplication = errors.New("Invalid replication")
+
+// ReplicaPlacement replication type of volumes. According to https://github.com/chrislusf/seaweedfs/wiki/Replication
+//
+//	000: no replication
+//	001: replicate once on the same rack
+//	010: replicate once on a different rack, but same data center
+//	100: replicate once on a different data center
+//	200: replicate twice on two different data centers
+//	110: replicate once on a different rack, and once on a different data center
+type ReplicaPlacement struct {
+	DiffDataCenterCount int
+	DiffRackCount       int
+	SameRackCount       int
+}
+
+// NewReplicaPlacement creates replica placement from number of copies in other data centers,
+// other racks (same data center) and other data nodes (same rack).
+func NewReplicaPlacement(dataCenter, rack, node int) (*ReplicaPlacement, error) {
+	if dataCenter < 0 || dataCenter > 9 || rack < 0 || rack > 9 || node < 0 || node > 9 {
+		return nil, fmt.Errorf("%w: %d%d%d", ErrInvalidReplication, dataCenter, rack, node)
+	}
+
+	return &ReplicaPlacement{
+		DiffDataCenterCount: dataCenter,
+		DiffRackCount:       rack,
+		SameRackCount:       node,
+	}, nil
+}
+
+// ParseReplicaPlacement parses replication string, e.g: "001". Empty string is parsed to nil,
+// which means master's default replication.
+func ParseReplicaPlacement(s string) (*ReplicaPlacement, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	if len(s) != 3 {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidReplication, s)
+	}
+
+	var digits [3]int
+	for i := range digits {
+		if s[i] < '0' || s[i] > '9' {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidReplication, s)
+		}
+		digits[i] = int(s[i] - '0')
+	}
+
+	return NewReplicaPlacement(digits[0], digits[1], digits[2])
+}
+
+// String encodes replica placement to SeaweedFS format. Nil placement is encoded to empty string.
+func (rp *ReplicaPlacement) String() string {
+	if rp == nil {
+		return ""
+	}
+	return strconv.Itoa(rp.DiffDataCenterCount) + strconv.Itoa(rp.DiffRackCount) + strconv.Itoa(rp.SameRackCount)
+}
+
+// CopyCount total number of copies, including the original one.
+func (rp *ReplicaPlacement) CopyCount() int {
+	if rp == nil {
+		return 1
+	}
+	return rp.DiffDataCenterCount + rp.DiffRackCount + rp.SameRackCount + 1
+}
+
+// Validate checks whether topology has enough data centers, racks and data nodes for this placement.
+func (rp *ReplicaPlacement) Validate(topo *Topology) error {
+	if rp == nil || topo == nil {
+		return nil
+	}
+
+	if len(topo.DataCenters) < rp.DiffDataCenterCount+1 {
+		return fmt.Errorf("%w: %s requires %d data centers, topology has %d",
+			ErrInvalidReplication, rp, rp.DiffDataCenterCount+1, len(topo.DataCenters))
+	}
+
+	maxRacks, maxNodes := 0, 0
+	for _, dc := range topo.DataCenters {
+		if len(dc.Racks) > maxRacks {
+			maxRacks = len(dc.Racks)
+		}
+		for _, rack := range dc.Racks {
+			if len(rack.DataNodes) > maxNodes {
+				maxNodes = len(rack.DataNodes)
+			}
+		}
+	}
+
+	if maxRacks < rp.DiffRackCount+1 {
+		return fmt.Errorf("%w: %s requires %d racks in a data center, topology has at most %d",
+			ErrInvalidReplication, rp, rp.DiffRackCount+1, maxRacks)
+	}
+
+	if maxNodes < rp.SameRackCount+1 {
+		return fmt.Errorf("%w: %s requires %d data nodes in a rack, topology has at most %d",
+			ErrInvalidReplication, rp, rp.SameRackCount+1, maxNodes)
+	}
+
+	return nil
+}
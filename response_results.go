@@ -1,21 +1,30 @@
 package goseaweedfs
 
 // UploadResult contains upload result after put file to SeaweedFS
-// Raw response: {"name":"go1.8.3.linux-amd64.tar.gz","size":82565628,"error":""}
+// Raw response: {"name":"go1.8.3.linux-amd64.tar.gz","size":82565628,"eTag":"8e5a7c0f","contentMd5":"...","error":""}
 type UploadResult struct {
 	Name  string `json:"name,omitempty"`
 	Size  int64  `json:"size,omitempty"`
 	Error string `json:"error,omitempty"`
+
+	// ETag of stored content. Volume server reports CRC32C of stored, possibly compressed, content.
+	ETag string `json:"eTag,omitempty"`
+
+	// ContentMD5 base64 encoded MD5 digest of uploaded content, reported by recent volume servers.
+	ContentMD5 string `json:"contentMd5,omitempty"`
 }
 
 // AssignResult contains assign result.
-// Raw response: {"fid":"1,0a1653fd0f","url":"localhost:8899","publicUrl":"localhost:8899","count":1,"error":""}
+// Raw response: {"fid":"1,0a1653fd0f","url":"localhost:8899","publicUrl":"localhost:8899","count":1,"error":"","auth":"..."}
 type AssignResult struct {
 	FileID    string `json:"fid,omitempty"`
 	URL       string `json:"url,omitempty"`
 	PublicURL string `json:"publicUrl,omitempty"`
 	Count     uint64 `json:"count,omitempty"`
 	Error     string `json:"error,omitempty"`
+
+	// Auth JWT token for writing assigned file id(s), issued if cluster enables jwt signing.
+	Auth string `json:"auth,omitempty"`
 }
 
 // SubmitResult result of submit operation.
@@ -51,6 +60,7 @@ type Topology struct {
 
 // DataCenter stats of a datacenter
 type DataCenter struct {
+	ID    string `json:"Id"`
 	Free  int
 	Max   int
 	Racks []*Rack
@@ -58,6 +68,7 @@ type DataCenter struct {
 
 // Rack stats of racks
 type Rack struct {
+	ID        string `json:"Id"`
 	DataNodes []*DataNode
 	Free      int
 	Max       int
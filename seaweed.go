@@ -2,6 +2,7 @@ package goseaweedfs
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -38,9 +39,27 @@ const (
 	// ParamAssignDataCenter http param to assign a specific data center
 	ParamAssignDataCenter = "dataCenter"
 
+	// ParamAssignRack http param to assign a specific rack.
+	ParamAssignRack = "rack"
+
+	// ParamAssignDataNode http param to assign a specific data node.
+	ParamAssignDataNode = "dataNode"
+
+	// ParamAssignDiskType http param to assign a specific disk type, e.g: hdd, ssd.
+	ParamAssignDiskType = "disk"
+
+	// ParamAssignPreallocate http param to preallocate disk space (in bytes) for new volumes.
+	ParamAssignPreallocate = "preallocate"
+
+	// ParamAssignWritableVolumeCount http param to specify number of writable volumes to keep.
+	ParamAssignWritableVolumeCount = "writableVolumeCount"
+
 	// ParamLookupVolumeID http param to specify volume ID for looking up.
 	ParamLookupVolumeID = "volumeId"
 
+	// ParamLookupFileID http param to look up volume of file id. Master issues write token of file along with locations.
+	ParamLookupFileID = "fileId"
+
 	// ParamLookupPretty http param to make json response prettified or not. Default should not be set.
 	ParamLookupPretty = "pretty"
 
@@ -82,45 +101,62 @@ const (
 	// ParamUnmountVolume           = "volume"
 )
 
-// Seaweed client containing almost features/operations to interact with SeaweedFS
+// Seaweed client containing almost features/operations to interact with SeaweedFS. Methods with Context suffix
+// send requests with ctx: requests are cancelled along with ctx and traced as children of span in ctx.
 type Seaweed struct {
-	master    *url.URL
+	masters   *masterList
 	filers    []*Filer
 	chunkSize int64
 	client    *httpClient
+	fidPool   *FileIDPool
+	metrics   Metrics
+
+	retries     int
+	concurrency int
+
+	readPolicy    ReadPolicy
+	readSelector  LocationSelector
+	writeSelector LocationSelector
+
+	jwt *JWTConfig
+
+	volumeScheme  string
+	volumeSchemes map[string]string
+
+	locality      Locality
+	localSelector LocationSelector
+	topology      *topologyCache
+
+	validatePlacement bool
+
+	checksums   bool
+	keys        KeyProvider
+	compression *CompressionPolicy
+	cipher      bool
+	cache       *DiskCache
+	memCache    *MemoryCache
 }
 
 // NewSeaweed create new seaweed client. Master url must be a valid uri (which includes scheme).
+// Filer urls without scheme use master's scheme. See New for more options.
 func NewSeaweed(masterURL string, filers []string, chunkSize int64, client *http.Client) (c *Seaweed, err error) {
-	u, err := parseURI(masterURL)
-	if err != nil {
-		return
-	}
-
-	c = &Seaweed{
-		master:    u,
-		client:    newHTTPClient(client),
-		chunkSize: chunkSize,
-	}
-
-	if len(filers) > 0 {
-		c.filers = make([]*Filer, 0, len(filers))
-		for i := range filers {
-			var filer *Filer
-			filer, err = newFiler(filers[i], c.client)
-			if err != nil {
-				_ = c.Close()
-				return
-			}
-			c.filers = append(c.filers, filer)
-		}
+	if client == nil {
+		client = http.DefaultClient
 	}
+	return New(WithMasters(masterURL), WithFilers(filers...), WithChunkSize(chunkSize), WithHTTPClient(client))
+}
 
-	return
+// UseFileIDPool makes uploads take file ids from pool instead of requesting master for each file/chunk.
+// Pool is closed along with seaweed client.
+func (c *Seaweed) UseFileIDPool(p *FileIDPool) {
+	c.fidPool = p
 }
 
 // Close underlying daemons.
 func (c *Seaweed) Close() (err error) {
+	if c.fidPool != nil {
+		c.fidPool.Close()
+	}
 	if c.client != nil {
 		err = c.client.Close()
 	}
@@ -134,36 +170,96 @@ func (c *Seaweed) Filers() []*Filer {
 
 // Grow pre-Allocate Volumes.
 func (c *Seaweed) Grow(count int, collection, replication, dataCenter string) error {
-	args := normalize(nil, collection, "")
-	if count > 0 {
-		args.Set(ParamGrowCount, strconv.Itoa(count))
+	return c.GrowContext(context.Background(), count, collection, replication, dataCenter)
+}
+
+// GrowContext is like Grow, with context ctx.
+func (c *Seaweed) GrowContext(ctx context.Context, count int, collection, replication, dataCenter string) error {
+	opts, err := newAssignOptions(collection, replication, "")
+	if err != nil {
+		return err
 	}
-	if replication != "" {
-		args.Set(ParamGrowReplication, replication)
+
+	opts.Count, opts.DataCenter = count, dataCenter
+	return c.GrowWithOptionsContext(ctx, opts)
+}
+
+// GrowWithOptions pre-Allocate volumes with options. Count of options is number of volumes to grow.
+// Master rejects replica placement which cluster topology can not satisfy. Placement is validated against topology
+// beforehand only if client validates placements, see SetPlacementValidation.
+func (c *Seaweed) GrowWithOptions(opts *AssignOptions) (err error) {
+	return c.GrowWithOptionsContext(context.Background(), opts)
+}
+
+// GrowWithOptionsContext is like GrowWithOptions, with context ctx.
+func (c *Seaweed) GrowWithOptionsContext(ctx context.Context, opts *AssignOptions) (err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+
+	if c.validatePlacement && opts != nil && opts.Replication != nil {
+		if err = c.ValidateReplicaPlacementContext(ctx, opts.Replication); err != nil {
+			return
+		}
 	}
-	if dataCenter != "" {
-		args.Set(ParamGrowDataCenter, dataCenter)
+
+	return c.GrowArgsContext(ctx, opts.Values())
+}
+
+// SetPlacementValidation makes GrowWithOptions validate replica placement against cluster topology before growing,
+// see ValidateReplicaPlacement. It costs a /dir/status request per grow and reports errors before master is asked,
+// master rejects such placements anyway, so it is disabled by default.
+func (c *Seaweed) SetPlacementValidation(enabled bool) {
+	c.validatePlacement = enabled
+}
+
+// ValidateReplicaPlacement checks whether cluster topology has enough data centers, racks and data nodes for replica placement.
+func (c *Seaweed) ValidateReplicaPlacement(rp *ReplicaPlacement) (err error) {
+	return c.ValidateReplicaPlacementContext(context.Background(), rp)
+}
+
+// ValidateReplicaPlacementContext is like ValidateReplicaPlacement, with context ctx.
+func (c *Seaweed) ValidateReplicaPlacementContext(ctx context.Context, rp *ReplicaPlacement) (err error) {
+	status, err := c.StatusContext(ctx)
+	if err == nil {
+		err = rp.Validate(&status.Topology)
 	}
-	return c.GrowArgs(args)
+	return
 }
 
 // GrowArgs pre-Allocate volumes with args.
 func (c *Seaweed) GrowArgs(args url.Values) (err error) {
-	_, _, err = c.client.get(encodeURI(*c.master, "/vol/grow", args), nil)
+	return c.GrowArgsContext(context.Background(), args)
+}
+
+// GrowArgsContext is like GrowArgs, with context ctx.
+func (c *Seaweed) GrowArgsContext(ctx context.Context, args url.Values) (err error) {
+	ctx, end := c.startCall(ctx, OpGrow)
+	defer end(&err)
+
+	_, _, err = c.masterGet(ctx, OpGrow, "/vol/grow", args)
 	return
 }
 
 // Lookup volume ID.
 func (c *Seaweed) Lookup(volID string, args url.Values) (result *LookupResult, err error) {
-	result, err = c.doLookup(volID, args)
+	return c.LookupContext(context.Background(), volID, args)
+}
+
+// LookupContext is like Lookup, with context ctx.
+func (c *Seaweed) LookupContext(ctx context.Context, volID string, args url.Values) (result *LookupResult, err error) {
+	ctx, end := c.startCall(ctx, OpLookup, attrVolumeID.String(volID))
+	defer end(&err)
+
+	result, err = c.doLookup(ctx, volID, args)
 	return
 }
 
-func (c *Seaweed) doLookup(volID string, args url.Values) (result *LookupResult, err error) {
+func (c *Seaweed) doLookup(ctx context.Context, volID string, args url.Values) (result *LookupResult, err error) {
 	args = normalize(args, "", "")
 	args.Set(ParamLookupVolumeID, volID)
 
-	jsonBlob, _, err := c.client.get(encodeURI(*c.master, "/dir/lookup", args), nil)
+	jsonBlob, _, err := c.masterGet(ctx, OpLookup, "/dir/lookup", args)
 	if err == nil {
 		result = &LookupResult{}
 		if err = json.Unmarshal(jsonBlob, result); err == nil {
@@ -178,59 +274,130 @@ func (c *Seaweed) doLookup(volID string, args url.Values) (result *LookupResult,
 
 // LookupServerByFileID lookup server by file id.
 func (c *Seaweed) LookupServerByFileID(fileID string, args url.Values, readonly bool) (server string, err error) {
-	var parts []string
-	if strings.Contains(fileID, ",") {
-		parts = strings.Split(fileID, ",")
-	} else {
-		parts = strings.Split(fileID, "/")
-	}
+	return c.LookupServerByFileIDContext(context.Background(), fileID, args, readonly)
+}
 
-	if len(parts) != 2 { // wrong file id format
-		return "", errors.New("Invalid fileID " + fileID)
+// LookupServerByFileIDContext is like LookupServerByFileID, with context ctx.
+func (c *Seaweed) LookupServerByFileIDContext(ctx context.Context, fileID string, args url.Values, readonly bool) (server string, err error) {
+	locations, err := c.lookupLocations(ctx, fileID, args)
+	if err == nil {
+		if readonly {
+			server = c.selectForRead(fileID, locations).Head().PublicURL
+		} else {
+			server = c.selectForWrite(fileID, locations).Head().URL
+		}
 	}
+	return
+}
 
-	lookup, lookupError := c.Lookup(parts[0], args)
-	if lookupError != nil {
-		err = lookupError
-	} else if len(lookup.VolumeLocations) == 0 {
-		err = ErrFileNotFound
+// lookupLocations lookup all locations of volume which file belongs to.
+func (c *Seaweed) lookupLocations(ctx context.Context, fileID string, args url.Values) (locations VolumeLocations, err error) {
+	volID, err := parseVolumeID(fileID)
+	if err != nil {
+		return
 	}
 
+	lookup, err := c.LookupContext(ctx, volID, args)
 	if err == nil {
-		if readonly {
-			server = lookup.VolumeLocations.RandomPickForRead().PublicURL
+		if locations = lookup.VolumeLocations; len(locations) == 0 {
+			err = ErrFileNotFound
 		} else {
-			server = lookup.VolumeLocations.Head().URL
+			c.resolveLocality(locations)
 		}
 	}
 
 	return
 }
 
+// lookupFileForWrite looks up locations of volume which file belongs to by file id. If master signs writes, it issues token
+// of file along with locations, which authorizes replacing and deleting the file without write key.
+func (c *Seaweed) lookupFileForWrite(ctx context.Context, fileID string, args url.Values) (locations VolumeLocations, auth string, err error) {
+	if _, err = parseVolumeID(fileID); err != nil {
+		return
+	}
+
+	query := make(url.Values, len(args)+1)
+	for k, v := range args {
+		query[k] = v
+	}
+	query.Set(ParamLookupFileID, fileID)
+
+	jsonBlob, header, _, err := c.masterGetWithHeader(ctx, OpLookup, "/dir/lookup", query)
+	if err != nil {
+		return
+	}
+
+	result := &LookupResult{}
+	if err = json.Unmarshal(jsonBlob, result); err != nil {
+		return
+	}
+	if result.Error != "" {
+		return nil, "", errors.New(result.Error)
+	}
+	if locations = result.VolumeLocations; len(locations) == 0 {
+		return nil, "", ErrFileNotFound
+	}
+	c.resolveLocality(locations)
+
+	if fields := strings.Fields(header.Get("Authorization")); len(fields) == 2 && strings.EqualFold(fields[0], "bearer") {
+		auth = fields[1]
+	}
+	return
+}
+
 // LookupFileID lookup file by id.
 func (c *Seaweed) LookupFileID(fileID string, args url.Values, readonly bool) (fullURL string, err error) {
-	u, err := c.LookupServerByFileID(fileID, args, readonly)
+	return c.LookupFileIDContext(context.Background(), fileID, args, readonly)
+}
+
+// LookupFileIDContext is like LookupFileID, with context ctx.
+func (c *Seaweed) LookupFileIDContext(ctx context.Context, fileID string, args url.Values, readonly bool) (fullURL string, err error) {
+	u, err := c.LookupServerByFileIDContext(ctx, fileID, args, readonly)
 	if err == nil {
-		base := *c.master
-		base.Host = u
-		base.Path = fileID
-		fullURL = base.String()
+		fullURL = c.fileURL(u, fileID, nil)
 	}
 	return
 }
 
+// fileURL builds url of file located on volume server.
+func (c *Seaweed) fileURL(server, fileID string, args url.Values) string {
+	scheme, host := splitScheme(server)
+	if scheme == "" {
+		scheme = c.schemeOf(host)
+	}
+
+	base := url.URL{Scheme: scheme, Host: host}
+	return encodeURI(base, fileID, args)
+}
+
 // GC force Garbage Collection.
 func (c *Seaweed) GC(threshold float64) (err error) {
+	return c.GCContext(context.Background(), threshold)
+}
+
+// GCContext is like GC, with context ctx.
+func (c *Seaweed) GCContext(ctx context.Context, threshold float64) (err error) {
 	args := url.Values{
 		"garbageThreshold": []string{strconv.FormatFloat(threshold, 'f', -1, 64)},
 	}
-	_, _, err = c.client.get(encodeURI(*c.master, "/vol/vacuum", args), nil)
+	ctx, end := c.startCall(ctx, OpGC)
+	defer end(&err)
+
+	_, _, err = c.masterGet(ctx, OpGC, "/vol/vacuum", args)
 	return
 }
 
 // Status check System Status.
 func (c *Seaweed) Status() (result *SystemStatus, err error) {
-	data, _, err := c.client.get(encodeURI(*c.master, "/dir/status", nil), nil)
+	return c.StatusContext(context.Background())
+}
+
+// StatusContext is like Status, with context ctx.
+func (c *Seaweed) StatusContext(ctx context.Context) (result *SystemStatus, err error) {
+	ctx, end := c.startCall(ctx, OpStatus)
+	defer end(&err)
+
+	data, _, err := c.masterGet(ctx, OpStatus, "/dir/status", nil)
 	if err == nil {
 		result = &SystemStatus{}
 		err = json.Unmarshal(data, result)
@@ -240,7 +407,15 @@ func (c *Seaweed) Status() (result *SystemStatus, err error) {
 
 // ClusterStatus get cluster status.
 func (c *Seaweed) ClusterStatus() (result *ClusterStatus, err error) {
-	data, _, err := c.client.get(encodeURI(*c.master, "/cluster/status", nil), nil)
+	return c.ClusterStatusContext(context.Background())
+}
+
+// ClusterStatusContext is like ClusterStatus, with context ctx.
+func (c *Seaweed) ClusterStatusContext(ctx context.Context) (result *ClusterStatus, err error) {
+	ctx, end := c.startCall(ctx, OpClusterStatus)
+	defer end(&err)
+
+	data, _, err := c.masterGet(ctx, OpClusterStatus, "/cluster/status", nil)
 	if err == nil {
 		result = &ClusterStatus{}
 		err = json.Unmarshal(data, result)
@@ -250,7 +425,54 @@ func (c *Seaweed) ClusterStatus() (result *ClusterStatus, err error) {
 
 // Assign do assign api.
 func (c *Seaweed) Assign(args url.Values) (result *AssignResult, err error) {
-	jsonBlob, _, err := c.client.get(encodeURI(*c.master, "/dir/assign", args), nil)
+	return c.AssignContext(context.Background(), args)
+}
+
+// AssignContext is like Assign, with context ctx.
+func (c *Seaweed) AssignContext(ctx context.Context, args url.Values) (result *AssignResult, err error) {
+	ctx, end := c.startCall(ctx, OpAssign, attrCollection.String(args.Get(ParamCollection)))
+	defer end(&err)
+
+	if result, err = c.assign(ctx, args); err == nil {
+		setSpanAttributes(ctx, fileIDAttributes(result.FileID)...)
+	}
+	return
+}
+
+// AssignWithOptions do assign api with options. If client locality is set and options have no data center/rack/data node,
+// local rack and data center are tried first.
+func (c *Seaweed) AssignWithOptions(opts *AssignOptions) (result *AssignResult, err error) {
+	return c.AssignWithOptionsContext(context.Background(), opts)
+}
+
+// AssignWithOptionsContext is like AssignWithOptions, with context ctx.
+func (c *Seaweed) AssignWithOptionsContext(ctx context.Context, opts *AssignOptions) (result *AssignResult, err error) {
+	ctx, end := c.startCall(ctx, OpAssign)
+	defer end(&err)
+
+	if err = opts.Validate(); err != nil {
+		return
+	}
+
+	if opts != nil {
+		setSpanAttributes(ctx, attrCollection.String(opts.Collection))
+	}
+
+	for _, candidate := range c.localityCandidates(opts) {
+		if result, err = c.assign(ctx, candidate.Values()); !canFallbackAssign(err) {
+			break
+		}
+	}
+
+	if err == nil {
+		setSpanAttributes(ctx, fileIDAttributes(result.FileID)...)
+	}
+
+	return
+}
+
+func (c *Seaweed) assign(ctx context.Context, args url.Values) (result *AssignResult, err error) {
+	jsonBlob, _, err := c.masterGet(ctx, OpAssign, "/dir/assign", args)
 	if err == nil {
 		result = &AssignResult{}
 		if err = json.Unmarshal(jsonBlob, result); err != nil {
@@ -263,11 +485,42 @@ func (c *Seaweed) Assign(args url.Values) (result *AssignResult, err error) {
 	return
 }
 
+// assignFileID assigns single file id, taking from file id pool if used.
+func (c *Seaweed) assignFileID(ctx context.Context, opts *AssignOptions) (*AssignResult, error) {
+	if c.fidPool != nil {
+		return c.fidPool.Get(opts)
+	}
+	return c.AssignWithOptionsContext(ctx, opts)
+}
+
 // Submit file directly to master.
 func (c *Seaweed) Submit(filePath string, collection, ttl string) (result *SubmitResult, err error) {
+	return c.SubmitContext(context.Background(), filePath, collection, ttl)
+}
+
+// SubmitContext is like Submit, with context ctx.
+func (c *Seaweed) SubmitContext(ctx context.Context, filePath string, collection, ttl string) (result *SubmitResult, err error) {
+	opts, err := newAssignOptions(collection, "", ttl)
+	if err == nil {
+		result, err = c.SubmitWithOptionsContext(ctx, filePath, opts)
+	}
+	return
+}
+
+// SubmitWithOptions submits file directly to master with assign options.
+func (c *Seaweed) SubmitWithOptions(filePath string, opts *AssignOptions) (result *SubmitResult, err error) {
+	return c.SubmitWithOptionsContext(context.Background(), filePath, opts)
+}
+
+// SubmitWithOptionsContext is like SubmitWithOptions, with context ctx.
+func (c *Seaweed) SubmitWithOptionsContext(ctx context.Context, filePath string, opts *AssignOptions) (result *SubmitResult, err error) {
+	if err = opts.Validate(); err != nil {
+		return
+	}
+
 	fp, err := NewFilePart(filePath)
 	if err == nil {
-		result, err = c.SubmitFilePart(fp, normalize(nil, collection, ttl))
+		result, err = c.SubmitFilePartContext(ctx, fp, opts.Values())
 		_ = fp.Close()
 	}
 	return
@@ -275,7 +528,15 @@ func (c *Seaweed) Submit(filePath string, collection, ttl string) (result *Submi
 
 // SubmitFilePart directly to master.
 func (c *Seaweed) SubmitFilePart(f *FilePart, args url.Values) (result *SubmitResult, err error) {
-	data, _, err := c.client.upload(encodeURI(*c.master, "/submit", args), f.FileName, f.Reader, f.MimeType)
+	return c.SubmitFilePartContext(context.Background(), f, args)
+}
+
+// SubmitFilePartContext is like SubmitFilePart, with context ctx.
+func (c *Seaweed) SubmitFilePartContext(ctx context.Context, f *FilePart, args url.Values) (result *SubmitResult, err error) {
+	ctx, end := c.startCall(ctx, OpSubmit, attrCollection.String(args.Get(ParamCollection)))
+	defer end(&err)
+
+	data, _, err := c.client.upload(ctx, OpSubmit, encodeURI(*c.currentMaster(), "/submit", args), f.FileName, f.Reader, f.MimeType, nil)
 	if err == nil {
 		result = &SubmitResult{}
 		err = json.Unmarshal(data, result)
@@ -285,18 +546,49 @@ func (c *Seaweed) SubmitFilePart(f *FilePart, args url.Values) (result *SubmitRe
 
 // Upload file by reader.
 func (c *Seaweed) Upload(fileReader io.Reader, fileName string, size int64, collection, ttl string) (fp *FilePart, err error) {
+	return c.UploadContext(context.Background(), fileReader, fileName, size, collection, ttl)
+}
+
+// UploadContext is like Upload, with context ctx.
+func (c *Seaweed) UploadContext(ctx context.Context, fileReader io.Reader, fileName string, size int64, collection, ttl string) (fp *FilePart, err error) {
+	opts, err := newAssignOptions(collection, "", ttl)
+	if err == nil {
+		fp, err = c.UploadWithOptionsContext(ctx, fileReader, fileName, size, opts)
+	}
+	return
+}
+
+// UploadWithOptions uploads file by reader with assign options.
+func (c *Seaweed) UploadWithOptions(fileReader io.Reader, fileName string, size int64, opts *AssignOptions) (fp *FilePart, err error) {
+	return c.UploadWithOptionsContext(context.Background(), fileReader, fileName, size, opts)
+}
+
+// UploadWithOptionsContext is like UploadWithOptions, with context ctx.
+func (c *Seaweed) UploadWithOptionsContext(ctx context.Context, fileReader io.Reader, fileName string, size int64, opts *AssignOptions) (fp *FilePart, err error) {
 	fp = NewFilePartFromReader(ioutil.NopCloser(fileReader), fileName, size)
-	fp.Collection, fp.TTL = collection, ttl
-	_, err = c.UploadFilePart(fp)
+	if opts != nil {
+		fp.Collection, fp.AssignOptions = opts.Collection, opts
+	}
+	_, err = c.UploadFilePartContext(ctx, fp)
 	return
 }
 
 // UploadFile with full file dir/path.
 func (c *Seaweed) UploadFile(filePath string, collection, ttl string) (cm *ChunkManifest, fp *FilePart, err error) {
+	return c.UploadFileContext(context.Background(), filePath, collection, ttl)
+}
+
+// UploadFileContext is like UploadFile, with context ctx.
+func (c *Seaweed) UploadFileContext(ctx context.Context, filePath string, collection, ttl string) (cm *ChunkManifest, fp *FilePart, err error) {
+	opts, err := newAssignOptions(collection, "", ttl)
+	if err != nil {
+		return
+	}
+
 	fp, err = NewFilePart(filePath)
 	if err == nil {
-		fp.Collection, fp.TTL = collection, ttl
-		cm, err = c.UploadFilePart(fp)
+		fp.Collection, fp.AssignOptions = collection, opts
+		cm, err = c.UploadFilePartContext(ctx, fp)
 		_ = fp.Close()
 	}
 	return
@@ -304,25 +596,44 @@ func (c *Seaweed) UploadFile(filePath string, collection, ttl string) (cm *Chunk
 
 // UploadFilePart uploads a file part.
 func (c *Seaweed) UploadFilePart(f *FilePart) (cm *ChunkManifest, err error) {
+	return c.UploadFilePartContext(context.Background(), f)
+}
+
+// UploadFilePartContext is like UploadFilePart, with context ctx.
+func (c *Seaweed) UploadFilePartContext(ctx context.Context, f *FilePart) (cm *ChunkManifest, err error) {
+	ctx, end := c.startCall(ctx, OpUpload, attrCollection.String(f.Collection), attrBytes.Int64(f.FileSize))
+	defer end(&err)
+
+	progress := newProgressTracker(f.Progress, f.FileName, f.FileID, f.FileSize)
+	defer func() { progress.done(err) }()
+
 	if f.FileID == "" {
 		var res *AssignResult
-		res, err = c.Assign(normalize(nil, f.Collection, f.TTL))
+		res, err = c.assignFileID(ctx, f.assignOptions())
 		if err != nil {
 			return
 		}
-		f.Server, f.FileID = res.URL, res.FileID
+		f.Server, f.FileID, f.Auth = res.URL, res.FileID, res.Auth
 	}
+	setSpanAttributes(ctx, fileIDAttributes(f.FileID)...)
+	progress.setFile("", f.FileID, 0)
 
 	if f.Server == "" {
-		if f.Server, err = c.LookupServerByFileID(f.FileID, normalize(nil, f.Collection, ""), false); err != nil {
+		var locations VolumeLocations
+		var auth string
+		if locations, auth, err = c.lookupFileForWrite(ctx, f.FileID, normalize(nil, f.Collection, "")); err != nil {
 			return
 		}
+		if f.Server = c.selectForWrite(f.FileID, locations).Head().URL; f.Auth == "" {
+			f.Auth = auth
+		}
 	}
 
 	baseName := path.Base(f.FileName)
 
-	if c.chunkSize > 0 && f.FileSize > c.chunkSize {
-		chunks := f.FileSize/c.chunkSize + 1
+	chunkSize := c.uploadChunkSize()
+	if chunkSize > 0 && f.FileSize > chunkSize {
+		chunks := f.FileSize/chunkSize + 1
 
 		cm = &ChunkManifest{
 			Name:   baseName,
@@ -331,33 +642,125 @@ func (c *Seaweed) UploadFilePart(f *FilePart) (cm *ChunkManifest, err error) {
 			Chunks: make([]*ChunkInfo, chunks),
 		}
 
+		var whole *checksummer
+		reader := io.Reader(f.Reader)
+		if c.checksums {
+			whole = newChecksummer()
+			reader = io.TeeReader(f.Reader, whole)
+		}
+
+		var key *contentKey
+		if c.keys != nil {
+			if cm.Encryption, key, err = newEnvelope(ctx, c.keys, f.FileID); err != nil {
+				return nil, err
+			}
+		}
+
+		var cipherKey []byte // seals keys of chunks in manifest
+		if c.cipher {
+			if cipherKey, err = newCipherKey(); err != nil {
+				return nil, err
+			}
+		}
+
+		uploaded := make([]*AssignResult, 0, chunks)
 		for i := int64(0); i < chunks; i++ {
-			_, id, count, e := c.uploadChunk(f, baseName+"_"+strconv.FormatInt(i+1, 10))
+			chunk, assigned, e := c.uploadChunk(ctx, f, progress.reader(reader, int(i)), baseName+"_"+strconv.FormatInt(i+1, 10), key, i*chunkSize)
 			if e != nil { // delete all uploaded chunks
-				_ = c.DeleteChunks(cm, normalize(nil, f.Collection, ""))
+				c.client.warn("seaweedfs: rollback of uploaded chunks failed", c.rollbackChunks(ctx, uploaded), "fid", f.FileID)
 				return nil, e
 			}
 
-			cm.Chunks[i] = &ChunkInfo{
-				Offset: i * c.chunkSize,
-				Size:   int64(count),
-				Fid:    id,
-			}
+			chunk.Offset = i * chunkSize
+			cm.Chunks[i] = chunk
+			uploaded = append(uploaded, assigned)
+		}
+
+		if whole != nil {
+			cm.Checksums = whole.Sum()
+			f.Checksums = cm.Checksums
 		}
 
-		if err = c.uploadManifest(f, cm); err != nil { // delete all uploaded chunks
-			_ = c.DeleteChunks(cm, normalize(nil, f.Collection, ""))
+		if err = c.uploadManifest(ctx, f, cm, cipherKey); err != nil { // delete all uploaded chunks
+			c.client.warn("seaweedfs: rollback of uploaded chunks failed", c.rollbackChunks(ctx, uploaded), "fid", f.FileID)
+		} else {
+			f.CipherKey = cipherKey
 		}
 	} else {
-		args := normalize(nil, f.Collection, f.TTL)
+		args := normalize(nil, f.Collection, f.ttl())
 		if f.ModTime != 0 {
 			args.Set("ts", strconv.FormatInt(f.ModTime, 10))
 		}
 
-		base := *c.master
-		base.Host = f.Server
+		header := c.writeAuth(f.FileID, f.Auth)
+		reader := progress.reader(f.Reader, -1)
+
+		if c.keys != nil {
+			var env *Envelope
+			var key *contentKey
+			if env, key, err = newEnvelope(ctx, c.keys, f.FileID); err != nil {
+				return
+			}
+			if reader, err = newEncryptingReader(reader, key, 0); err != nil {
+				return
+			}
+			header = env.header(header)
+		}
+
+		var sealed, cipherKey []byte
+		if c.cipher { // cipher mode encrypts content as a whole, file is not larger than a chunk
+			limit := chunkSize
+			if c.keys != nil {
+				limit = encryptedSize(chunkSize)
+			}
+
+			var data []byte
+			if data, err = ioutil.ReadAll(io.LimitReader(reader, limit+1)); err != nil {
+				return
+			}
+			if int64(len(data)) > limit {
+				return nil, fmt.Errorf("Content of %s is larger than its size %d", f.FileName, f.FileSize)
+			}
+			if sealed, cipherKey, err = cipherEncrypt(data); err != nil {
+				return
+			}
+			reader = bytes.NewReader(sealed)
+			header = cipherHeader(header)
+		}
+
+		var sums Checksums
+		var h *checksummer
+		if c.checksums {
+			if sealed != nil {
+				sums = checksumsOf(sealed)
+				header = withContentMD5(header, sums)
+			} else if seeker, ok := f.Reader.(io.ReadSeeker); ok && c.keys == nil { // content is known beforehand, volume server verifies Content-MD5
+				if sums, err = checksumsOfSeeker(seeker, f.FileSize); err != nil {
+					return
+				}
+				header = withContentMD5(header, sums)
+			} else {
+				h = newChecksummer()
+				reader = io.TeeReader(reader, h)
+			}
+		}
+
+		if c.keys == nil && cipherKey == nil { // encrypted content is not compressible
+			if reader, header, err = c.compression.compress(reader, f.MimeType, f.FileName, f.FileSize, header); err != nil {
+				return
+			}
+		}
 
-		_, _, err = c.client.upload(encodeURI(base, f.FileID, args), baseName, f.Reader, f.MimeType)
+		fileURL := c.fileURL(f.Server, f.FileID, args)
+		v, status, e := c.client.upload(ctx, OpUpload, fileURL, baseName, reader, f.MimeType, header)
+		if err = e; err == nil {
+			if h != nil {
+				sums = h.Sum()
+			}
+			if _, err = verifyUpload(f.FileID, fileURL, v, status, serverChecksums(header, sums)); err == nil {
+				f.Checksums, f.CipherKey = sums, cipherKey
+			}
+		}
 	}
 
 	return
@@ -365,24 +768,44 @@ func (c *Seaweed) UploadFilePart(f *FilePart) (cm *ChunkManifest, err error) {
 
 // BatchUploadFiles batch uploads files.
 func (c *Seaweed) BatchUploadFiles(files []string, collection, ttl string) (results []*SubmitResult, err error) {
+	return c.BatchUploadFilesContext(context.Background(), files, collection, ttl)
+}
+
+// BatchUploadFilesContext is like BatchUploadFiles, with context ctx.
+func (c *Seaweed) BatchUploadFilesContext(ctx context.Context, files []string, collection, ttl string) (results []*SubmitResult, err error) {
 	fps, err := NewFileParts(files)
 	if err == nil {
-		results, err = c.BatchUploadFileParts(fps, collection, ttl)
+		results, err = c.BatchUploadFilePartsContext(ctx, fps, collection, ttl)
 		closeFileParts(fps)
 	}
 	return
 }
 
-// BatchUploadFileParts uploads multiple file parts at once.
-func (c *Seaweed) BatchUploadFileParts(files []*FilePart, collection string, ttl string) ([]*SubmitResult, error) {
-	results := make([]*SubmitResult, len(files))
+// BatchUploadFileParts uploads multiple file parts at once, with file ids reserved by a single assign request
+// if possible. Failures of files are reported in their results. File id, server, checksums and cipher key of
+// uploaded files are set on their file parts. See BatchUploader for more options.
+func (c *Seaweed) BatchUploadFileParts(files []*FilePart, collection string, ttl string) (results []*SubmitResult, err error) {
+	return c.BatchUploadFilePartsContext(context.Background(), files, collection, ttl)
+}
+
+// BatchUploadFilePartsContext is like BatchUploadFileParts, with context ctx.
+func (c *Seaweed) BatchUploadFilePartsContext(ctx context.Context, files []*FilePart, collection string, ttl string) (results []*SubmitResult, err error) {
+	ctx, end := c.startCall(ctx, OpBatchUpload, attrCollection.String(collection))
+	defer end(&err)
+
+	results = make([]*SubmitResult, len(files))
 	for index, file := range files {
 		results[index] = &SubmitResult{
 			FileName: file.FileName,
 		}
 	}
 
-	assigned, err := c.Assign(normalize(nil, collection, ttl))
+	n := len(files)
+	if n == 0 {
+		return results, nil
+	}
+
+	opts, err := newAssignOptions(collection, "", ttl)
 	if err != nil {
 		for i := range files {
 			results[i].Error = err.Error()
@@ -390,60 +813,58 @@ func (c *Seaweed) BatchUploadFileParts(files []*FilePart, collection string, ttl
 		return results, err
 	}
 
-	n := len(files)
-	result := make(chan taskResult, 1)
-
-	for i, file := range files {
-		file.FileID = assigned.FileID
-		if i > 0 {
-			file.FileID = file.FileID + "_" + strconv.Itoa(i)
-		}
-		file.Server = assigned.URL
+	for _, file := range files {
 		file.Collection = collection
-		file.TTL = ttl
-
-		results[i].Size = file.FileSize
-		results[i].FileID = file.FileID
-		results[i].FileURL = assigned.PublicURL + "/" + file.FileID
-
-		go c.uploadTask(file, i, result)
 	}
 
-	for i := 0; i < n; i++ {
-		r := <-result
-		if r.err != nil {
-			results[r.meta.(int)].Error = r.err.Error()
+	u := c.NewBatchUploader(BatchUploaderOptions{Retries: -1, AssignCount: n, AssignOptions: opts})
+	defer u.Close()
+
+	for i, r := range u.Upload(ctx, files) {
+		results[i].Size = r.Size
+		results[i].FileID = r.FileID
+		results[i].FileURL = r.FileURL
+		if r.Err != nil {
+			results[i].Error = r.Err.Error()
+		} else {
+			files[i].FileID, files[i].Server = r.FileID, r.Server
+			files[i].Checksums, files[i].CipherKey = r.Checksums, r.CipherKey
 		}
 	}
 
 	return results, nil
 }
 
-func (c *Seaweed) uploadTask(file *FilePart, meta interface{}, result chan taskResult) {
-	_, err := c.UploadFilePart(file)
-	result <- taskResult{err: err, meta: meta}
+// Replace file content with new one.
+func (c *Seaweed) Replace(fileID string, newContent io.Reader, fileName string, size int64, collection, ttl string, deleteFirst bool) (err error) {
+	return c.ReplaceContext(context.Background(), fileID, newContent, fileName, size, collection, ttl, deleteFirst)
 }
 
-type taskResult struct {
-	err  error
-	meta interface{}
-}
+// ReplaceContext is like Replace, with context ctx.
+func (c *Seaweed) ReplaceContext(ctx context.Context, fileID string, newContent io.Reader, fileName string, size int64, collection, ttl string, deleteFirst bool) (err error) {
+	opts, err := newAssignOptions(collection, "", ttl)
+	if err != nil {
+		return
+	}
 
-// Replace file content with new one.
-func (c *Seaweed) Replace(fileID string, newContent io.Reader, fileName string, size int64, collection, ttl string, deleteFirst bool) (err error) {
 	fp := NewFilePartFromReader(ioutil.NopCloser(newContent), fileName, size)
-	fp.Collection, fp.TTL = collection, ttl
+	fp.Collection, fp.AssignOptions = collection, opts
 	fp.FileID = fileID
-	err = c.ReplaceFilePart(fp, deleteFirst)
+	err = c.ReplaceFilePartContext(ctx, fp, deleteFirst)
 	return
 }
 
 // ReplaceFile replaces file with local file.
 func (c *Seaweed) ReplaceFile(fileID, localFilePath string, deleteFirst bool) (err error) {
+	return c.ReplaceFileContext(context.Background(), fileID, localFilePath, deleteFirst)
+}
+
+// ReplaceFileContext is like ReplaceFile, with context ctx.
+func (c *Seaweed) ReplaceFileContext(ctx context.Context, fileID, localFilePath string, deleteFirst bool) (err error) {
 	fp, err := NewFilePart(localFilePath)
 	if err == nil {
 		fp.FileID = fileID
-		err = c.ReplaceFilePart(fp, deleteFirst)
+		err = c.ReplaceFilePartContext(ctx, fp, deleteFirst)
 		_ = fp.Close()
 	}
 	return
@@ -451,34 +872,79 @@ func (c *Seaweed) ReplaceFile(fileID, localFilePath string, deleteFirst bool) (e
 
 // ReplaceFilePart replaces file part.
 func (c *Seaweed) ReplaceFilePart(f *FilePart, deleteFirst bool) (err error) {
+	return c.ReplaceFilePartContext(context.Background(), f, deleteFirst)
+}
+
+// ReplaceFilePartContext is like ReplaceFilePart, with context ctx.
+func (c *Seaweed) ReplaceFilePartContext(ctx context.Context, f *FilePart, deleteFirst bool) (err error) {
+	ctx, end := c.startCall(ctx, OpReplace, fileIDAttributes(f.FileID)...)
+	defer end(&err)
+
 	if deleteFirst && f.FileID != "" {
-		_ = c.DeleteFile(f.FileID, nil)
+		c.client.warn("seaweedfs: delete before replace failed", c.DeleteFileContext(ctx, f.FileID, nil), "fid", f.FileID)
 	}
 
-	_, err = c.UploadFilePart(f)
+	_, err = c.UploadFilePartContext(ctx, f)
+	c.cache.Invalidate(f.FileID)
+	c.memCache.Invalidate(f.FileID)
 	return
 }
 
-func (c *Seaweed) uploadChunk(f *FilePart, filename string) (assignResult *AssignResult, fileID string, size int64, err error) {
+// uploadChunk uploads next chunk at offset read from r, encrypted by key if not nil, otherwise compressed according to
+// compression policy. In cipher mode, chunk is encrypted with its own key. If client computes checksums or
+// uses cipher mode, chunk is buffered, so that its Content-MD5 is sent. Offset of returned chunk is not set,
+// size is of plain text. Assign result of chunk is returned for rolling back upload.
+func (c *Seaweed) uploadChunk(ctx context.Context, f *FilePart, r io.Reader, filename string, key *contentKey, offset int64) (chunk *ChunkInfo, assignResult *AssignResult, err error) {
 	// Assign first to get file id and url for uploading
-	assignResult, err = c.Assign(normalize(nil, f.Collection, f.TTL))
-	if err == nil {
-		fileID = assignResult.FileID
+	if assignResult, err = c.assignFileID(ctx, f.assignOptions()); err != nil {
+		return
+	}
+	chunk = &ChunkInfo{Fid: assignResult.FileID}
 
-		base := *c.master
-		base.Host = assignResult.URL
+	header := c.writeAuth(assignResult.FileID, assignResult.Auth)
 
-		// do upload
-		var v []byte
-		v, _, err = c.client.upload(
-			encodeURI(base, assignResult.FileID, nil),
-			filename, io.LimitReader(f.Reader, c.chunkSize),
-			"application/octet-stream")
-		if err == nil {
-			// parsing response data
-			uploadResult := UploadResult{}
-			if err = json.Unmarshal(v, &uploadResult); err == nil {
-				size = uploadResult.Size
+	chunkSize := c.uploadChunkSize()
+	plain := &countingReader{r: io.LimitReader(r, chunkSize)}
+	if r = plain; key != nil {
+		if r, err = newEncryptingReader(plain, key, offset); err != nil {
+			return
+		}
+	}
+
+	if c.checksums || c.cipher {
+		var data []byte
+		if data, err = ioutil.ReadAll(r); err != nil {
+			return
+		}
+		if c.cipher {
+			if data, chunk.CipherKey, err = cipherEncrypt(data); err != nil {
+				return
+			}
+		}
+		if c.checksums {
+			chunk.Checksums = checksumsOf(data)
+			header = withContentMD5(header, chunk.Checksums)
+		}
+		r = bytes.NewReader(data)
+	}
+
+	if key == nil && chunk.CipherKey == nil { // encrypted content is not compressible
+		if r, header, err = c.compression.compress(r, f.MimeType, f.FileName, chunkSize, header); err != nil {
+			return
+		}
+		chunk.encoding = contentEncoding(header)
+	}
+
+	// do upload
+	fileURL := c.fileURL(assignResult.URL, assignResult.FileID, nil)
+
+	v, status, err := c.client.upload(ctx, OpChunkUpload, fileURL, filename, r, "application/octet-stream", header)
+	if err == nil {
+		// parsing response data
+		var uploadResult *UploadResult
+		if uploadResult, err = verifyUpload(chunk.Fid, fileURL, v, status, serverChecksums(header, chunk.Checksums)); err == nil {
+			if chunk.Size = uploadResult.Size; key != nil || chunk.CipherKey != nil || chunk.encoding != "" {
+				chunk.Size = plain.count()
 			}
 		}
 	}
@@ -486,66 +952,160 @@ func (c *Seaweed) uploadChunk(f *FilePart, filename string) (assignResult *Assig
 	return
 }
 
-func (c *Seaweed) uploadManifest(f *FilePart, manifest *ChunkManifest) (err error) {
+// rollbackChunks deletes uploaded chunks on volume servers they were uploaded to, authorized by tokens issued on assign.
+func (c *Seaweed) rollbackChunks(ctx context.Context, uploaded []*AssignResult) (err error) {
+	for _, a := range uploaded {
+		if _, e := c.client.delete(ctx, OpDeleteChunks, c.fileURL(a.URL, a.FileID, nil), c.writeAuth(a.FileID, a.Auth)); e != nil && err == nil {
+			err = e
+		}
+	}
+	return
+}
+
+// uploadManifest uploads manifest of chunked file, keys of chunks encrypted in cipher mode are sealed by cipherKey.
+func (c *Seaweed) uploadManifest(ctx context.Context, f *FilePart, manifest *ChunkManifest, cipherKey []byte) (err error) {
+	if cipherKey != nil {
+		if manifest, err = manifest.sealKeys(cipherKey); err != nil {
+			return
+		}
+	}
+
 	buf, err := manifest.Marshal()
 	if err == nil {
 		bufReader := bytes.NewReader(buf)
 
-		args := normalize(nil, f.Collection, f.TTL)
+		args := normalize(nil, f.Collection, f.ttl())
 		if f.ModTime != 0 {
 			args.Set("ts", strconv.FormatInt(f.ModTime, 10))
 		}
 		args.Set("cm", "true")
 
-		base := *c.master
-		base.Host = f.Server
+		fileURL := c.fileURL(f.Server, f.FileID, args)
+
+		var sums Checksums
+		header := c.writeAuth(f.FileID, f.Auth)
+		if cipherKey != nil {
+			header = cipherHeader(header)
+		}
+		if c.checksums {
+			sums = checksumsOf(buf)
+			header = withContentMD5(header, sums)
+		}
+
+		// volume server reads manifests compressed with gzip only, content of chunks compressed with other
+		// encoding is responded as is, so that it is decoded by client
+		var reader io.Reader = bufReader
+		if p := c.compression; p != nil && p.Algorithm == CompressionGzip {
+			if reader, header, err = p.compress(bufReader, "application/json", manifest.Name, int64(len(buf)), header); err != nil {
+				return
+			}
+		} else if encoding := manifest.chunksEncoding(); encoding != "" {
+			h := make(map[string]string, len(header)+1)
+			for k, v := range header {
+				h[k] = v
+			}
+			h[headerContentEncoding] = encoding
+			header = h
+		}
 
-		_, _, err = c.client.upload(encodeURI(base, f.FileID, args), manifest.Name, bufReader, "application/json")
+		var v []byte
+		var status int
+		if v, status, err = c.client.upload(ctx, OpManifestUpload, fileURL, manifest.Name, reader, "application/json", header); err == nil {
+			_, err = verifyUpload(f.FileID, fileURL, v, status, sums)
+		}
 	}
 	return
 }
 
-// Download file by id.
+// parseUploadResult parses response of uploading to volume server. Error status fails with error reported by server if any.
+func parseUploadResult(fileURL string, body []byte, statusCode int) (*UploadResult, error) {
+	result := &UploadResult{}
+	err := json.Unmarshal(body, result)
+
+	if statusCode >= http.StatusBadRequest {
+		if err == nil && result.Error != "" {
+			return nil, fmt.Errorf("Upload %s but error: %s. Code:%d", fileURL, result.Error, statusCode)
+		}
+		return nil, &statusError{method: "Upload", url: fileURL, status: http.StatusText(statusCode), code: statusCode}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Upload %s. Got response but can not parse. Body:%s Code:%d", fileURL, string(body), statusCode)
+	}
+	return result, nil
+}
+
+// writeAuth builds Authorization header for writing file id, using token issued by master if any,
+// otherwise signing one with write key.
+func (c *Seaweed) writeAuth(fileID, issued string) map[string]string {
+	if issued == "" {
+		issued = c.jwt.writeToken(fileID)
+	}
+	return authHeader(issued)
+}
+
+// Download file by id. Read fails over to other replicas according to read policy.
 func (c *Seaweed) Download(fileID string, args url.Values, callback func(io.Reader) error) (fileName string, err error) {
-	fileURL, err := c.LookupFileID(fileID, args, true)
-	if err == nil {
-		fileName, err = c.client.download(fileURL, callback)
+	return c.DownloadContext(context.Background(), fileID, args, callback)
+}
+
+// DownloadContext is like Download, with context ctx.
+func (c *Seaweed) DownloadContext(ctx context.Context, fileID string, args url.Values, callback func(io.Reader) error) (fileName string, err error) {
+	if c.memCache != nil {
+		return c.downloadCached(ctx, fileID, args, callback)
+	}
+	return c.download(ctx, fileID, args, callback)
+}
+
+func (c *Seaweed) download(ctx context.Context, fileID string, args url.Values, callback func(io.Reader) error) (fileName string, err error) {
+	resp, err := c.readFile(ctx, fileID, args, nil, func(_ *DownloadResponse, r io.Reader) error {
+		return callback(r)
+	})
+	if resp != nil {
+		fileName = resp.FileName
 	}
 	return
 }
 
-// DeleteChunks concurrently delete chunks.
+// DownloadWithOptions downloads file by id with range/conditional options. Callback is not called if content is not modified.
+func (c *Seaweed) DownloadWithOptions(fileID string, args url.Values, opts *DownloadOptions, callback func(*DownloadResponse, io.Reader) error) (resp *DownloadResponse, err error) {
+	return c.DownloadWithOptionsContext(context.Background(), fileID, args, opts, callback)
+}
+
+// DownloadWithOptionsContext is like DownloadWithOptions, with context ctx.
+func (c *Seaweed) DownloadWithOptionsContext(ctx context.Context, fileID string, args url.Values, opts *DownloadOptions, callback func(*DownloadResponse, io.Reader) error) (resp *DownloadResponse, err error) {
+	return c.readFile(ctx, fileID, args, opts, callback)
+}
+
+// DeleteChunks deletes chunks of manifest, by a batch delete request per volume. Chunks not found are considered deleted.
 func (c *Seaweed) DeleteChunks(cm *ChunkManifest, args url.Values) (err error) {
+	return c.DeleteChunksContext(context.Background(), cm, args)
+}
+
+// DeleteChunksContext is like DeleteChunks, with context ctx.
+func (c *Seaweed) DeleteChunksContext(ctx context.Context, cm *ChunkManifest, args url.Values) (err error) {
 	if cm == nil || len(cm.Chunks) == 0 {
 		return nil
 	}
 
-	n := len(cm.Chunks)
-	result := make(chan error, n)
-
-	for _, ci := range cm.Chunks {
-		go c.deleteFileTask(ci.Fid, args, result)
-	}
+	ctx, end := c.startCall(ctx, OpDeleteChunks)
+	defer end(&err)
 
-	for i := 0; i < n; i++ {
-		if e := <-result; e != nil {
-			err = e
-			return
-		}
+	fids := make([]string, len(cm.Chunks))
+	for i, ci := range cm.Chunks {
+		fids[i] = ci.Fid
 	}
 
+	err = c.DeleteFilesContext(ctx, fids, args).Err()
 	return
 }
 
-func (c *Seaweed) deleteFileTask(fileID string, args url.Values, result chan error) {
-	result <- c.DeleteFile(fileID, args)
-}
-
 // DeleteFile by id.
 func (c *Seaweed) DeleteFile(fileID string, args url.Values) (err error) {
-	fileURL, err := c.LookupFileID(fileID, args, false)
-	if err == nil {
-		_, err = c.client.delete(fileURL)
-	}
-	return
+	return c.DeleteFileContext(context.Background(), fileID, args)
+}
+
+// DeleteFileContext is like DeleteFile, with context ctx.
+func (c *Seaweed) DeleteFileContext(ctx context.Context, fileID string, args url.Values) (err error) {
+	return c.DeleteFileWithOptionsContext(ctx, fileID, args, nil)
 }
@@ -16,7 +16,6 @@ import (
 	"io/ioutil"
 	"net/http"
 	"os"
-	"sort"
 	"testing"
 	"time"
 
@@ -254,31 +253,3 @@ func TestUnzipAndLoading(t *testing.T) {
 	require.Equal(t, cm1.Chunks[0].Offset, cm2.Chunks[0].Offset)
 	require.Equal(t, cm1.Chunks[0].Size, cm2.Chunks[0].Size)
 }
-
-func unzipData(input []byte) ([]byte, error) {
-	buf := bytes.NewBuffer(input)
-	r, _ := gzip.NewReader(buf)
-	defer r.Close()
-	output, err := ioutil.ReadAll(r)
-	return output, err
-}
-
-func loadChunkManifest(buffer []byte, isGzipped bool) (*ChunkManifest, error) {
-	if isGzipped {
-		var err error
-		if buffer, err = unzipData(buffer); err != nil {
-			return nil, err
-		}
-	}
-
-	cm := ChunkManifest{}
-	if e := json.Unmarshal(buffer, &cm); e != nil {
-		return nil, e
-	}
-
-	sort.Slice(cm.Chunks, func(i, j int) bool {
-		return cm.Chunks[i].Offset < cm.Chunks[j].Offset
-	})
-
-	return &cm, nil
-}
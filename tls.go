@@ -0,0 +1,100 @@
+package goseaweedfs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TLSConfig TLS settings for connecting to SeaweedFS cluster. According to https://github.com/chrislusf/seaweedfs/wiki/Security-Configuration
+type TLSConfig struct {
+	// CAFile PEM encoded CA bundle to verify servers. System roots are used if empty.
+	CAFile string `yaml:"ca_file" toml:"ca_file"`
+
+	// CertFile and KeyFile PEM encoded client certificate and key for mutual TLS.
+	CertFile string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile  string `yaml:"key_file" toml:"key_file"`
+
+	// ServerName overrides server name used to verify servers' certificates.
+	ServerName string `yaml:"server_name" toml:"server_name"`
+
+	// InsecureSkipVerify skips verifying servers' certificates. Testing only.
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify" toml:"insecure_skip_verify"`
+}
+
+// Build creates tls config.
+func (c *TLSConfig) Build() (cfg *tls.Config, err error) {
+	cfg = &tls.Config{
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify, //nolint:gosec
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	if c.CAFile != "" {
+		var pem []byte
+		if pem, err = ioutil.ReadFile(c.CAFile); err != nil {
+			return nil, err
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificate found in CA file " + c.CAFile)
+		}
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+			return nil, err
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return
+}
+
+// NewHTTPClient creates http client with TLS config and timeout. Nil TLS config means default TLS settings.
+func NewHTTPClient(tlsConfig *TLSConfig, timeout time.Duration) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if tlsConfig != nil {
+		cfg, err := tlsConfig.Build()
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = cfg
+	}
+
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
+
+// SetVolumeSchemes sets schemes (http/https) of volume servers, which are responded by master as host:port only.
+// Default scheme is used for hosts not listed in perHost. Empty default means master's scheme.
+// Must be called before using client.
+func (c *Seaweed) SetVolumeSchemes(defaultScheme string, perHost map[string]string) {
+	c.volumeScheme = defaultScheme
+	c.volumeSchemes = perHost
+}
+
+// schemeOf returns scheme for volume server.
+func (c *Seaweed) schemeOf(server string) string {
+	if scheme, ok := c.volumeSchemes[server]; ok {
+		return scheme
+	}
+	if c.volumeScheme != "" {
+		return c.volumeScheme
+	}
+	return c.currentMaster().Scheme
+}
+
+// splitScheme splits scheme from server url if any, e.g: "https://host:port".
+func splitScheme(server string) (scheme, host string) {
+	if i := strings.Index(server, "://"); i >= 0 {
+		return server[:i], server[i+3:]
+	}
+	return "", server
+}
@@ -0,0 +1,66 @@
+package goseaweedfs
+
+import (
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSHTTPClient(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secured"))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "goswfs")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.Nil(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600))
+
+	client, err := NewHTTPClient(&TLSConfig{CAFile: caFile}, 0)
+	require.Nil(t, err)
+
+	filer, err := NewFiler(srv.URL, client)
+	require.Nil(t, err)
+
+	var data []byte
+	err = filer.Download("/a.txt", nil, func(r io.Reader) (err error) {
+		data, err = ioutil.ReadAll(r)
+		return
+	})
+	require.Nil(t, err)
+	require.Equal(t, "secured", string(data))
+
+	// unknown CA
+	client, err = NewHTTPClient(nil, 0)
+	require.Nil(t, err)
+	filer, err = NewFiler(srv.URL, client)
+	require.Nil(t, err)
+	require.NotNil(t, filer.Download("/a.txt", nil, func(io.Reader) error { return nil }))
+
+	_, err = NewHTTPClient(&TLSConfig{CAFile: filepath.Join(dir, "missing.pem")}, 0)
+	require.NotNil(t, err)
+}
+
+func TestVolumeSchemes(t *testing.T) {
+	c, err := NewSeaweed("https://master:9333", []string{"filer:8888"}, 0, http.DefaultClient)
+	require.Nil(t, err)
+	require.Equal(t, "https", c.Filers()[0].base.Scheme)
+	require.Equal(t, "filer:8888", c.Filers()[0].base.Host)
+
+	require.Equal(t, "https://volume:8080/3,01", c.fileURL("volume:8080", "3,01", nil))
+
+	c.SetVolumeSchemes("http", map[string]string{"secure:8080": "https"})
+	require.Equal(t, "http://volume:8080/3,01", c.fileURL("volume:8080", "3,01", nil))
+	require.Equal(t, "https://secure:8080/3,01", c.fileURL("secure:8080", "3,01", nil))
+	require.Equal(t, "https://volume:8080/3,01", c.fileURL("https://volume:8080", "3,01", nil))
+}
@@ -0,0 +1,116 @@
+package goseaweedfs
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/linxGnu/goseaweedfs"
+
+// Span attributes.
+var (
+	attrOp         = attribute.Key("seaweedfs.op")
+	attrFileID     = attribute.Key("seaweedfs.fid")
+	attrVolumeID   = attribute.Key("seaweedfs.volume_id")
+	attrCollection = attribute.Key("seaweedfs.collection")
+	attrBytes      = attribute.Key("seaweedfs.bytes")
+	attrFilerPath  = attribute.Key("seaweedfs.filer.path")
+)
+
+// SetTracerProvider sets OpenTelemetry tracer provider of client and its filers. Global provider is used by default.
+// Must be called before using client.
+func (c *Seaweed) SetTracerProvider(tp trace.TracerProvider) {
+	c.client.tracer = tp.Tracer(tracerName)
+	for _, f := range c.filers {
+		f.SetTracerProvider(tp)
+	}
+}
+
+// SetTracerProvider sets OpenTelemetry tracer provider of filer only. Global provider is used by default.
+// Must be called before using filer.
+func (f *Filer) SetTracerProvider(tp trace.TracerProvider) {
+	f.client.tracer = tp.Tracer(tracerName)
+}
+
+// startCall starts span of high-level operation as child of span in ctx. Returned context carries the span, so that
+// nested calls and requests are traced as its children. Returned function ends span and reports call metrics.
+func (c *Seaweed) startCall(ctx context.Context, op string, attrs ...attribute.KeyValue) (context.Context, func(*error)) {
+	start := time.Now()
+	ctx, span := c.client.tracer.Start(ctx, "seaweedfs."+op, trace.WithAttributes(append(attrs, attrOp.String(op))...))
+	return ctx, func(err *error) {
+		endSpan(span, *err)
+		observeCall(c.metrics, op, start, err)
+	}
+}
+
+// startCall starts span of filer operation. See Seaweed.startCall.
+func (f *Filer) startCall(ctx context.Context, op, path string) (context.Context, func(*error)) {
+	start := time.Now()
+	ctx, span := f.client.tracer.Start(ctx, "seaweedfs."+op, trace.WithAttributes(attrOp.String(op), attrFilerPath.String(path)))
+	return ctx, func(err *error) {
+		endSpan(span, *err)
+		observeCall(f.metrics, op, start, err)
+	}
+}
+
+// setSpanAttributes sets attributes of call span in ctx.
+func setSpanAttributes(ctx context.Context, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+// fileIDAttributes attributes of file id and its volume.
+func fileIDAttributes(fileID string) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attrFileID.String(fileID)}
+	if volID, err := parseVolumeID(fileID); err == nil {
+		attrs = append(attrs, attrVolumeID.String(volID))
+	}
+	return attrs
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// startRequest starts span of http request.
+func (c *httpClient) startRequest(ctx context.Context, op, method, rawURL string) (context.Context, trace.Span) {
+	return c.tracer.Start(ctx, "HTTP "+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attrOp.String(op),
+		attribute.String("http.method", method),
+		attribute.String("http.url", rawURL),
+		attribute.String("net.peer.name", hostOf(rawURL)),
+	))
+}
+
+// finishRequest ends span of http request, reports request metrics and logs request summary.
+func (c *httpClient) finishRequest(span trace.Span, op, method, rawURL string, start time.Time, statusCode int, sent, received int64, err error) {
+	if statusCode > 0 {
+		span.SetAttributes(attribute.Int("http.status_code", statusCode))
+	}
+	if sent > 0 {
+		span.SetAttributes(attribute.Int64("http.request_content_length", sent))
+	}
+	if received > 0 {
+		span.SetAttributes(attribute.Int64("http.response_content_length", received))
+	}
+	endSpan(span, err)
+
+	c.observe(op, rawURL, start, sent, received, err)
+	c.logRequest(op, method, rawURL, time.Since(start), statusCode, sent, received, err)
+}
+
+// do sends request, propagating trace context of request to server.
+func (c *httpClient) do(req *http.Request) (*http.Response, error) {
+	otel.GetTextMapPropagator().Inject(req.Context(), propagation.HeaderCarrier(req.Header))
+	return c.client.Do(req)
+}
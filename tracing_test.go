@@ -0,0 +1,71 @@
+package goseaweedfs
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracing(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+
+	traceparent := make(chan string, 1)
+	volume := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent <- r.Header.Get("traceparent")
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer volume.Close()
+
+	master := newFakeMaster(volume)
+	defer master.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	c, err := New(WithMasters(master.URL), WithHTTPClient(http.DefaultClient), WithTracerProvider(tp))
+	require.Nil(t, err)
+	defer c.Close()
+
+	ctx, root := tp.Tracer("test").Start(context.Background(), "root")
+	_, err = c.DownloadContext(ctx, "3,01637037d6", nil, func(r io.Reader) error {
+		_, err := io.Copy(ioutil.Discard, r)
+		return err
+	})
+	require.Nil(t, err)
+	root.End()
+
+	spans := recorder.Ended()
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		byName[s.Name()] = s
+	}
+
+	download := byName["seaweedfs.download"]
+	require.NotNil(t, download)
+	require.Equal(t, root.SpanContext().SpanID(), download.Parent().SpanID())
+	require.Contains(t, download.Attributes(), attrVolumeID.String("3"))
+	require.Contains(t, download.Attributes(), attrBytes.Int64(5))
+
+	lookup := byName["seaweedfs.lookup"]
+	require.NotNil(t, lookup)
+	require.Equal(t, download.SpanContext().SpanID(), lookup.Parent().SpanID())
+
+	var volumeRequest sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		if s.Name() == "HTTP GET" && s.Parent().SpanID() == download.SpanContext().SpanID() {
+			volumeRequest = s
+		}
+	}
+	require.NotNil(t, volumeRequest)
+	require.Contains(t, <-traceparent, volumeRequest.SpanContext().SpanID().String())
+}
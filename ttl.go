@@ -0,0 +1,124 @@
+package goseaweedfs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ErrInvalidTTL invalid ttl string. TTL must be a number (1-255) followed by an optional unit (m, h, d, w, M, y), e.g: "3d".
+var ErrInvalidTTL = errors.New("Invalid ttl")
+
+// TTLUnit unit of time to live.
+type TTLUnit byte
+
+const (
+	// TTLMinute minute unit.
+	TTLMinute TTLUnit = 'm'
+
+	// TTLHour hour unit.
+	TTLHour TTLUnit = 'h'
+
+	// TTLDay day unit.
+	TTLDay TTLUnit = 'd'
+
+	// TTLWeek week unit.
+	TTLWeek TTLUnit = 'w'
+
+	// TTLMonth month unit (30 days).
+	TTLMonth TTLUnit = 'M'
+
+	// TTLYear year unit (365 days).
+	TTLYear TTLUnit = 'y'
+)
+
+// ttlUnits ordered from largest to smallest.
+var ttlUnits = []TTLUnit{TTLYear, TTLMonth, TTLWeek, TTLDay, TTLHour, TTLMinute}
+
+// Duration of one unit.
+func (u TTLUnit) Duration() time.Duration {
+	switch u {
+	case TTLMinute:
+		return time.Minute
+	case TTLHour:
+		return time.Hour
+	case TTLDay:
+		return 24 * time.Hour
+	case TTLWeek:
+		return 7 * 24 * time.Hour
+	case TTLMonth:
+		return 30 * 24 * time.Hour
+	case TTLYear:
+		return 365 * 24 * time.Hour
+	}
+	return 0
+}
+
+// TTL time to live of stored files. According to https://github.com/chrislusf/seaweedfs/wiki/Store-file-with-a-Time-To-Live
+// Zero value means no ttl.
+type TTL struct {
+	Count uint8
+	Unit  TTLUnit
+}
+
+// ParseTTL parses ttl string, e.g: "3m", "4h", "5d", "6w", "7M", "8y". Number without unit is in minutes.
+// Empty string is parsed to zero ttl.
+func ParseTTL(s string) (ttl TTL, err error) {
+	if s == "" {
+		return
+	}
+
+	count, unit := s, TTLMinute
+	if u := TTLUnit(s[len(s)-1]); u.Duration() > 0 {
+		count, unit = s[:len(s)-1], u
+	}
+
+	n, err := strconv.ParseUint(count, 10, 8)
+	if err != nil || n == 0 {
+		return TTL{}, fmt.Errorf("%w: %q", ErrInvalidTTL, s)
+	}
+
+	return TTL{Count: uint8(n), Unit: unit}, nil
+}
+
+// TTLFromDuration converts duration to ttl. The largest unit which represents duration exactly is preferred,
+// otherwise duration is rounded up to the smallest representable ttl.
+func TTLFromDuration(d time.Duration) (TTL, error) {
+	if d <= 0 {
+		return TTL{}, nil
+	}
+
+	for _, u := range ttlUnits {
+		if ud := u.Duration(); d%ud == 0 && d/ud <= 255 {
+			return TTL{Count: uint8(d / ud), Unit: u}, nil
+		}
+	}
+
+	for i := len(ttlUnits) - 1; i >= 0; i-- {
+		ud := ttlUnits[i].Duration()
+		if n := (d + ud - 1) / ud; n <= 255 {
+			return TTL{Count: uint8(n), Unit: ttlUnits[i]}, nil
+		}
+	}
+
+	return TTL{}, fmt.Errorf("%w: duration %v is too long", ErrInvalidTTL, d)
+}
+
+// IsZero reports whether ttl is not set.
+func (t TTL) IsZero() bool {
+	return t.Count == 0
+}
+
+// Duration converts ttl to duration.
+func (t TTL) Duration() time.Duration {
+	return time.Duration(t.Count) * t.Unit.Duration()
+}
+
+// String encodes ttl to SeaweedFS format. Zero ttl is encoded to empty string.
+func (t TTL) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return strconv.Itoa(int(t.Count)) + string(t.Unit)
+}
@@ -0,0 +1,149 @@
+package goseaweedfs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTTL(t *testing.T) {
+	for s, d := range map[string]time.Duration{
+		"3m":  3 * time.Minute,
+		"4h":  4 * time.Hour,
+		"5d":  5 * 24 * time.Hour,
+		"6w":  6 * 7 * 24 * time.Hour,
+		"7M":  7 * 30 * 24 * time.Hour,
+		"8y":  8 * 365 * 24 * time.Hour,
+		"15":  15 * time.Minute,
+		"255": 255 * time.Minute,
+	} {
+		ttl, err := ParseTTL(s)
+		require.Nil(t, err, s)
+		require.Equal(t, d, ttl.Duration(), s)
+	}
+
+	ttl, err := ParseTTL("")
+	require.Nil(t, err)
+	require.True(t, ttl.IsZero())
+	require.Equal(t, "", ttl.String())
+
+	for _, s := range []string{"0d", "256h", "-1m", "d", "3s", "1.5h"} {
+		_, err = ParseTTL(s)
+		require.True(t, errors.Is(err, ErrInvalidTTL), s)
+	}
+}
+
+func TestTTLFromDuration(t *testing.T) {
+	ttl, err := TTLFromDuration(3 * time.Hour)
+	require.Nil(t, err)
+	require.Equal(t, "3h", ttl.String())
+
+	ttl, err = TTLFromDuration(14 * 24 * time.Hour)
+	require.Nil(t, err)
+	require.Equal(t, "2w", ttl.String())
+
+	ttl, err = TTLFromDuration(90 * time.Second)
+	require.Nil(t, err)
+	require.Equal(t, "2m", ttl.String())
+
+	ttl, err = TTLFromDuration(300 * time.Minute)
+	require.Nil(t, err)
+	require.Equal(t, "5h", ttl.String())
+
+	_, err = TTLFromDuration(256 * 365 * 24 * time.Hour)
+	require.NotNil(t, err)
+}
+
+func TestReplicaPlacement(t *testing.T) {
+	rp, err := ParseReplicaPlacement("110")
+	require.Nil(t, err)
+	require.Equal(t, "110", rp.String())
+	require.Equal(t, 3, rp.CopyCount())
+
+	rp, err = ParseReplicaPlacement("")
+	require.Nil(t, err)
+	require.Nil(t, rp)
+	require.Equal(t, 1, rp.CopyCount())
+
+	for _, s := range []string{"01", "0001", "a01", "-01"} {
+		_, err = ParseReplicaPlacement(s)
+		require.True(t, errors.Is(err, ErrInvalidReplication), s)
+	}
+
+	topo := &Topology{
+		DataCenters: []*DataCenter{
+			{Racks: []*Rack{{DataNodes: []*DataNode{{}, {}}}}},
+		},
+	}
+
+	rp, _ = ParseReplicaPlacement("001")
+	require.Nil(t, rp.Validate(topo))
+
+	rp, _ = ParseReplicaPlacement("010")
+	require.True(t, errors.Is(rp.Validate(topo), ErrInvalidReplication))
+
+	rp, _ = ParseReplicaPlacement("100")
+	require.True(t, errors.Is(rp.Validate(topo), ErrInvalidReplication))
+
+	rp, _ = ParseReplicaPlacement("002")
+	require.True(t, errors.Is(rp.Validate(topo), ErrInvalidReplication))
+}
+
+func TestGrowPlacementValidation(t *testing.T) {
+	var grows int32
+	master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dir/status":
+			_ = json.NewEncoder(w).Encode(SystemStatus{Topology: Topology{DataCenters: []*DataCenter{
+				{ID: "dc1", Racks: []*Rack{{ID: "r1", DataNodes: []*DataNode{{URL: "a:8080"}, {URL: "b:8080"}}}}},
+			}}})
+		case "/vol/grow":
+			atomic.AddInt32(&grows, 1)
+			_, _ = w.Write([]byte(`{"count":1}`))
+		}
+	}))
+	defer master.Close()
+
+	c, err := New(WithMasters(master.URL))
+	require.Nil(t, err)
+	defer c.Close()
+
+	rp, err := ParseReplicaPlacement("010")
+	require.Nil(t, err)
+
+	// master decides by default
+	require.Nil(t, c.GrowWithOptions(&AssignOptions{Count: 1, Replication: rp}))
+	require.EqualValues(t, 1, grows)
+
+	c.SetPlacementValidation(true)
+	err = c.GrowWithOptions(&AssignOptions{Count: 1, Replication: rp})
+	require.True(t, errors.Is(err, ErrInvalidReplication))
+	require.EqualValues(t, 1, grows)
+
+	rp, _ = ParseReplicaPlacement("001")
+	require.Nil(t, c.GrowWithOptions(&AssignOptions{Count: 1, Replication: rp}))
+	require.EqualValues(t, 2, grows)
+}
+
+func TestFilePartAssignOptions(t *testing.T) {
+	ttl, err := ParseTTL("3d")
+	require.Nil(t, err)
+
+	fp := &FilePart{Collection: "c", AssignOptions: &AssignOptions{Collection: "x", TTL: ttl, DataCenter: "dc1", Count: 5}}
+	opts := fp.assignOptions()
+	require.Equal(t, "c", opts.Collection)
+	require.Equal(t, "3d", opts.TTL.String())
+	require.Equal(t, "3d", fp.ttl())
+	require.Equal(t, "dc1", opts.DataCenter)
+	require.Equal(t, 0, opts.Count)
+	require.Equal(t, 5, fp.AssignOptions.Count)
+
+	fp.AssignOptions = nil
+	require.Equal(t, "", fp.ttl())
+}
@@ -1,6 +1,7 @@
 package goseaweedfs
 
 import (
+	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -9,9 +10,22 @@ import (
 )
 
 func parseURI(uri string) (u *url.URL, err error) {
+	return parseURIWithScheme(uri, "")
+}
+
+// parseURIWithScheme parses uri, using default scheme (http if empty) for uri without scheme, e.g: "localhost:8888".
+func parseURIWithScheme(uri, defaultScheme string) (u *url.URL, err error) {
+	if defaultScheme == "" {
+		defaultScheme = "http"
+	}
+
+	if !strings.Contains(uri, "://") {
+		uri = defaultScheme + "://" + uri
+	}
+
 	u, err = url.Parse(uri)
-	if err == nil && u.Scheme == "" {
-		u.Scheme = "http"
+	if err == nil && u.Host == "" {
+		err = errors.New("Invalid uri " + uri)
 	}
 	return
 }
@@ -29,6 +43,22 @@ func encodeURI(base url.URL, path string, args url.Values) string {
 	return base.String()
 }
 
+// parseVolumeID extracts volume id from file id, e.g: "3" from "3,01637037d6" or "3/01637037d6".
+func parseVolumeID(fileID string) (string, error) {
+	var parts []string
+	if strings.Contains(fileID, ",") {
+		parts = strings.Split(fileID, ",")
+	} else {
+		parts = strings.Split(fileID, "/")
+	}
+
+	if len(parts) != 2 { // wrong file id format
+		return "", errors.New("Invalid fileID " + fileID)
+	}
+
+	return parts[0], nil
+}
+
 func valid(c rune) bool {
 	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') || '.' == c || '-' == c || '_' == c
 }
@@ -51,9 +81,12 @@ func normalizeName(st string) string {
 	return st
 }
 
-func drainAndClose(body io.ReadCloser) {
-	_, _ = io.Copy(ioutil.Discard, body)
-	_ = body.Close()
+func drainAndClose(body io.ReadCloser) (err error) {
+	_, err = io.Copy(ioutil.Discard, body)
+	if e := body.Close(); err == nil {
+		err = e
+	}
+	return
 }
 
 func normalize(values url.Values, collection, ttl string) url.Values {